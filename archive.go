@@ -0,0 +1,434 @@
+package top
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/djherbis/times"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// archiveExtensions are the suffixes of the archives that can be served as roots.
+var archiveExtensions = []string{".zip", ".tar", ".tar.gz", ".tgz", ".tar.zst"}
+
+// IsArchive reports whether path names an archive that can be served as a root, by its extension.
+func IsArchive(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// openArchive loads the archive at path, a file of b, into a read-only backend in which its entries are
+// below path, as if the archive were a directory. Entries whose names would escape the archive, such as
+// absolute names or names with .. elements, are rejected. The entries are listed in memory, while the
+// content of files is read from the archive when they are read, if b allows random access to it.
+// Otherwise, as for compressed tar archives, the content is loaded into memory, up to maxBytes in all
+// if it is not 0.
+func openArchive(b Backend, path string, maxBytes int64) (*archiveBackend, error) {
+	archive := &archiveLoader{mem: NewMemoryBackend(), root: path, sources: map[string]*memorySource{}, maxBytes: maxBytes}
+	if err := mkdirAll(archive.mem, path, 0555); err != nil {
+		return nil, err
+	}
+	f, err := openFile(b, path)
+	if err != nil {
+		return nil, err
+	}
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		err = archive.loadZip(f)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(f); err == nil {
+			err = archive.loadTar(gz)
+		}
+	case strings.HasSuffix(lower, ".tar.zst"):
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(f); err == nil {
+			err = archive.loadTar(zr)
+			zr.Close()
+		}
+	case strings.HasSuffix(lower, ".tar"):
+		err = archive.loadTar(f)
+	default:
+		err = errors.New("unknown archive format")
+	}
+	if err != nil || !archive.inPlace {
+		f.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("archive %s: %w", path, err)
+	}
+	backend := &archiveBackend{readOnlyBackend: readOnlyBackend{archive.mem}}
+	if archive.inPlace {
+		backend.file = f
+	}
+	return backend, nil
+}
+
+// archiveBackend serves the entries of an archive.
+type archiveBackend struct {
+	readOnlyBackend
+	file File // The archive, if the content of files is read from it
+}
+
+// Close closes the archive.
+func (a *archiveBackend) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// archiveLoader adds the entries of an archive to a memory backend, below root.
+type archiveLoader struct {
+	mem      *MemoryBackend
+	root     string
+	sources  map[string]*memorySource // Content of the files added, by path
+	inPlace  bool                     // Whether content is read from the archive
+	held     int64                    // Bytes of content loaded into memory
+	maxBytes int64                    // Limit of held, if not 0
+}
+
+// randomAccess returns f as an io.ReaderAt, with its size, if it is one.
+func randomAccess(f File) (io.ReaderAt, int64, bool) {
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		return nil, 0, false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, false
+	}
+	return ra, info.Size(), true
+}
+
+// reserve counts size more bytes of content loaded into memory, unless they would exceed the limit.
+func (a *archiveLoader) reserve(size int64) error {
+	if a.maxBytes != 0 && a.held+size > a.maxBytes {
+		return fmt.Errorf("content exceeds the limit of %d bytes loaded into memory; "+
+			"serve the archive as an uncompressed .tar or .zip on the local filesystem, which is read in place", a.maxBytes)
+	}
+	a.held += size
+	return nil
+}
+
+// hold loads size bytes of content from r into memory, unless they would exceed the limit.
+func (a *archiveLoader) hold(r io.Reader, size int64) (*memorySource, error) {
+	if err := a.reserve(size); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return nil, err
+	}
+	return &memorySource{size: int64(len(data)), open: func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}}, nil
+}
+
+// entryPath returns the path of an entry named name, or an error if the name would escape the archive.
+func (a *archiveLoader) entryPath(name string) (string, error) {
+	clean := strings.TrimSuffix(name, "/")
+	if clean == "" || clean == "." {
+		return a.root, nil
+	}
+	if !filepath.IsLocal(clean) || strings.Contains(clean, `\`) {
+		return "", fmt.Errorf("entry %q is outside the archive", name)
+	}
+	return filepath.Join(a.root, filepath.FromSlash(clean)), nil
+}
+
+// add adds an entry of the given type, creating its missing parents. Files read their content from
+// source. Later entries replace earlier files of the same name, as when extracting.
+func (a *archiveLoader) add(name string, mode fs.FileMode, modTime time.Time, source *memorySource, target string) error {
+	path, err := a.entryPath(name)
+	if err != nil {
+		return err
+	}
+	if err := mkdirAll(a.mem, filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	switch {
+	case mode.IsDir():
+		err = mkdirAll(a.mem, path, mode.Perm())
+	case mode&fs.ModeSymlink != 0:
+		if err = a.mem.Remove(path); err == nil || errors.Is(err, fs.ErrNotExist) {
+			err = a.mem.Symlink(target, path)
+		}
+	default:
+		if err = writeFile(a.mem, path, nil, mode.Perm()); err == nil {
+			err = a.mem.setSource(path, source)
+		}
+		a.sources[path] = source
+	}
+	if err != nil {
+		return err
+	}
+	return a.mem.setModTime(path, modTime)
+}
+
+// loadTar adds the entries of a tar archive. The content of files is read in place if r is a file with
+// random access, and loaded into memory otherwise, as is that of sparse files.
+func (a *archiveLoader) loadTar(r io.Reader) error {
+	var sr *io.SectionReader
+	if f, ok := r.(File); ok {
+		if ra, size, ok := randomAccess(f); ok {
+			sr = io.NewSectionReader(ra, 0, size)
+			r, a.inPlace = sr, true
+		}
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		mode := fs.FileMode(hdr.Mode).Perm()
+		var source *memorySource
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			mode |= fs.ModeDir
+		case tar.TypeSymlink:
+			mode |= fs.ModeSymlink
+		case tar.TypeLink:
+			// Hard links share the content of an earlier entry
+			linked, err := a.entryPath(hdr.Linkname)
+			if err != nil {
+				return err
+			}
+			if source = a.sources[linked]; source == nil {
+				return fmt.Errorf("entry %q links to %q, which is not an earlier file", hdr.Name, hdr.Linkname)
+			}
+		case tar.TypeReg, tar.TypeGNUSparse:
+			// Sparse files are stored without their holes, which only the tar reader fills in
+			if sr == nil || isSparse(hdr) {
+				if source, err = a.hold(tr, hdr.Size); err != nil {
+					return err
+				}
+				break
+			}
+			// The content starts where the reader stopped after the header
+			offset, err := sr.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			source = &memorySource{size: hdr.Size, open: func() (io.ReadCloser, error) {
+				return io.NopCloser(io.NewSectionReader(sr, offset, hdr.Size)), nil
+			}}
+		default:
+			// Devices, pipes and the like have no place in a read-only tree of files
+			continue
+		}
+		if err := a.add(hdr.Name, mode, hdr.ModTime, source, hdr.Linkname); err != nil {
+			return err
+		}
+	}
+}
+
+// isSparse reports whether hdr is of a sparse file, in the GNU format or with the PAX records of GNU tar.
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// loadZip adds the entries of a zip archive. The content of files is read in place, from the archive
+// itself, or from a copy loaded into memory if f has no random access.
+func (a *archiveLoader) loadZip(f File) error {
+	// Zip archives are read from their end, which needs random access
+	r, size, ok := randomAccess(f)
+	if ok {
+		a.inPlace = true
+	} else {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if err := a.reserve(info.Size()); err != nil {
+			return err
+		}
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		r, size = bytes.NewReader(data), int64(len(data))
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		var source *memorySource
+		var target string
+		switch {
+		case mode.IsDir():
+		case mode&fs.ModeSymlink != 0:
+			// The content of symlinks is their target
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			data, err := io.ReadAll(io.LimitReader(rc, maxSymlinkTarget))
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			target = string(data)
+		default:
+			source = &memorySource{size: int64(zf.UncompressedSize64), open: zf.Open}
+		}
+		if err := a.add(zf.Name, mode, zf.Modified, source, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxSymlinkTarget is the length of the longest symlink target read from zip archives, that of the
+// longest path on Linux.
+const maxSymlinkTarget = 4096
+
+// readOnlyBackend serves a backend without letting anything be modified.
+type readOnlyBackend struct {
+	Backend
+}
+
+func (r readOnlyBackend) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EROFS}
+	}
+	return r.Backend.OpenFile(name, flag, perm)
+}
+
+func (readOnlyBackend) Mkdir(name string, _ fs.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: syscall.EROFS}
+}
+
+func (readOnlyBackend) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EROFS}
+}
+
+func (readOnlyBackend) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: syscall.EROFS}
+}
+
+func (readOnlyBackend) Symlink(oldname, newname string) error {
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: syscall.EROFS}
+}
+
+// mountBackend serves the backends mounted at some paths, such as archives, and base elsewhere.
+type mountBackend struct {
+	base   Backend
+	mounts map[string]Backend
+	points []string
+}
+
+// mount serves b at and below path, which hides what base has there.
+func (m *mountBackend) mount(path string, b Backend) {
+	if m.mounts == nil {
+		m.mounts = map[string]Backend{}
+	}
+	m.mounts[path] = b
+	m.points = append(m.points, path)
+}
+
+// backend returns the backend serving name.
+func (m *mountBackend) backend(name string) Backend {
+	if point := rootOf(name, m.points); point != "" {
+		return m.mounts[point]
+	}
+	return m.base
+}
+
+func (m *mountBackend) Stat(name string) (fs.FileInfo, error)  { return m.backend(name).Stat(name) }
+func (m *mountBackend) Lstat(name string) (fs.FileInfo, error) { return m.backend(name).Lstat(name) }
+func (m *mountBackend) Remove(name string) error               { return m.backend(name).Remove(name) }
+func (m *mountBackend) Readlink(name string) (string, error)   { return m.backend(name).Readlink(name) }
+
+func (m *mountBackend) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return m.backend(name).OpenFile(name, flag, perm)
+}
+
+func (m *mountBackend) Mkdir(name string, perm fs.FileMode) error {
+	return m.backend(name).Mkdir(name, perm)
+}
+
+func (m *mountBackend) Symlink(oldname, newname string) error {
+	return m.backend(newname).Symlink(oldname, newname)
+}
+
+// ReadDir lists the mount points in a directory as the directories they are mounted as.
+func (m *mountBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	b := m.backend(name)
+	entries, err := b.ReadDir(name)
+	if err != nil || b != m.base {
+		return entries, err
+	}
+	for i, entry := range entries {
+		path := filepath.Join(name, entry.Name())
+		if mounted, ok := m.mounts[path]; ok {
+			if info, err := mounted.Lstat(path); err == nil {
+				entries[i] = fs.FileInfoToDirEntry(info)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// Rename only moves entries within a backend, as across devices.
+func (m *mountBackend) Rename(oldpath, newpath string) error {
+	b := m.backend(oldpath)
+	if b != m.backend(newpath) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+	return b.Rename(oldpath, newpath)
+}
+
+// Times returns the times of files of the backends that know them, and reports the modification time
+// as the access time for the others.
+func (m *mountBackend) Times(name string) (times.Timespec, error) {
+	b := m.backend(name)
+	if tb, ok := b.(timesBackend); ok {
+		return tb.Times(name)
+	}
+	info, err := b.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return modTimes(info.ModTime()), nil
+}
+
+// modTimes are the times of a file whose modification time is all that is known.
+type modTimes time.Time
+
+func (t modTimes) ModTime() time.Time    { return time.Time(t) }
+func (t modTimes) AccessTime() time.Time { return time.Time(t) }
+func (t modTimes) ChangeTime() time.Time { return time.Time(t) }
+func (t modTimes) BirthTime() time.Time  { return time.Time(t) }
+func (t modTimes) HasChangeTime() bool   { return false }
+func (t modTimes) HasBirthTime() bool    { return false }
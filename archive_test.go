@@ -0,0 +1,277 @@
+package top
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// archiveEntry is an entry of a test archive: a directory if its name ends with a slash, a symlink
+// if it has a target, and a file otherwise.
+type archiveEntry struct {
+	name, content, target string
+}
+
+var testArchiveEntries = []archiveEntry{
+	{name: "./"},
+	{name: "docs/"},
+	{name: "docs/a.txt", content: "alpha"},
+	{name: "docs/link", target: "a.txt"},
+	{name: "docs/escape", target: "../../top.txt"},
+	{name: "top.txt", content: "top"},
+}
+
+// writeTestArchive writes entries to an archive whose format is chosen by the extension of path.
+func writeTestArchive(t *testing.T, path string, entries []archiveEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create archive: %v", err)
+	}
+	defer f.Close()
+	if strings.HasSuffix(path, ".zip") {
+		zw := zip.NewWriter(f)
+		for _, e := range entries {
+			hdr := &zip.FileHeader{Name: e.name, Modified: time.Now()}
+			content := e.content
+			switch {
+			case strings.HasSuffix(e.name, "/"):
+				hdr.SetMode(os.ModeDir | 0755)
+			case e.target != "":
+				hdr.SetMode(os.ModeSymlink | 0777)
+				content = e.target
+			default:
+				hdr.SetMode(0644)
+			}
+			w, err := zw.CreateHeader(hdr)
+			if err != nil {
+				t.Fatalf("Failed to add %s: %v", e.name, err)
+			}
+			if _, err := io.WriteString(w, content); err != nil {
+				t.Fatalf("Failed to add %s: %v", e.name, err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("Failed to write archive: %v", err)
+		}
+		return
+	}
+	var w io.WriteCloser = f
+	switch {
+	case strings.HasSuffix(path, ".tar.gz"):
+		w = gzip.NewWriter(f)
+	case strings.HasSuffix(path, ".tar.zst"):
+		if w, err = zstd.NewWriter(f); err != nil {
+			t.Fatalf("Failed to compress archive: %v", err)
+		}
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+		switch {
+		case strings.HasSuffix(e.name, "/"):
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		case e.target != "":
+			hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, e.target
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("Failed to add %s: %v", e.name, err)
+		}
+		if _, err := io.WriteString(tw, e.content); err != nil {
+			t.Fatalf("Failed to add %s: %v", e.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	if w != f {
+		if err := w.Close(); err != nil {
+			t.Fatalf("Failed to compress archive: %v", err)
+		}
+	}
+}
+
+// tarHeader returns a ustar header block, for entries that tar.Writer does not write.
+func tarHeader(name string, typeflag byte, size int) []byte {
+	b := make([]byte, 512)
+	copy(b, name)
+	copy(b[100:], "0000644\x00")
+	copy(b[124:], fmt.Sprintf("%011o\x00", size))
+	copy(b[136:], "00000000000\x00")
+	b[156] = typeflag
+	copy(b[257:], "ustar\x0000")
+	copy(b[148:], "        ")
+	sum := 0
+	for _, c := range b {
+		sum += int(c)
+	}
+	copy(b[148:], fmt.Sprintf("%06o\x00 ", sum))
+	return b
+}
+
+// tarBlocks pads data to whole tar blocks.
+func tarBlocks(data string) []byte {
+	return append([]byte(data), make([]byte, (512-len(data)%512)%512)...)
+}
+
+// paxRecord formats a PAX record, whose length counts its own digits.
+func paxRecord(key, value string) string {
+	n := len(key) + len(value) + 3
+	n += len(strconv.Itoa(n))
+	if len(strconv.Itoa(n)) != len(strconv.Itoa(n-1)) {
+		n++
+	}
+	return fmt.Sprintf("%d %s=%s\n", n, key, value)
+}
+
+func TestArchiveRoots(t *testing.T) {
+	tempDir := t.TempDir()
+	ctx := context.Background()
+
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tar.zst"} {
+		t.Run("Tools browse "+ext+" archives", func(t *testing.T) {
+			archive := filepath.Join(tempDir, "data"+ext)
+			writeTestArchive(t, archive, testArchiveEntries)
+			srv, err := NewServer(WithRoots(Root{Path: archive}))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer srv.Close()
+			c, err := client.NewInProcessClient(srv.MCPServer)
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			defer c.Close()
+			if err := c.Start(ctx); err != nil {
+				t.Fatalf("Failed to start client: %v", err)
+			}
+			initRequest := mcp.InitializeRequest{}
+			initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+			if _, err := c.Initialize(ctx, initRequest); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+			call := func(name string, args map[string]interface{}) (string, bool) {
+				req := mcp.CallToolRequest{}
+				req.Params.Name = name
+				req.Params.Arguments = args
+				result, err := c.CallTool(ctx, req)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return resultText(result), result.IsError
+			}
+
+			steps := []struct {
+				tool     string
+				args     map[string]interface{}
+				expected string
+			}{
+				{"read_file", map[string]interface{}{"path": archive + "/docs/a.txt"}, "alpha"},
+				{"read_file", map[string]interface{}{"path": archive + "/docs/link"}, "alpha"},
+				{"list_directory", map[string]interface{}{"path": archive}, "[DIR] docs\n[FILE] top.txt"},
+				{"directory_tree", map[string]interface{}{"path": archive}, `"name": "a.txt"`},
+				{"search_files", map[string]interface{}{"path": archive, "pattern": "top"}, archive + "/top.txt"},
+				{"get_file_info", map[string]interface{}{"path": archive + "/docs/a.txt"}, `"size":5`},
+			}
+			for _, step := range steps {
+				if text, isError := call(step.tool, step.args); isError || !strings.Contains(text, step.expected) {
+					t.Errorf("Expected %s to return %q, got %q", step.tool, step.expected, text)
+				}
+			}
+			if text, isError := call("read_file", map[string]interface{}{"path": archive + "/docs/escape"}); !isError || !strings.Contains(text, "access denied") {
+				t.Errorf("Expected a symlink out of the archive to be denied, got %q", text)
+			}
+			if text, isError := call("write_file", map[string]interface{}{"path": archive + "/new.txt", "content": "x"}); !isError || !strings.Contains(text, "read-only") {
+				t.Errorf("Expected the archive to be read-only, got %q", text)
+			}
+		})
+	}
+
+	t.Run("Entries escaping the archive are rejected", func(t *testing.T) {
+		for _, name := range []string{"../evil.txt", "/etc/evil.txt", "docs/../../evil.txt"} {
+			for _, ext := range []string{".zip", ".tar"} {
+				archive := filepath.Join(tempDir, "evil"+ext)
+				writeTestArchive(t, archive, []archiveEntry{{name: name, content: "evil"}})
+				_, err := NewServer(WithRoots(Root{Path: archive}))
+				if err == nil || !strings.Contains(err.Error(), "outside the archive") {
+					t.Errorf("Expected %s in a %s archive to be rejected, got %v", name, ext, err)
+				}
+			}
+		}
+	})
+
+	t.Run("Uncompressed archives are read in place", func(t *testing.T) {
+		for _, ext := range []string{".zip", ".tar"} {
+			archive := filepath.Join(tempDir, "inplace"+ext)
+			writeTestArchive(t, archive, testArchiveEntries)
+			// Nothing may be loaded into memory, yet content larger than that can be read
+			b, err := openArchive(OSBackend{}, archive, 1)
+			if err != nil {
+				t.Fatalf("Failed to open %s archive: %v", ext, err)
+			}
+			defer b.Close()
+			for _, name := range []string{"docs/a.txt", "docs/link"} {
+				data, err := readAll(b, filepath.Join(archive, name))
+				if err != nil || string(data) != "alpha" {
+					t.Errorf("Expected %s of a %s archive to contain %q, got %q, %v", name, ext, "alpha", data, err)
+				}
+			}
+			if info, err := b.Stat(filepath.Join(archive, "top.txt")); err != nil || info.Size() != 3 {
+				t.Errorf("Expected a size of 3 in a %s archive, got %v, %v", ext, info, err)
+			}
+		}
+	})
+
+	t.Run("Compressed archives are loaded up to the limit", func(t *testing.T) {
+		for _, ext := range []string{".tar.gz", ".tar.zst"} {
+			archive := filepath.Join(tempDir, "compressed"+ext)
+			writeTestArchive(t, archive, testArchiveEntries)
+			if _, err := NewServer(WithRoots(Root{Path: archive}), WithArchiveBytes(7)); err == nil || !strings.Contains(err.Error(), "limit of 7 bytes") {
+				t.Errorf("Expected a %s archive beyond the limit to be refused, got %v", ext, err)
+			}
+			srv, err := NewServer(WithRoots(Root{Path: archive}), WithArchiveBytes(8))
+			if err != nil {
+				t.Errorf("Expected a %s archive within the limit to be served, got %v", ext, err)
+				continue
+			}
+			srv.Close()
+		}
+	})
+
+	t.Run("Sparse files are read with their holes", func(t *testing.T) {
+		// A PAX 1.0 sparse file of 8 bytes, whose only data is "abc" at offset 5
+		records := paxRecord("GNU.sparse.major", "1") + paxRecord("GNU.sparse.minor", "0") +
+			paxRecord("GNU.sparse.name", "sparse.txt") + paxRecord("GNU.sparse.realsize", "8")
+		content := string(tarBlocks("1\n5\n3\n")) + "abc"
+		var data []byte
+		data = append(data, tarHeader("PaxHeaders/sparse.txt", tar.TypeXHeader, len(records))...)
+		data = append(data, tarBlocks(records)...)
+		data = append(data, tarHeader("sparse.txt", tar.TypeReg, len(content))...)
+		data = append(data, tarBlocks(content)...)
+		data = append(data, make([]byte, 1024)...)
+		archive := filepath.Join(tempDir, "sparse.tar")
+		if err := os.WriteFile(archive, data, 0644); err != nil {
+			t.Fatalf("Failed to write archive: %v", err)
+		}
+		b, err := openArchive(OSBackend{}, archive, 0)
+		if err != nil {
+			t.Fatalf("Failed to open archive: %v", err)
+		}
+		defer b.Close()
+		if content, err := readAll(b, filepath.Join(archive, "sparse.txt")); err != nil || string(content) != "\x00\x00\x00\x00\x00abc" {
+			t.Errorf("Expected the holes to be filled in, got %q, %v", content, err)
+		}
+	})
+}
@@ -0,0 +1,329 @@
+package top
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// argField is the declaration of an argument. The arguments of tools, resources, prompts and
+// completions are declared as structs whose fields are tagged with the name of the argument, its
+// constraints and a description:
+//
+//	Path     string `arg:"path,required" desc:"Path to the file"`
+//	MaxDepth int    `arg:"maxDepth,default=100,min=1" desc:"Maximum depth of recursion"`
+//
+// The options of arg are required, default=<JSON value without commas>, min=<number>,
+// max=<number>, enum=<value>|<value>... and, for fields of type []any whose elements are checked by
+// the handler, items=<JSON schema type>. Fields may be strings, booleans, integers, floats, slices
+// of them, structs and slices of structs. The same declaration gives the input schema of a tool and decodes
+// the arguments of its calls, so that both agree and every tool reports invalid arguments alike.
+type argField struct {
+	index     int
+	name      string
+	desc      string
+	required  bool
+	def       any // Decoded JSON value, nil if there is no default
+	min, max  *float64
+	enum      []string
+	items     string
+	fieldType reflect.Type
+	fields    []argField // Fields of the struct, or of the elements of the slice, if they are structs
+}
+
+// argFieldsCache holds the declarations of argument structs by type.
+var argFieldsCache sync.Map
+
+// argFields returns the declarations of the fields of an argument struct. Malformed tags are
+// programming errors, so they panic.
+func argFields(t reflect.Type) []argField {
+	if fields, ok := argFieldsCache.Load(t); ok {
+		return fields.([]argField)
+	}
+	var fields []argField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("arg")
+		if !ok || !sf.IsExported() {
+			continue
+		}
+		options := strings.Split(tag, ",")
+		f := argField{index: i, name: options[0], desc: sf.Tag.Get("desc"), fieldType: sf.Type}
+		for _, option := range options[1:] {
+			key, value, _ := strings.Cut(option, "=")
+			switch key {
+			case "required":
+				f.required = true
+			case "default":
+				if err := json.Unmarshal([]byte(value), &f.def); err != nil {
+					panic(fmt.Sprintf("argument %s of %s: invalid default %q", f.name, t, value))
+				}
+			case "min", "max":
+				n, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					panic(fmt.Sprintf("argument %s of %s: invalid %s %q", f.name, t, key, value))
+				}
+				if key == "min" {
+					f.min = &n
+				} else {
+					f.max = &n
+				}
+			case "enum":
+				f.enum = strings.Split(value, "|")
+			case "items":
+				f.items = value
+			default:
+				panic(fmt.Sprintf("argument %s of %s: unknown option %q", f.name, t, key))
+			}
+		}
+		if elem := structType(sf.Type); elem != nil {
+			f.fields = argFields(elem)
+		}
+		fields = append(fields, f)
+	}
+	argFieldsCache.Store(t, fields)
+	return fields
+}
+
+// structType returns t if it is a struct, or the type of its elements if it is a slice of structs.
+func structType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		return t
+	}
+	return nil
+}
+
+// withArguments declares the arguments of a tool from the fields of T.
+func withArguments[T any]() mcp.ToolOption {
+	return func(tool *mcp.Tool) {
+		properties, required := argSchemas(argFields(reflect.TypeFor[T]()))
+		tool.InputSchema.Properties = properties
+		tool.InputSchema.Required = required
+	}
+}
+
+// withPromptArguments declares the arguments of a prompt from the fields of T, which must be strings.
+func withPromptArguments[T any]() mcp.PromptOption {
+	return func(prompt *mcp.Prompt) {
+		for _, f := range argFields(reflect.TypeFor[T]()) {
+			prompt.Arguments = append(prompt.Arguments, mcp.PromptArgument{
+				Name:        f.name,
+				Description: f.desc,
+				Required:    f.required,
+			})
+		}
+	}
+}
+
+// argSchemas returns the JSON schemas of the properties of an object with the given fields, and
+// the names of those that are required.
+func argSchemas(fields []argField) (map[string]any, []string) {
+	properties := map[string]any{}
+	var required []string
+	for _, f := range fields {
+		schema := typeSchema(f.fieldType, f.fields)
+		if f.items != "" {
+			schema["items"] = map[string]any{"type": f.items}
+		}
+		if f.desc != "" {
+			schema["description"] = f.desc
+		}
+		if f.def != nil {
+			schema["default"] = f.def
+		}
+		if f.min != nil {
+			schema["minimum"] = *f.min
+		}
+		if f.max != nil {
+			schema["maximum"] = *f.max
+		}
+		if f.enum != nil {
+			schema["enum"] = f.enum
+		}
+		properties[f.name] = schema
+		if f.required {
+			required = append(required, f.name)
+		}
+	}
+	return properties, required
+}
+
+// typeSchema returns the JSON schema of values of t, whose struct fields, if any, are fields.
+func typeSchema(t reflect.Type, fields []argField) map[string]any {
+	switch t.Kind() {
+	case reflect.Slice:
+		schema := map[string]any{"type": "array"}
+		if t.Elem().Kind() != reflect.Interface {
+			schema["items"] = typeSchema(t.Elem(), fields)
+		}
+		return schema
+	case reflect.Struct:
+		properties, required := argSchemas(fields)
+		schema := map[string]any{"type": "object", "properties": properties}
+		if required != nil {
+			schema["required"] = required
+		}
+		return schema
+	case reflect.Interface:
+		return map[string]any{}
+	}
+	return map[string]any{"type": jsonType(t)}
+}
+
+// jsonType returns the JSON schema type of values of t.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		return "array"
+	case reflect.Struct:
+		return "object"
+	}
+	panic(fmt.Sprintf("unsupported argument type %s", t))
+}
+
+// bindArguments decodes arguments into a T, applying the defaults of those that are missing. The
+// error tells which argument is invalid and why, such as "edits[0].oldText is required".
+func bindArguments[T any](arguments map[string]any) (T, error) {
+	var args T
+	v := reflect.ValueOf(&args).Elem()
+	err := decodeObject("", arguments, v, argFields(v.Type()))
+	return args, err
+}
+
+// decodeObject decodes the properties of an object into the fields of a struct, naming them after prefix.
+func decodeObject(prefix string, object map[string]any, v reflect.Value, fields []argField) error {
+	for _, f := range fields {
+		name := prefix + f.name
+		value := object[f.name]
+		if value == nil {
+			if f.required {
+				return fmt.Errorf("%s is required", name)
+			}
+			if f.def == nil {
+				continue
+			}
+			value = f.def
+		}
+		if err := decodeValue(name, value, v.Field(f.index), f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeValue decodes a value into v, checking the constraints of its declaration f.
+func decodeValue(name string, value any, v reflect.Value, f argField) error {
+	switch v.Kind() {
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", name)
+		}
+		if f.enum != nil && !slices.Contains(f.enum, s) {
+			return fmt.Errorf("%s must be one of %s", name, strings.Join(f.enum, ", "))
+		}
+		v.SetString(s)
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("%s must be a boolean", name)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		n, ok := number(value)
+		integer := v.CanInt()
+		if !ok || (integer && (n != math.Trunc(n) || math.Abs(n) >= 1<<63)) {
+			if integer {
+				return fmt.Errorf("%s must be an integer", name)
+			}
+			return fmt.Errorf("%s must be a number", name)
+		}
+		if f.min != nil && n < *f.min {
+			return fmt.Errorf("%s must be at least %v", name, *f.min)
+		}
+		if f.max != nil && n > *f.max {
+			return fmt.Errorf("%s must be at most %v", name, *f.max)
+		}
+		if integer {
+			v.SetInt(int64(n))
+		} else {
+			v.SetFloat(n)
+		}
+	case reflect.Slice:
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return fmt.Errorf("%s must be an array", name)
+		}
+		slice := reflect.MakeSlice(v.Type(), rv.Len(), rv.Len())
+		for i := range rv.Len() {
+			elem := rv.Index(i).Interface()
+			if slice.Index(i).Kind() == reflect.Interface {
+				if elem != nil {
+					slice.Index(i).Set(reflect.ValueOf(elem))
+				}
+				continue
+			}
+			if err := decodeValue(fmt.Sprintf("%s[%d]", name, i), elem, slice.Index(i), argField{fields: f.fields}); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Struct:
+		object, ok := objectValue(value)
+		if !ok {
+			return fmt.Errorf("%s must be an object", name)
+		}
+		return decodeObject(name+".", object, v, f.fields)
+	default:
+		panic(fmt.Sprintf("unsupported argument type %s", v.Type()))
+	}
+	return nil
+}
+
+// number returns a value as a float64 if it is a number, as clients embedding the server may pass
+// Go integers where decoded JSON has float64.
+func number(value any) (float64, bool) {
+	rv := reflect.ValueOf(value)
+	switch {
+	case rv.CanInt():
+		return float64(rv.Int()), true
+	case rv.CanUint():
+		return float64(rv.Uint()), true
+	case rv.CanFloat():
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// objectValue returns a value as a map if it is a JSON object, or a Go map with string keys.
+func objectValue(value any) (map[string]any, bool) {
+	if object, ok := value.(map[string]any); ok {
+		return object, true
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	object := make(map[string]any, rv.Len())
+	for iter := rv.MapRange(); iter.Next(); {
+		object[iter.Key().String()] = iter.Value().Interface()
+	}
+	return object, true
+}
@@ -0,0 +1,100 @@
+package top
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testArgs exercises every kind of argument.
+type testArgs struct {
+	Name  string   `arg:"name,required" desc:"A name"`
+	Mode  string   `arg:"mode,default=\"fast\",enum=fast|slow"`
+	Count int      `arg:"count,default=3,min=1,max=10"`
+	Ratio float64  `arg:"ratio"`
+	Flag  bool     `arg:"flag,default=true"`
+	Tags  []string `arg:"tags"`
+	Items []any    `arg:"items,items=string"`
+	Edits []Edit   `arg:"edits"`
+}
+
+func TestBindArguments(t *testing.T) {
+	t.Run("Arguments are decoded with defaults", func(t *testing.T) {
+		args, err := bindArguments[testArgs](map[string]any{
+			"name":  "x",
+			"ratio": 0.5,
+			"tags":  []any{"a", "b"},
+			"items": []any{"c", 1.0},
+			// Embedders pass Go values rather than decoded JSON
+			"edits": []map[string]any{{"oldText": "old", "newText": "new"}},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := testArgs{
+			Name: "x", Mode: "fast", Count: 3, Ratio: 0.5, Flag: true,
+			Tags: []string{"a", "b"}, Items: []any{"c", 1.0}, Edits: []Edit{{OldText: "old", NewText: "new"}},
+		}
+		if !reflect.DeepEqual(args, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, args)
+		}
+		if args, err := bindArguments[testArgs](map[string]any{"name": "x", "count": 7, "flag": false}); err != nil || args.Count != 7 || args.Flag {
+			t.Errorf("Expected count 7 and flag false, got %+v, %v", args, err)
+		}
+	})
+
+	t.Run("Invalid arguments are named", func(t *testing.T) {
+		tests := []struct {
+			args     map[string]any
+			expected string
+		}{
+			{map[string]any{}, "name is required"},
+			{map[string]any{"name": nil}, "name is required"},
+			{map[string]any{"name": 1.0}, "name must be a string"},
+			{map[string]any{"name": "x", "mode": "medium"}, "mode must be one of fast, slow"},
+			{map[string]any{"name": "x", "count": 2.5}, "count must be an integer"},
+			{map[string]any{"name": "x", "count": 0.0}, "count must be at least 1"},
+			{map[string]any{"name": "x", "count": 11.0}, "count must be at most 10"},
+			{map[string]any{"name": "x", "ratio": "half"}, "ratio must be a number"},
+			{map[string]any{"name": "x", "flag": "yes"}, "flag must be a boolean"},
+			{map[string]any{"name": "x", "tags": "a"}, "tags must be an array"},
+			{map[string]any{"name": "x", "tags": []any{"a", 1.0}}, "tags[1] must be a string"},
+			{map[string]any{"name": "x", "edits": []any{"edit"}}, "edits[0] must be an object"},
+			{map[string]any{"name": "x", "edits": []any{map[string]any{"newText": "new"}}}, "edits[0].oldText is required"},
+		}
+		for _, tc := range tests {
+			_, err := bindArguments[testArgs](tc.args)
+			if err == nil || err.Error() != tc.expected {
+				t.Errorf("Expected %q for %v, got %v", tc.expected, tc.args, err)
+			}
+		}
+	})
+
+	t.Run("Schemas follow the declarations", func(t *testing.T) {
+		properties, required := argSchemas(argFields(reflect.TypeFor[testArgs]()))
+		if !reflect.DeepEqual(required, []string{"name"}) {
+			t.Errorf("Expected name to be required, got %v", required)
+		}
+		expected := map[string]any{
+			"name":  map[string]any{"type": "string", "description": "A name"},
+			"mode":  map[string]any{"type": "string", "default": "fast", "enum": []string{"fast", "slow"}},
+			"count": map[string]any{"type": "integer", "default": 3.0, "minimum": 1.0, "maximum": 10.0},
+			"ratio": map[string]any{"type": "number"},
+			"flag":  map[string]any{"type": "boolean", "default": true},
+			"tags":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"items": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"edits": map[string]any{"type": "array", "items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"oldText": map[string]any{"type": "string", "description": "Text to replace"},
+					"newText": map[string]any{"type": "string", "description": "Replacement text"},
+				},
+				"required": []string{"oldText", "newText"},
+			}},
+		}
+		for name, schema := range expected {
+			if !reflect.DeepEqual(properties[name], schema) {
+				t.Errorf("Expected schema %v for %s, got %v", schema, name, properties[name])
+			}
+		}
+	})
+}
@@ -0,0 +1,245 @@
+package top
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry is a single line of the audit log, describing one tool invocation.
+type AuditEntry struct {
+	Time         string              `json:"time"`
+	DurationMs   int64               `json:"durationMs"`
+	Session      string              `json:"session,omitempty"`
+	Client       *mcp.Implementation `json:"client,omitempty"`
+	Tool         string              `json:"tool"`
+	Paths        []string            `json:"paths,omitempty"`
+	Outcome      string              `json:"outcome"`
+	Error        string              `json:"error,omitempty"`
+	BytesRead    int64               `json:"bytesRead,omitempty"`
+	BytesWritten int64               `json:"bytesWritten,omitempty"`
+	Changes      []AuditChange       `json:"changes,omitempty"`
+}
+
+// AuditChange records the content hashes of a path touched by a mutating tool.
+// Hashes are hex-encoded SHA-256 digests of regular file contents; an empty hash
+// means the path did not exist or was not a regular file.
+type AuditChange struct {
+	Path    string `json:"path"`
+	NewPath string `json:"newPath,omitempty"`
+	Before  string `json:"before,omitempty"`
+	After   string `json:"after,omitempty"`
+}
+
+// Audit outcomes
+const (
+	AuditOK    = "ok"
+	AuditError = "error"
+)
+
+// AuditLog appends one JSON object per tool call to an underlying writer.
+type AuditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewAuditLog creates an audit log writing to w.
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w}
+}
+
+// OpenAuditLog opens path for appending, creating it if needed, and returns an audit log writing to it.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuditLog(f), nil
+}
+
+// Close closes the underlying writer if it is closeable.
+func (a *AuditLog) Close() error {
+	if c, ok := a.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Write appends an entry to the log.
+func (a *AuditLog) Write(entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.w.Write(append(data, '\n'))
+	return err
+}
+
+// Wrap returns a copy of t whose handler writes an audit entry for every call.
+// If the entry cannot be written, the call fails.
+func (a *AuditLog) Wrap(t tester.ToolHandler) tester.ToolHandler {
+	name := t.Tool.Name
+	handler := t.Handler
+	t.Handler = func(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		rec := &callRecord{hashChanges: true}
+		result, err := handler(withCallRecord(ctx, rec), req, allowedDirs)
+
+		entry := AuditEntry{
+			Time:       start.UTC().Format(time.RFC3339Nano),
+			DurationMs: time.Since(start).Milliseconds(),
+			Tool:       name,
+			Outcome:    AuditOK,
+		}
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			entry.Session = session.SessionID()
+			if withInfo, ok := session.(server.SessionWithClientInfo); ok {
+				info := withInfo.GetClientInfo()
+				if info.Name != "" || info.Version != "" {
+					entry.Client = &info
+				}
+			}
+		}
+		rec.fill(&entry)
+		if err != nil {
+			entry.Outcome = AuditError
+			entry.Error = err.Error()
+		} else if result != nil && result.IsError {
+			entry.Outcome = AuditError
+			entry.Error = resultText(result)
+		}
+		if werr := a.Write(entry); werr != nil {
+			return nil, werr
+		}
+		return result, err
+	}
+	return t
+}
+
+// resultText returns the text of the first text content in a result.
+func resultText(result *mcp.CallToolResult) string {
+	for _, c := range result.Content {
+		if text, ok := c.(mcp.TextContent); ok {
+			return text.Text
+		}
+	}
+	return ""
+}
+
+// callRecord accumulates facts about a single tool call while its handler runs.
+// Handlers report to it through the note* functions, which are no-ops when the
+// context carries no record. Records of nested wrappers each receive every note.
+type callRecord struct {
+	mu           sync.Mutex
+	parent       *callRecord
+	hashChanges  bool
+	paths        []string
+	bytesRead    int64
+	bytesWritten int64
+	walkEntries  int64
+	changes      []AuditChange
+}
+
+type callRecordKey struct{}
+
+func withCallRecord(ctx context.Context, rec *callRecord) context.Context {
+	rec.parent = callRecordFromContext(ctx)
+	return context.WithValue(ctx, callRecordKey{}, rec)
+}
+
+func callRecordFromContext(ctx context.Context) *callRecord {
+	rec, _ := ctx.Value(callRecordKey{}).(*callRecord)
+	return rec
+}
+
+// note applies f to each record of the call, under its lock.
+func note(ctx context.Context, f func(rec *callRecord)) {
+	for rec := callRecordFromContext(ctx); rec != nil; rec = rec.parent {
+		rec.mu.Lock()
+		f(rec)
+		rec.mu.Unlock()
+	}
+}
+
+func (r *callRecord) fill(entry *AuditEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry.Paths = r.paths
+	entry.BytesRead = r.bytesRead
+	entry.BytesWritten = r.bytesWritten
+	entry.Changes = r.changes
+}
+
+// notePath records a validated path used by the call.
+func notePath(ctx context.Context, path string) {
+	note(ctx, func(rec *callRecord) { rec.paths = append(rec.paths, path) })
+}
+
+// noteRead records bytes read from the filesystem.
+func noteRead(ctx context.Context, n int) {
+	note(ctx, func(rec *callRecord) { rec.bytesRead += int64(n) })
+}
+
+// noteWritten records bytes written to the filesystem.
+func noteWritten(ctx context.Context, n int) {
+	note(ctx, func(rec *callRecord) { rec.bytesWritten += int64(n) })
+}
+
+// noteWalked records entries visited by a recursive walk.
+func noteWalked(ctx context.Context, n int) {
+	note(ctx, func(rec *callRecord) { rec.walkEntries += int64(n) })
+}
+
+// noteChange hashes path before a mutation and returns a function to call once
+// the mutation succeeded, with the path the content now lives at.
+func noteChange(ctx context.Context, path string) func(newPath string) {
+	hashed := false
+	note(ctx, func(rec *callRecord) { hashed = hashed || rec.hashChanges })
+	if !hashed {
+		return func(string) {}
+	}
+	before := hashFile(backendFromContext(ctx), path)
+	return func(newPath string) {
+		change := AuditChange{
+			Path:   path,
+			Before: before,
+			After:  hashFile(backendFromContext(ctx), newPath),
+		}
+		if newPath != path {
+			change.NewPath = newPath
+		}
+		note(ctx, func(rec *callRecord) {
+			if rec.hashChanges {
+				rec.changes = append(rec.changes, change)
+			}
+		})
+	}
+}
+
+// hashFile returns the hex SHA-256 of a regular file of b, or "" if it cannot be read.
+func hashFile(b Backend, path string) string {
+	info, err := b.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+	f, err := openFile(b, path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,73 @@
+package top
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/mark3labs/mcp-go/mcp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("before"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var buf bytes.Buffer
+	auditLog := NewAuditLog(&buf)
+	handlers := map[string]func(context.Context, mcp.CallToolRequest, []string) (*mcp.CallToolResult, error){}
+	for _, tool := range Tools {
+		handlers[tool.Tool.Name] = auditLog.Wrap(tool).Handler
+	}
+
+	call := func(name string, args map[string]interface{}) {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = name
+		req.Params.Arguments = args
+		if _, err := handlers[name](context.Background(), req, []string{tempDir}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	call("write_file", map[string]interface{}{"path": testFile, "content": "after!"})
+	call("read_file", map[string]interface{}{"path": testFile})
+	call("read_file", map[string]interface{}{"path": "/etc/passwd"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 audit entries, got %d: %s", len(lines), buf.String())
+	}
+	entries := make([]AuditEntry, len(lines))
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &entries[i]); err != nil {
+			t.Fatalf("Invalid audit entry %q: %v", line, err)
+		}
+	}
+
+	write := entries[0]
+	if write.Tool != "write_file" || write.Outcome != AuditOK || write.BytesWritten != 6 {
+		t.Errorf("Unexpected write entry: %+v", write)
+	}
+	if len(write.Paths) != 1 || write.Paths[0] != testFile {
+		t.Errorf("Unexpected write paths: %v", write.Paths)
+	}
+	if len(write.Changes) != 1 || write.Changes[0].Before == "" || write.Changes[0].After == "" ||
+		write.Changes[0].Before == write.Changes[0].After {
+		t.Errorf("Unexpected write changes: %+v", write.Changes)
+	}
+
+	read := entries[1]
+	if read.Tool != "read_file" || read.Outcome != AuditOK || read.BytesRead != 6 || len(read.Changes) != 0 {
+		t.Errorf("Unexpected read entry: %+v", read)
+	}
+
+	denied := entries[2]
+	if denied.Outcome != AuditError || !strings.Contains(denied.Error, "access denied") || len(denied.Paths) != 0 {
+		t.Errorf("Unexpected denied entry: %+v", denied)
+	}
+}
@@ -0,0 +1,209 @@
+package top
+
+import (
+	"context"
+	"errors"
+	"github.com/djherbis/times"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Backend is the filesystem that tools, resources, prompts and completions operate on. Paths are
+// absolute and clean, as validatePath returns them. Errors are those of the os package, such as
+// *fs.PathError wrapping syscall.ENOENT, so that clients see the same messages whatever the backend.
+type Backend interface {
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	// OpenFile opens a file with the flags of os.OpenFile, creating it with perm if O_CREATE is set.
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	Mkdir(name string, perm fs.FileMode) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	Readlink(name string) (string, error)
+	Symlink(oldname, newname string) error
+}
+
+// File is an open file of a backend.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	Stat() (fs.FileInfo, error)
+}
+
+// OSBackend is the local filesystem, the default backend. Only it can be watched, as changes are
+// followed with the notifications of the operating system.
+type OSBackend struct{}
+
+func (OSBackend) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (OSBackend) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (OSBackend) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (OSBackend) Mkdir(name string, perm fs.FileMode) error  { return os.Mkdir(name, perm) }
+func (OSBackend) Rename(oldpath, newpath string) error       { return os.Rename(oldpath, newpath) }
+func (OSBackend) Remove(name string) error                   { return os.Remove(name) }
+func (OSBackend) Readlink(name string) (string, error)       { return os.Readlink(name) }
+func (OSBackend) Symlink(oldname, newname string) error      { return os.Symlink(oldname, newname) }
+
+func (OSBackend) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Times returns the access, change and birth times of a file, as far as the platform records them.
+func (OSBackend) Times(name string) (times.Timespec, error) {
+	return times.Stat(name)
+}
+
+// timesBackend is implemented by backends that know more times of a file than its modification time.
+type timesBackend interface {
+	Times(name string) (times.Timespec, error)
+}
+
+type backendKey struct{}
+
+// withBackend returns a context whose handlers operate on b.
+func withBackend(ctx context.Context, b Backend) context.Context {
+	return context.WithValue(ctx, backendKey{}, b)
+}
+
+// backendFromContext returns the backend of the call, the local filesystem unless another was set.
+func backendFromContext(ctx context.Context) Backend {
+	if b, ok := ctx.Value(backendKey{}).(Backend); ok {
+		return b
+	}
+	return OSBackend{}
+}
+
+// isLocal reports whether path is on the local filesystem for the call, rather than on another backend
+// or in an archive mounted in the local filesystem.
+func isLocal(ctx context.Context, path string) bool {
+	b := backendFromContext(ctx)
+	if m, ok := b.(*mountBackend); ok {
+		b = m.backend(path)
+	}
+	_, ok := b.(OSBackend)
+	return ok
+}
+
+// UseBackend returns a middleware whose tools operate on b rather than the local filesystem.
+func UseBackend(b Backend) tester.Middleware {
+	return func(t tester.ToolHandler) tester.ToolHandler {
+		handler := t.Handler
+		t.Handler = func(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+			return handler(withBackend(ctx, b), req, allowedDirs)
+		}
+		return t
+	}
+}
+
+// openFile opens a file of b for reading.
+func openFile(b Backend, name string) (File, error) {
+	return b.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// writeFile writes data to a file of b like os.WriteFile.
+func writeFile(b Backend, name string, data []byte, perm fs.FileMode) error {
+	f, err := b.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// copyContent copies the content of the file at name in src to the file at name in dst, like
+// writeFile.
+func copyContent(dst, src Backend, name string, perm fs.FileMode) (int64, error) {
+	in, err := openFile(src, name)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	out, err := dst.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+// mkdirAll creates a directory of b and its missing parents like os.MkdirAll.
+func mkdirAll(b Backend, path string, perm fs.FileMode) error {
+	if info, err := b.Stat(path); err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return &fs.PathError{Op: "mkdir", Path: path, Err: syscall.ENOTDIR}
+	}
+	if parent := filepath.Dir(path); parent != path {
+		if err := mkdirAll(b, parent, perm); err != nil {
+			return err
+		}
+	}
+	if err := b.Mkdir(path, perm); err != nil {
+		// Another call may have created it meanwhile
+		if info, statErr := b.Lstat(path); statErr == nil && info.IsDir() {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// walkDir walks the tree of b at root like filepath.WalkDir, visiting entries in lexical order
+// without following symlinks.
+func walkDir(b Backend, root string, fn fs.WalkDirFunc) error {
+	info, err := b.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDirEntry(b, root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func walkDirEntry(b Backend, path string, entry fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, entry, nil); err != nil || !entry.IsDir() {
+		if errors.Is(err, fs.SkipDir) && entry.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	entries, err := b.ReadDir(path)
+	if err != nil {
+		// The directory is reported again with the error, and may be skipped
+		if err = fn(path, entry, err); err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, child := range entries {
+		if err := walkDirEntry(b, filepath.Join(path, child.Name()), child, fn); err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
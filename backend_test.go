@@ -0,0 +1,135 @@
+package top
+
+import (
+	"context"
+	"errors"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"io/fs"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// failingBackend fails the renames of a backend, as a full or broken disk would.
+type failingBackend struct {
+	Backend
+}
+
+func (failingBackend) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EIO}
+}
+
+func TestMemoryBackend(t *testing.T) {
+	// The directory does not exist on disk, so anything the tools do there stays in memory
+	const root = "/memory-backend-test"
+	mem := NewMemoryBackend()
+	if err := mem.Mkdir(root, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := writeFile(mem, root+"/notes.txt", []byte("hello world"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := mem.Symlink("/etc", root+"/etc"); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	call := func(t *testing.T, b Backend, name string, args map[string]interface{}) (string, bool) {
+		t.Helper()
+		_, client := tester.BypassFactory(Tools, UseBackend(b))(context.Background(), []string{root})
+		req := mcp.CallToolRequest{}
+		req.Params.Name = name
+		req.Params.Arguments = args
+		result, err := client.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return resultText(result), result.IsError
+	}
+
+	t.Run("Tools operate on the backend", func(t *testing.T) {
+		steps := []struct {
+			tool     string
+			args     map[string]interface{}
+			expected string
+		}{
+			{"create_directory", map[string]interface{}{"path": root + "/a/b"}, "Successfully created"},
+			{"write_file", map[string]interface{}{"path": root + "/a/b/c.txt", "content": "one\ntwo\n"}, "Successfully wrote"},
+			{"edit_file", map[string]interface{}{"path": root + "/a/b/c.txt",
+				"edits": []interface{}{map[string]interface{}{"oldText": "two", "newText": "three"}}}, "+three"},
+			{"read_file", map[string]interface{}{"path": root + "/a/b/c.txt"}, "one\nthree\n"},
+			{"move_file", map[string]interface{}{"source": root + "/a/b/c.txt", "destination": root + "/a/d.txt"}, "Successfully moved"},
+			{"list_directory", map[string]interface{}{"path": root + "/a"}, "[DIR] b\n[FILE] d.txt"},
+			{"search_files", map[string]interface{}{"path": root, "pattern": "d.t"}, root + "/a/d.txt"},
+			{"directory_tree", map[string]interface{}{"path": root + "/a", "pretty": false}, `"name": "d.txt"`},
+			{"get_file_info", map[string]interface{}{"path": root + "/notes.txt"}, `"size":11`},
+		}
+		for _, step := range steps {
+			text, isError := call(t, mem, step.tool, step.args)
+			if isError || !strings.Contains(text, step.expected) {
+				t.Fatalf("Expected %s to return %q, got %q", step.tool, step.expected, text)
+			}
+		}
+		if _, err := os.Stat(root); !os.IsNotExist(err) {
+			t.Errorf("Expected nothing to be written to disk")
+		}
+		if data, err := readFileContext(withBackend(context.Background(), mem), root+"/a/d.txt"); err != nil || string(data) != "one\nthree\n" {
+			t.Errorf("Expected the moved file in the backend, got %q, %v", data, err)
+		}
+	})
+
+	t.Run("Paths are validated against the backend", func(t *testing.T) {
+		if text, isError := call(t, mem, "read_file", map[string]interface{}{"path": root + "/etc/passwd"}); !isError || !strings.Contains(text, "access denied") {
+			t.Errorf("Expected symlink out of the allowed directory to be denied, got %q", text)
+		}
+		if text, isError := call(t, mem, "read_file", map[string]interface{}{"path": root + "/missing.txt"}); !isError || !strings.Contains(text, "no such file or directory") {
+			t.Errorf("Expected the error of the local filesystem, got %q", text)
+		}
+		if text, isError := call(t, mem, "watch_directory", map[string]interface{}{"path": root}); !isError {
+			t.Errorf("Expected watching to be unavailable, got %q", text)
+		}
+	})
+
+	t.Run("Backend failures are reported", func(t *testing.T) {
+		text, isError := call(t, failingBackend{mem}, "move_file", map[string]interface{}{
+			"source": root + "/notes.txt", "destination": root + "/moved.txt"})
+		if !isError || !strings.Contains(text, "input/output error") {
+			t.Errorf("Expected the rename to fail, got %q", text)
+		}
+		if _, err := mem.Stat(root + "/notes.txt"); err != nil {
+			t.Errorf("Expected the file to stay in place: %v", err)
+		}
+	})
+
+	t.Run("The memory backend follows the local semantics", func(t *testing.T) {
+		if err := mem.Mkdir(root+"/notes.txt/x", 0755); !errors.Is(err, syscall.ENOTDIR) {
+			t.Errorf("Expected ENOTDIR, got %v", err)
+		}
+		if err := mem.Remove(root + "/a"); !errors.Is(err, syscall.ENOTEMPTY) {
+			t.Errorf("Expected ENOTEMPTY, got %v", err)
+		}
+		if err := mem.Rename(root+"/a", root+"/a/b/a"); !errors.Is(err, syscall.EINVAL) {
+			t.Errorf("Expected EINVAL moving a directory into itself, got %v", err)
+		}
+		if err := mem.Symlink("loop", root+"/loop"); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+		if _, err := mem.Stat(root + "/loop"); !errors.Is(err, syscall.ELOOP) {
+			t.Errorf("Expected ELOOP, got %v", err)
+		}
+		if info, err := mem.Lstat(root + "/loop"); err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			t.Errorf("Expected a symlink, got %v, %v", info, err)
+		}
+		var visited []string
+		err := walkDir(mem, root, func(path string, entry fs.DirEntry, err error) error {
+			visited = append(visited, strings.TrimPrefix(path, root))
+			if entry.Name() == "a" {
+				return fs.SkipDir
+			}
+			return err
+		})
+		if err != nil || strings.Join(visited, " ") != " /a /etc /loop /notes.txt" {
+			t.Errorf("Unexpected walk %v, %v", visited, err)
+		}
+	})
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	top "github.com/optistar/mcp-server-filesystem"
+	"gopkg.in/yaml.v3"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Root modes
+const (
+	ModeReadWrite = "rw"
+	ModeReadOnly  = "ro"
+)
+
+// Transports
+const (
+	TransportStdio = "stdio"
+	TransportSSE   = "sse"
+	TransportHTTP  = "http"
+	TransportUnix  = "unix"
+)
+
+// Log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// envPrefix is prepended to the upper-cased flag name to form its environment variable.
+const envPrefix = "MCP_FS_"
+
+// Config is the effective configuration of the server, merged from defaults,
+// the configuration file, environment variables and command line flags, in increasing priority.
+type Config struct {
+	Roots            []RootConfig `json:"roots"`
+	Deny             []string     `json:"deny"`
+	Tools            []string     `json:"tools"`
+	MaxFileBytes     int64        `json:"max-file-bytes"`
+	MaxResponseBytes int64        `json:"max-response-bytes"`
+	MaxWalkEntries   int          `json:"max-walk-entries"`
+	CallTimeout      Duration     `json:"call-timeout"`
+	QuotaBytes       int64        `json:"quota-bytes"`
+	QuotaFiles       int          `json:"quota-files"`
+	ArchiveBytes     int64        `json:"archive-bytes"`
+	Overlay          bool         `json:"overlay"`
+	OverlayBytes     int64        `json:"overlay-bytes"`
+	AuditLog         string       `json:"audit-log"`
+	LogFile          string       `json:"log-file"`
+	LogLevel         string       `json:"log-level"`
+	LogFormat        string       `json:"log-format"`
+	PromptsDir       string       `json:"prompts-dir"`
+	Landlock         bool         `json:"landlock"`
+	Transport        string       `json:"transport"`
+	Listen           string       `json:"listen"`
+	AuthToken        string       `json:"auth-token"`
+	Socket           string       `json:"socket"`
+	AllowUIDs        []int        `json:"allow-uids"`
+	MetricsAddr      string       `json:"metrics-addr"`
+	OTLPEndpoint     string       `json:"otlp-endpoint"`
+}
+
+// RootConfig is an allowed directory and how it may be accessed.
+// Non-zero quotas override the server-wide ones for this root.
+type RootConfig struct {
+	Path       string `json:"path"`
+	Mode       string `json:"mode"`
+	QuotaBytes int64  `json:"quota-bytes,omitempty"`
+	QuotaFiles int    `json:"quota-files,omitempty"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Roots:        []RootConfig{},
+		Deny:         []string{},
+		Tools:        []string{},
+		ArchiveBytes: 256 << 20,
+		OverlayBytes: 256 << 20,
+		LogLevel:     "info",
+		LogFormat:    LogFormatText,
+		Transport:    TransportStdio,
+		Listen:       "127.0.0.1:8080",
+		AllowUIDs:    []int{},
+	}
+}
+
+// Duration is a time.Duration written as a string such as "90s" in configuration files.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"90s\"")
+	}
+	return d.Set(s)
+}
+
+func (d *Duration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *Duration) Set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// stringList is a repeatable flag. The first value given replaces the list
+// from lower priority sources, further values are appended.
+type stringList struct {
+	list    *[]string
+	touched bool
+}
+
+func (s *stringList) String() string {
+	if s.list == nil {
+		return ""
+	}
+	return strings.Join(*s.list, string(os.PathListSeparator))
+}
+
+func (s *stringList) Set(v string) error {
+	if !s.touched {
+		*s.list = nil
+		s.touched = true
+	}
+	*s.list = append(*s.list, v)
+	return nil
+}
+
+// intList is a repeatable integer flag, with the same replacement rules as stringList.
+type intList struct {
+	list    *[]int
+	touched bool
+}
+
+func (l *intList) String() string {
+	if l.list == nil {
+		return ""
+	}
+	var values []string
+	for _, v := range *l.list {
+		values = append(values, strconv.Itoa(v))
+	}
+	return strings.Join(values, string(os.PathListSeparator))
+}
+
+func (l *intList) Set(v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	if !l.touched {
+		*l.list = nil
+		l.touched = true
+	}
+	*l.list = append(*l.list, n)
+	return nil
+}
+
+// rootList is a repeatable flag adding roots with a given mode, with the same
+// replacement rules as stringList. Flags for different modes share the touched state.
+type rootList struct {
+	roots   *[]RootConfig
+	mode    string
+	touched *bool
+}
+
+func (r *rootList) String() string {
+	if r.roots == nil {
+		return ""
+	}
+	var paths []string
+	for _, root := range *r.roots {
+		if root.Mode == r.mode {
+			paths = append(paths, root.Path)
+		}
+	}
+	return strings.Join(paths, string(os.PathListSeparator))
+}
+
+func (r *rootList) Set(v string) error {
+	if !*r.touched {
+		*r.roots = nil
+		*r.touched = true
+	}
+	*r.roots = append(*r.roots, RootConfig{Path: v, Mode: r.mode})
+	return nil
+}
+
+// newFlagSet creates the flags of the server, bound to cfg.
+// A fresh flag set is used for each configuration source so list flags replace lower priority values.
+func newFlagSet(cfg *Config) (*flag.FlagSet, *rootList) {
+	fs := flag.NewFlagSet("mcp-server-filesystem", flag.ContinueOnError)
+	rootsTouched := new(bool)
+	rwRoots := &rootList{roots: &cfg.Roots, mode: ModeReadWrite, touched: rootsTouched}
+	fs.String("config", "", "Read configuration from this YAML, JSON or TOML file")
+	fs.Bool("print-config", false, "Print the effective configuration as JSON and exit")
+	fs.Var(rwRoots, "root", "Allow read-write access to this directory (repeatable)")
+	fs.Var(&rootList{roots: &cfg.Roots, mode: ModeReadOnly, touched: rootsTouched}, "ro",
+		"Allow read-only access to this directory (repeatable)")
+	fs.Var(&stringList{list: &cfg.Deny}, "deny", "Deny access to paths matching this gitignore-style pattern (repeatable)")
+	fs.Var(&stringList{list: &cfg.Tools}, "tool", "Enable only this tool (repeatable, default all tools)")
+	fs.Int64Var(&cfg.MaxFileBytes, "max-file-bytes", cfg.MaxFileBytes, "Maximum bytes read from a single file (0 for unlimited)")
+	fs.Int64Var(&cfg.MaxResponseBytes, "max-response-bytes", cfg.MaxResponseBytes, "Maximum bytes of text returned by a tool call (0 for unlimited)")
+	fs.IntVar(&cfg.MaxWalkEntries, "max-walk-entries", cfg.MaxWalkEntries, "Maximum entries visited by a recursive walk (0 for unlimited)")
+	fs.Var(&cfg.CallTimeout, "call-timeout", "Maximum duration of a tool call (0 for unlimited)")
+	fs.Int64Var(&cfg.QuotaBytes, "quota-bytes", cfg.QuotaBytes, "Maximum net bytes written under each allowed directory per session (0 for unlimited)")
+	fs.IntVar(&cfg.QuotaFiles, "quota-files", cfg.QuotaFiles, "Maximum files and directories created under each allowed directory per session (0 for unlimited)")
+	fs.Int64Var(&cfg.ArchiveBytes, "archive-bytes", cfg.ArchiveBytes, "Maximum bytes of content loaded into memory from each compressed archive (0 for unlimited)")
+	fs.BoolVar(&cfg.Overlay, "overlay", cfg.Overlay, "Keep the changes of each session in memory, not in a directory on disk, until it commits them with overlay_commit")
+	fs.Int64Var(&cfg.OverlayBytes, "overlay-bytes", cfg.OverlayBytes, "Maximum bytes of file content each session keeps in overlay mode (0 for unlimited)")
+	fs.StringVar(&cfg.AuditLog, "audit-log", cfg.AuditLog, "Append a JSON Lines record of every tool call to this file")
+	fs.StringVar(&cfg.LogFile, "log-file", cfg.LogFile, "Write diagnostics to this file instead of standard error")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "Minimum level of diagnostics: debug, info, warn or error")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "Format of diagnostics: text or json")
+	fs.StringVar(&cfg.PromptsDir, "prompts-dir", cfg.PromptsDir, "Load prompt templates (*.tmpl) from this directory")
+	fs.BoolVar(&cfg.Landlock, "landlock", cfg.Landlock, "Restrict the process to the allowed directories with Landlock (Linux only)")
+	fs.StringVar(&cfg.Transport, "transport", cfg.Transport, "Transport to serve on: stdio, sse, http (Streamable HTTP) or unix (Streamable HTTP on a Unix socket)")
+	fs.StringVar(&cfg.Listen, "listen", cfg.Listen, "Address to listen on with the sse and http transports")
+	fs.StringVar(&cfg.AuthToken, "auth-token", cfg.AuthToken, "Bearer token required from clients of the sse, http and unix transports")
+	fs.StringVar(&cfg.Socket, "socket", cfg.Socket, "Path of the Unix socket to listen on with the unix transport")
+	fs.Var(&intList{list: &cfg.AllowUIDs}, "allow-uid", "Accept unix transport connections from processes of this user ID (repeatable, default the server's own)")
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", cfg.MetricsAddr, "Serve Prometheus metrics at /metrics on this address")
+	fs.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", cfg.OTLPEndpoint, "Export traces to the OTLP/HTTP collector at this URL, such as http://localhost:4318")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: mcp-server-filesystem [flags] [<allowed-directory> ...]")
+		fmt.Fprintln(fs.Output(), "Every flag can also be set with an environment variable, such as "+
+			envPrefix+"MAX_FILE_BYTES for --max-file-bytes. Lists in environment variables are separated by "+
+			string(os.PathListSeparator)+".")
+		fs.PrintDefaults()
+	}
+	return fs, rwRoots
+}
+
+// envName returns the environment variable corresponding to a flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadConfig builds the effective configuration from args, the environment and the configuration file.
+// It also reports whether the configuration should be printed instead of served.
+func loadConfig(args []string) (Config, bool, error) {
+	// Find the configuration file first, as it has the lowest priority
+	var probe Config
+	probeFlags, _ := newFlagSet(&probe)
+	probeFlags.SetOutput(os.Stderr)
+	if err := probeFlags.Parse(args); err != nil {
+		return Config{}, false, err
+	}
+	configPath := probeFlags.Lookup("config").Value.String()
+	if configPath == "" {
+		configPath = os.Getenv(envName("config"))
+	}
+
+	cfg := defaultConfig()
+	if configPath != "" {
+		if err := readConfigFile(configPath, &cfg); err != nil {
+			return Config{}, false, fmt.Errorf("config file %s: %w", configPath, err)
+		}
+	}
+
+	// Environment variables override the file
+	envFlags, _ := newFlagSet(&cfg)
+	var err error
+	envFlags.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		values := []string{value}
+		if isListFlag(f) {
+			values = filepath.SplitList(value)
+		}
+		for _, v := range values {
+			if setErr := envFlags.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("environment variable %s: %w", envName(f.Name), setErr)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return Config{}, false, err
+	}
+
+	// Command line flags override everything, and positional arguments are read-write roots
+	cmdFlags, rwRoots := newFlagSet(&cfg)
+	cmdFlags.SetOutput(os.Stderr)
+	if err := cmdFlags.Parse(args); err != nil {
+		return Config{}, false, err
+	}
+	for _, dir := range cmdFlags.Args() {
+		if err := rwRoots.Set(dir); err != nil {
+			return Config{}, false, err
+		}
+	}
+	printConfig := cmdFlags.Lookup("print-config").Value.String() == "true" ||
+		os.Getenv(envName("print-config")) == "true"
+
+	if err := cfg.normalize(); err != nil {
+		return Config{}, false, err
+	}
+	return cfg, printConfig, nil
+}
+
+// isListFlag reports whether a flag accepts several values.
+func isListFlag(f *flag.Flag) bool {
+	switch f.Value.(type) {
+	case *stringList, *intList, *rootList:
+		return true
+	}
+	return false
+}
+
+// readConfigFile decodes a configuration file over cfg, choosing the format from the extension.
+// YAML and TOML are converted to JSON first, so that all formats share the same keys and validation.
+func readConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var raw interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		raw = json.RawMessage(data)
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+	case ".toml":
+		var m map[string]interface{}
+		if err := toml.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		raw = m
+	default:
+		return errors.New("unknown format, expected a .yaml, .yml, .json or .toml extension")
+	}
+	jsonData, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(cfg)
+}
+
+// normalize resolves root paths and validates the configuration.
+func (c *Config) normalize() error {
+	var errs []error
+	for i, root := range c.Roots {
+		if root.Mode == "" {
+			root.Mode = ModeReadWrite
+		}
+		if root.Mode != ModeReadWrite && root.Mode != ModeReadOnly {
+			errs = append(errs, fmt.Errorf("root %s: mode must be %q or %q", root.Path, ModeReadWrite, ModeReadOnly))
+		}
+		absPath, err := filepath.Abs(top.ExpandHome(root.Path))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("root %s: %w", root.Path, err))
+		} else if info, err := os.Stat(absPath); err != nil {
+			errs = append(errs, fmt.Errorf("root %s: %w", root.Path, err))
+		} else if !info.IsDir() && !top.IsArchive(absPath) {
+			errs = append(errs, fmt.Errorf("root %s: not a directory or archive", root.Path))
+		} else if !info.IsDir() {
+			// Archives are served read-only
+			root.Mode = ModeReadOnly
+		}
+		if root.QuotaBytes < 0 || root.QuotaFiles < 0 {
+			errs = append(errs, fmt.Errorf("root %s: quotas must not be negative", root.Path))
+		}
+		root.Path = absPath
+		c.Roots[i] = root
+	}
+	if _, err := top.NewPolicy(nil, c.Deny); err != nil {
+		errs = append(errs, err)
+	}
+	known := map[string]bool{}
+	for _, t := range top.Tools {
+		known[t.Tool.Name] = true
+	}
+	for _, name := range c.Tools {
+		if !known[name] {
+			errs = append(errs, fmt.Errorf("unknown tool %q", name))
+		}
+	}
+	if c.MaxFileBytes < 0 || c.MaxResponseBytes < 0 || c.MaxWalkEntries < 0 || c.CallTimeout < 0 || c.OverlayBytes < 0 || c.ArchiveBytes < 0 {
+		errs = append(errs, errors.New("limits must not be negative"))
+	}
+	if c.QuotaBytes < 0 || c.QuotaFiles < 0 {
+		errs = append(errs, errors.New("quotas must not be negative"))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("log level %q: must be debug, info, warn or error", c.LogLevel))
+	}
+	if c.LogFormat != LogFormatText && c.LogFormat != LogFormatJSON {
+		errs = append(errs, fmt.Errorf("log format %q: must be %q or %q", c.LogFormat, LogFormatText, LogFormatJSON))
+	}
+	switch c.Transport {
+	case TransportStdio:
+	case TransportSSE, TransportHTTP:
+		if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+			errs = append(errs, fmt.Errorf("listen address %q: %w", c.Listen, err))
+		}
+	case TransportUnix:
+		if c.Socket == "" {
+			errs = append(errs, errors.New("the unix transport needs a socket path"))
+		} else if socket, err := filepath.Abs(top.ExpandHome(c.Socket)); err == nil {
+			c.Socket = socket
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown transport %q", c.Transport))
+	}
+	if c.MetricsAddr != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsAddr); err != nil {
+			errs = append(errs, fmt.Errorf("metrics address %q: %w", c.MetricsAddr, err))
+		}
+	}
+	if c.OTLPEndpoint != "" {
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("OTLP endpoint %q: must be an http or https URL", c.OTLPEndpoint))
+		}
+	}
+	if c.PromptsDir != "" {
+		if dir, err := filepath.Abs(top.ExpandHome(c.PromptsDir)); err == nil {
+			c.PromptsDir = dir
+		}
+	}
+	for _, uid := range c.AllowUIDs {
+		if uid < 0 {
+			errs = append(errs, fmt.Errorf("invalid user ID %d", uid))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// rootPaths returns the paths of the directories among the roots with the given mode, leaving out
+// archives, which are opened before the process is sandboxed.
+func (c *Config) rootPaths(mode string) []string {
+	var paths []string
+	for _, root := range c.Roots {
+		if info, err := os.Stat(root.Path); err == nil && !info.IsDir() {
+			continue
+		}
+		if root.Mode == mode {
+			paths = append(paths, root.Path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	configDir := t.TempDir()
+	writeConfig := func(name, content string) string {
+		path := filepath.Join(configDir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		return path
+	}
+
+	t.Run("Formats decode to the same configuration", func(t *testing.T) {
+		files := []string{
+			writeConfig("c.yaml", "roots:\n  - path: "+dirA+"\n    mode: ro\ncall-timeout: 30s\ndeny: ['*.key']\n"),
+			writeConfig("c.json", `{"roots": [{"path": "`+dirA+`", "mode": "ro"}], "call-timeout": "30s", "deny": ["*.key"]}`),
+			writeConfig("c.toml", "call-timeout = \"30s\"\ndeny = [\"*.key\"]\n[[roots]]\npath = \""+dirA+"\"\nmode = \"ro\"\n"),
+		}
+		for _, file := range files {
+			cfg, _, err := loadConfig([]string{"--config", file})
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", file, err)
+			}
+			if len(cfg.Roots) != 1 || cfg.Roots[0].Path != dirA || cfg.Roots[0].Mode != ModeReadOnly ||
+				time.Duration(cfg.CallTimeout) != 30*time.Second || len(cfg.Deny) != 1 {
+				t.Errorf("%s: unexpected configuration: %+v", file, cfg)
+			}
+		}
+	})
+
+	t.Run("Flags override environment which overrides file", func(t *testing.T) {
+		file := writeConfig("p.yaml", "max-file-bytes: 1\nmax-walk-entries: 1\nquota-files: 1\nroots:\n  - path: "+dirA+"\n")
+		t.Setenv("MCP_FS_MAX_WALK_ENTRIES", "2")
+		t.Setenv("MCP_FS_QUOTA_FILES", "2")
+		cfg, _, err := loadConfig([]string{"--config", file, "--quota-files", "3"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if cfg.MaxFileBytes != 1 || cfg.MaxWalkEntries != 2 || cfg.QuotaFiles != 3 {
+			t.Errorf("Unexpected configuration: %+v", cfg)
+		}
+		if len(cfg.Roots) != 1 || cfg.Roots[0].Path != dirA || cfg.Roots[0].Mode != ModeReadWrite {
+			t.Errorf("Unexpected roots: %+v", cfg.Roots)
+		}
+	})
+
+	t.Run("Command line roots replace configured roots", func(t *testing.T) {
+		file := writeConfig("r.yaml", "roots:\n  - path: "+dirA+"\n")
+		cfg, _, err := loadConfig([]string{"--config", file, "--ro", dirA, dirB})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(cfg.Roots) != 2 || cfg.Roots[0].Mode != ModeReadOnly || cfg.Roots[1].Path != dirB ||
+			cfg.Roots[1].Mode != ModeReadWrite {
+			t.Errorf("Unexpected roots: %+v", cfg.Roots)
+		}
+	})
+
+	t.Run("Environment lists are split", func(t *testing.T) {
+		t.Setenv("MCP_FS_ROOT", dirA+string(os.PathListSeparator)+dirB)
+		cfg, _, err := loadConfig(nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(cfg.Roots) != 2 {
+			t.Errorf("Unexpected roots: %+v", cfg.Roots)
+		}
+	})
+
+	t.Run("Invalid settings are all reported", func(t *testing.T) {
+		file := writeConfig("bad.yaml", "roots:\n  - path: "+dirA+"\n    mode: rx\ntool: []\n")
+		_, _, err := loadConfig([]string{"--config", file})
+		if err == nil || !strings.Contains(err.Error(), `unknown field "tool"`) {
+			t.Errorf("Expected unknown field error, got: %v", err)
+		}
+		_, _, err = loadConfig([]string{"--tool", "nope", "--transport", "carrier-pigeon", "--max-file-bytes", "-1",
+			filepath.Join(dirA, "missing")})
+		for _, expected := range []string{"unknown tool", "unknown transport", "limits", "no such file"} {
+			if err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("Expected error containing %q, got: %v", expected, err)
+			}
+		}
+	})
+
+	t.Run("Network transports need an address", func(t *testing.T) {
+		_, _, err := loadConfig([]string{"--transport", "http", "--listen", "8080"})
+		if err == nil || !strings.Contains(err.Error(), "listen address") {
+			t.Errorf("Expected listen address error, got: %v", err)
+		}
+		if _, _, err := loadConfig([]string{"--transport", "sse", "--listen", ":8080"}); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if _, _, err := loadConfig([]string{"--metrics-addr", "9090"}); err == nil || !strings.Contains(err.Error(), "metrics address") {
+			t.Errorf("Expected metrics address error, got: %v", err)
+		}
+		if _, _, err := loadConfig([]string{"--otlp-endpoint", "localhost:4318"}); err == nil || !strings.Contains(err.Error(), "OTLP endpoint") {
+			t.Errorf("Expected OTLP endpoint error, got: %v", err)
+		}
+		_, _, err = loadConfig([]string{"--transport", "unix", "--allow-uid", "-1"})
+		for _, expected := range []string{"socket path", "invalid user ID"} {
+			if err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("Expected error containing %q, got: %v", expected, err)
+			}
+		}
+		t.Setenv("MCP_FS_ALLOW_UID", "1000"+string(os.PathListSeparator)+"1001")
+		cfg, _, err := loadConfig([]string{"--transport", "unix", "--socket", "mcp.sock"})
+		if err != nil || len(cfg.AllowUIDs) != 2 || !filepath.IsAbs(cfg.Socket) {
+			t.Errorf("Unexpected configuration: %+v, %v", cfg, err)
+		}
+	})
+
+	t.Run("Print config", func(t *testing.T) {
+		_, printConfig, err := loadConfig([]string{"--print-config", dirA})
+		if err != nil || !printConfig {
+			t.Errorf("Expected print-config, got %v, %v", printConfig, err)
+		}
+	})
+}
@@ -6,49 +6,186 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"github.com/mark3labs/mcp-go/mcp"
-	"github.com/mark3labs/mcp-go/server"
 	top "github.com/optistar/mcp-server-filesystem"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"io"
+	"log/slog"
+	"net"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// serverVersion is the version of the server reported to clients and in traces.
+const serverVersion = "0.2.0"
+
 func main() {
-	// Check command line arguments
-	if len(os.Args) < 1 {
-		fmt.Println("Usage: mcp-server-filesystem [<allowed-directory> ...]")
+	cfg, printConfig, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if printConfig {
+		if cfg.AuthToken != "" {
+			cfg.AuthToken = "[redacted]"
+		}
+		data, _ := json.MarshalIndent(cfg, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	// Exit only once run has closed everything it opened
+	if err := run(cfg); err != nil {
 		os.Exit(1)
 	}
+}
+
+// run serves as configured until the server stops. It returns an error, already reported, if the
+// server could not start or failed.
+func run(cfg Config) error {
+	// Diagnostics go to standard error unless redirected, never to the protocol stream
+	logOutput := os.Stderr
+	if cfg.LogFile != "" {
+		logFile, err := os.OpenFile(cfg.LogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening log file %s: %v\n", cfg.LogFile, err)
+			return err
+		}
+		defer logFile.Close()
+		logOutput = logFile
+	}
+	slog.SetDefault(newLogger(cfg, logOutput))
+
+	// Open the audit log, if requested
+	var middlewares []tester.Middleware
+	if cfg.AuditLog != "" {
+		auditLog, err := top.OpenAuditLog(cfg.AuditLog)
+		if err != nil {
+			return fatal("Error opening audit log", "path", cfg.AuditLog, "error", err)
+		}
+		defer auditLog.Close()
+		middlewares = append(middlewares, auditLog.Wrap)
+	}
+
+	// Collect metrics and export traces, if requested; observation comes first, so that it covers the whole call
+	options := []top.Option{top.WithServerInfo("secure-filesystem-server", serverVersion)}
+	if cfg.OTLPEndpoint != "" {
+		tracerProvider, err := top.NewOTLPTracerProvider(context.Background(), cfg.OTLPEndpoint, serverVersion)
+		if err != nil {
+			return fatal("Error creating trace exporter", "endpoint", cfg.OTLPEndpoint, "error", err)
+		}
+		defer func() {
+			// Export the spans still buffered
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tracerProvider.Shutdown(ctx); err != nil {
+				slog.Warn("Error exporting traces", "error", err)
+			}
+		}()
+		options = append(options, top.WithMiddleware(top.NewTracing(tracerProvider).Wrap))
+	}
+	var metrics *top.Metrics
+	if cfg.MetricsAddr != "" {
+		metrics = top.NewMetrics()
+		options = append(options, top.WithMetrics(metrics))
+	}
 
-	// Normalize allowed directories
-	allowedDirectories := make([]string, 0, len(os.Args)-1)
-	for _, dir := range os.Args[1:] {
-		absPath, err := filepath.Abs(top.ExpandHome(dir))
+	// Load the prompt templates, which may replace the built-in prompts
+	if cfg.PromptsDir != "" {
+		templates, err := top.LoadPromptTemplates(cfg.PromptsDir)
 		if err != nil {
-			fmt.Printf("Error resolving path %s: %v\n", dir, err)
-			os.Exit(1)
+			return fatal("Error loading prompts", "error", err)
 		}
-		allowedDirectories = append(allowedDirectories, absPath)
+		options = append(options, top.WithPrompts(templates...))
 	}
 
-	// Create MCP server
-	s := server.NewMCPServer(
-		"secure-filesystem-server",
-		"0.2.0",
+	// Create the server, restricted as configured
+	for _, root := range cfg.Roots {
+		options = append(options, top.WithRoots(top.Root{
+			Path:     root.Path,
+			ReadOnly: root.Mode == ModeReadOnly,
+			Quota:    top.Quota{MaxBytes: root.QuotaBytes, MaxFiles: root.QuotaFiles},
+		}))
+	}
+	options = append(options,
+		top.WithMiddleware(middlewares...),
+		top.WithDeny(cfg.Deny...),
+		top.WithTools(cfg.Tools...),
+		top.WithCallLimits(top.Limits{
+			MaxFileBytes:     cfg.MaxFileBytes,
+			MaxResponseBytes: cfg.MaxResponseBytes,
+			MaxWalkEntries:   cfg.MaxWalkEntries,
+			CallTimeout:      time.Duration(cfg.CallTimeout),
+		}),
+		top.WithQuota(top.Quota{MaxBytes: cfg.QuotaBytes, MaxFiles: cfg.QuotaFiles}),
+		top.WithArchiveBytes(cfg.ArchiveBytes),
 	)
+	if cfg.Overlay {
+		options = append(options, top.WithOverlay(cfg.OverlayBytes))
+	}
+	s, err := top.NewServer(options...)
+	if err != nil {
+		return fatal("Error creating server", "error", err)
+	}
+	defer s.Close()
 
-	// Register tools with handlers
-	for _, t := range top.Tools {
-		handler := t.Handler // Capture in closure
-		s.AddTool(t.Tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			return handler(ctx, req, allowedDirectories)
-		})
+	// Open the listener before the sandbox is in place
+	listener, err := listen(cfg)
+	if err != nil {
+		return fatal("Error listening", "address", cfg.Listen, "error", err)
+	}
+	var metricsListener net.Listener
+	if metrics != nil {
+		metricsListener, err = net.Listen("tcp", cfg.MetricsAddr)
+		if err != nil {
+			return fatal("Error listening for metrics", "address", cfg.MetricsAddr, "error", err)
+		}
 	}
 
-	// Start the server
-	if err := server.ServeStdio(s); err != nil {
-		fmt.Printf("Server error: %v\n", err)
-		os.Exit(1)
+	// Sandbox the process itself, now that every file it needs is open
+	if cfg.Landlock {
+		abi, err := top.Landlock(cfg.rootPaths(ModeReadWrite), cfg.rootPaths(ModeReadOnly), cfg.OTLPEndpoint != "")
+		if errors.Is(err, top.ErrLandlockUnavailable) {
+			slog.Warn("Continuing without sandbox", "error", err)
+		} else if err != nil {
+			return fatal("Error enabling Landlock", "error", err)
+		} else if abi < 5 {
+			slog.Warn("Landlock only partially restricts the process", "abi", abi)
+		}
 	}
+
+	// Start the server, stopping gracefully on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if metrics != nil {
+		go serveMetrics(ctx, metrics, metricsListener)
+	}
+	if err := serve(ctx, s.MCPServer, cfg, listener); err != nil {
+		return fatal("Server error", "error", err)
+	}
+	return nil
+}
+
+// newLogger creates the logger of diagnostics, writing to w in the configured format from the configured level.
+func newLogger(cfg Config, w io.Writer) *slog.Logger {
+	var level slog.Level
+	// The level was validated with the configuration
+	_ = level.UnmarshalText([]byte(cfg.LogLevel))
+	options := &slog.HandlerOptions{Level: level}
+	if cfg.LogFormat == LogFormatJSON {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// fatal logs an error that prevents the server from running, and returns it for run to return.
+func fatal(msg string, args ...any) error {
+	slog.Error(msg, args...)
+	return errors.New(msg)
 }
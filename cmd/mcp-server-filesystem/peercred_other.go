@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// peerUID is only implemented on Linux, where SO_PEERCRED is available.
+func peerUID(*net.UnixConn) (int, error) {
+	return 0, errors.New("peer credentials are not supported on this platform")
+}
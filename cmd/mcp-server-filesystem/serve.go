@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/mark3labs/mcp-go/server"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// shutdownTimeout bounds how long in-flight requests are given to complete on shutdown.
+	shutdownTimeout = 10 * time.Second
+	// sessionIdleTTL is how long an idle Streamable HTTP session is kept before it is dropped.
+	sessionIdleTTL = time.Hour
+)
+
+// listen opens the listener of the configured transport, or returns nil for stdio.
+// It is opened before the process is sandboxed.
+func listen(cfg Config) (net.Listener, error) {
+	switch cfg.Transport {
+	case TransportStdio:
+		return nil, nil
+	case TransportUnix:
+		return listenUnix(cfg.Socket, cfg.AllowUIDs)
+	}
+	if cfg.AuthToken == "" {
+		slog.Warn("No auth token set, any client that can reach the address has access", "address", cfg.Listen)
+	}
+	return net.Listen("tcp", cfg.Listen)
+}
+
+// listenUnix listens on a Unix socket at path, accepting connections only from processes
+// running as one of allowedUIDs, or as the server's own user if there are none.
+// A socket left behind by a server that is no longer running is replaced.
+func listenUnix(path string, allowedUIDs []int) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another server is listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	allowed := map[int]bool{}
+	for _, uid := range allowedUIDs {
+		allowed[uid] = true
+	}
+	mode := os.FileMode(0666)
+	if len(allowed) == 0 {
+		allowed[os.Getuid()] = true
+		mode = 0600
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &peerCredListener{Listener: listener, allowed: allowed}, nil
+}
+
+// peerCredListener drops connections from processes whose user ID is not allowed.
+type peerCredListener struct {
+	net.Listener
+	allowed map[int]bool
+}
+
+func (l *peerCredListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		uid, err := peerUID(conn.(*net.UnixConn))
+		if err != nil {
+			slog.Warn("Rejected connection", "error", err)
+			conn.Close()
+			continue
+		}
+		if !l.allowed[uid] {
+			slog.Warn("Rejected connection", "uid", uid)
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+// serve runs s on the configured transport until the transport fails or ctx is done,
+// in which case in-flight requests are given time to complete.
+func serve(ctx context.Context, s *server.MCPServer, cfg Config, listener net.Listener) error {
+	if cfg.Transport == TransportStdio {
+		err := server.NewStdioServer(s).Listen(ctx, os.Stdin, os.Stdout)
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	httpServer := &http.Server{ReadHeaderTimeout: 10 * time.Second}
+	var shutdown func(context.Context) error
+	switch cfg.Transport {
+	case TransportSSE:
+		sseServer := server.NewSSEServer(s, server.WithHTTPServer(httpServer))
+		httpServer.Handler = bearerAuth(cfg.AuthToken, sseServer)
+		shutdown = sseServer.Shutdown
+	case TransportHTTP, TransportUnix:
+		// Sessions are tracked so that each has its own allowed directories and quota usage
+		httpTransport := server.NewStreamableHTTPServer(s,
+			server.WithStreamableHTTPServer(httpServer),
+			server.WithStateful(true),
+			server.WithSessionIdleTTL(sessionIdleTTL))
+		mux := http.NewServeMux()
+		mux.Handle("/mcp", httpTransport)
+		httpServer.Handler = bearerAuth(cfg.AuthToken, mux)
+		shutdown = httpTransport.Shutdown
+	}
+
+	slog.Info("Serving", "transport", cfg.Transport, "address", listener.Addr().String())
+	served := make(chan error, 1)
+	go func() {
+		served <- httpServer.Serve(listener)
+	}()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// serveMetrics serves metrics at /metrics on listener until ctx is done. Failures are logged, as the
+// server is still useful without metrics.
+func serveMetrics(ctx context.Context, metrics http.Handler, listener net.Listener) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	metricsServer := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		metricsServer.Close()
+	}()
+	slog.Info("Serving metrics", "address", listener.Addr().String())
+	if err := metricsServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Error serving metrics", "error", err)
+	}
+}
+
+// bearerAuth rejects requests that do not carry token as a bearer token. An empty token allows all requests.
+func bearerAuth(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp-server-filesystem"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
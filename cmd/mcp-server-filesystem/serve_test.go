@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestServeHTTP(t *testing.T) {
+	for _, transportName := range []string{TransportHTTP, TransportSSE} {
+		t.Run(transportName, func(t *testing.T) {
+			s := server.NewMCPServer("test", "1.0", server.WithToolCapabilities(false))
+			s.AddTool(mcp.NewTool("ping"), func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				return mcp.NewToolResultText("pong"), nil
+			})
+			cfg := defaultConfig()
+			cfg.Transport = transportName
+			cfg.Listen = "127.0.0.1:0"
+			cfg.AuthToken = "secret"
+			listener, err := listen(cfg)
+			if err != nil {
+				t.Fatalf("Failed to listen: %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			served := make(chan error, 1)
+			go func() {
+				served <- serve(ctx, s, cfg, listener)
+			}()
+
+			base := "http://" + listener.Addr().String()
+			endpoint := base + "/mcp"
+			if transportName == TransportSSE {
+				endpoint = base + "/sse"
+			}
+			resp, err := http.Post(endpoint, "application/json", nil)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("Expected 401 without token, got %d", resp.StatusCode)
+			}
+
+			headers := map[string]string{"Authorization": "Bearer secret"}
+			var c *client.Client
+			if transportName == TransportSSE {
+				c, err = client.NewSSEMCPClient(endpoint, transport.WithHeaders(headers))
+			} else {
+				c, err = client.NewStreamableHttpClient(endpoint, transport.WithHTTPHeaders(headers))
+			}
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+			if err := c.Start(ctx); err != nil {
+				t.Fatalf("Failed to start client: %v", err)
+			}
+			initRequest := mcp.InitializeRequest{}
+			initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+			if _, err := c.Initialize(ctx, initRequest); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+			req := mcp.CallToolRequest{}
+			req.Params.Name = "ping"
+			result, err := c.CallTool(ctx, req)
+			if err != nil || result.Content[0].(mcp.TextContent).Text != "pong" {
+				t.Errorf("Unexpected result: %v, %v", result, err)
+			}
+			_ = c.Close()
+
+			cancel()
+			select {
+			case err := <-served:
+				if err != nil {
+					t.Errorf("Unexpected error on shutdown: %v", err)
+				}
+			case <-time.After(shutdownTimeout):
+				t.Fatalf("Server did not shut down")
+			}
+			if conn, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+				conn.Close()
+				t.Errorf("Server still accepts connections after shutdown")
+			}
+		})
+	}
+}
+
+func TestServeUnix(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only supported on Linux")
+	}
+	s := server.NewMCPServer("test", "1.0", server.WithToolCapabilities(false))
+	s.AddTool(mcp.NewTool("ping"), func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("pong"), nil
+	})
+	socket := filepath.Join(t.TempDir(), "mcp.sock")
+	connect := func(t *testing.T) error {
+		t.Helper()
+		httpClient := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		}}
+		c, err := client.NewStreamableHttpClient("http://localhost/mcp", transport.WithHTTPBasicClient(httpClient))
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+		defer c.Close()
+		initRequest := mcp.InitializeRequest{}
+		initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+		if _, err := c.Initialize(context.Background(), initRequest); err != nil {
+			return err
+		}
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "ping"
+		_, err = c.CallTool(context.Background(), req)
+		return err
+	}
+	run := func(t *testing.T, allowedUIDs []int, check func(t *testing.T)) {
+		t.Helper()
+		cfg := defaultConfig()
+		cfg.Transport = TransportUnix
+		cfg.Socket = socket
+		cfg.AllowUIDs = allowedUIDs
+		listener, err := listen(cfg)
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		served := make(chan error, 1)
+		go func() {
+			served <- serve(ctx, s, cfg, listener)
+		}()
+		check(t)
+		cancel()
+		if err := <-served; err != nil {
+			t.Errorf("Unexpected error on shutdown: %v", err)
+		}
+	}
+
+	t.Run("Own user is accepted", func(t *testing.T) {
+		run(t, nil, func(t *testing.T) {
+			if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0600 {
+				t.Errorf("Expected socket with mode 0600, got %v, %v", info, err)
+			}
+			if err := connect(t); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if _, err := listen(Config{Transport: TransportUnix, Socket: socket}); err == nil {
+				t.Errorf("Expected error listening on a socket in use")
+			}
+		})
+	})
+
+	t.Run("Other users are rejected", func(t *testing.T) {
+		run(t, []int{os.Getuid() + 1}, func(t *testing.T) {
+			if err := connect(t); err == nil {
+				t.Errorf("Expected connection to be rejected")
+			}
+		})
+	})
+
+	t.Run("Stale socket is replaced", func(t *testing.T) {
+		listener, err := net.Listen("unix", socket)
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		listener.(*net.UnixListener).SetUnlinkOnClose(false)
+		listener.Close()
+		run(t, []int{os.Getuid()}, func(t *testing.T) {
+			if err := connect(t); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	})
+}
@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"github.com/fatih/color"
 	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/optistar/mcp-server-filesystem/tester"
 	"log"
+	"net/url"
 	"os"
+	"path/filepath"
 )
 
 type ToolTestFunc func(t tester.T, f tester.MCPClientFactory)
@@ -25,6 +28,20 @@ var toolTestMap = map[string]ToolTestFunc{
 	"search_files":             tester.TestSearchFiles,
 	"get_file_info":            tester.TestGetFileInfo,
 	"list_allowed_directories": tester.TestListAllowedDirectories,
+	"get_quota":                tester.TestGetQuota,
+	"watch_directory":          tester.TestWatchDirectory,
+}
+
+// staticRoots exposes a fixed list of directories as the roots of the client.
+type staticRoots []string
+
+func (r staticRoots) ListRoots(context.Context, mcp.ListRootsRequest) (*mcp.ListRootsResult, error) {
+	result := &mcp.ListRootsResult{Roots: []mcp.Root{}}
+	for _, dir := range r {
+		uri := url.URL{Scheme: "file", Path: filepath.ToSlash(dir)}
+		result.Roots = append(result.Roots, mcp.Root{URI: uri.String(), Name: filepath.Base(dir)})
+	}
+	return result, nil
 }
 
 func main() {
@@ -44,8 +61,9 @@ func main() {
 		// which expects allowed directories as arguments.
 		cmd := os.Args[1]
 		env := os.Environ()
-		cli, err := client.NewStdioMCPClient(cmd, env, args...)
-		if err != nil {
+		// Expose the allowed directories as roots too, for servers that follow them
+		cli := client.NewClient(transport.NewStdio(cmd, env, args...), client.WithRootsHandler(staticRoots(args)))
+		if err := cli.Start(ctx); err != nil {
 			log.Fatalf("Failed to create client: %v", err)
 		}
 		initRequest := mcp.InitializeRequest{}
@@ -0,0 +1,138 @@
+package top
+
+import (
+	"context"
+	"errors"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// maxCompletions is the number of values returned by each completion/complete call, the most the protocol allows.
+const maxCompletions = 100
+
+// PathCompleter is invoked like a tool, so that it can be wrapped the same way as the resource handlers.
+// It takes a "value" argument, a partly typed path, and returns a mcp.Completion as structured content.
+var PathCompleter = tester.ToolHandler{Tool: mcp.Tool{Name: "completion/complete"}, Handler: CompletePathHandler}
+
+// CompletePath runs completer, typically a wrapped PathCompleter, to complete the partly typed path value.
+func CompletePath(ctx context.Context, completer tester.ToolHandler, value string, allowedDirs []string) (*mcp.Completion, error) {
+	req := mcp.CallToolRequest{}
+	req.Params.Name = completer.Tool.Name
+	req.Params.Arguments = map[string]interface{}{"value": value}
+	result, err := callResourceHandler(ctx, completer, req, allowedDirs)
+	if err != nil {
+		return nil, err
+	}
+	completion, ok := result.StructuredContent.(mcp.Completion)
+	if !ok {
+		return nil, errors.New("unexpected completion result")
+	}
+	return &completion, nil
+}
+
+// completionArgs are the arguments of PathCompleter.
+type completionArgs struct {
+	Value string `arg:"value,required"`
+}
+
+// CompletePathHandler suggests the allowed directories starting with the value, and the entries of the
+// directory named by the value up to its last separator whose names start with the rest of the value.
+// Directories end with a separator, so that their entries are suggested next. Hidden entries are only
+// suggested once their leading dot is typed.
+func CompletePathHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[completionArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	value := args.Value
+	var values []string
+	seen := map[string]bool{}
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			values = append(values, path)
+		}
+	}
+	for _, dir := range allowedDirs {
+		if strings.HasPrefix(dir, value) {
+			add(strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator))
+		}
+	}
+	if i := strings.LastIndex(value, string(filepath.Separator)); i >= 0 {
+		dir, prefix := value[:i+1], value[i+1:]
+		// Directories that are outside the allowed ones or unreadable have nothing more to suggest
+		if validDir, err := validatePath(ctx, dir, allowedDirs); err == nil {
+			entries, _ := backendFromContext(ctx).ReadDir(validDir)
+			for _, entry := range entries {
+				name := entry.Name()
+				if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+					continue
+				}
+				if isDeniedEntry(ctx, filepath.Join(validDir, name), pathInfo{name: name, dir: entry.IsDir()}) {
+					continue
+				}
+				if entry.IsDir() {
+					name += string(filepath.Separator)
+				}
+				add(dir + name)
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	completion := mcp.Completion{Values: values, Total: len(values)}
+	if len(values) > maxCompletions {
+		completion.Values = values[:maxCompletions]
+		completion.HasMore = true
+	}
+	if completion.Values == nil {
+		completion.Values = []string{}
+	}
+	return mcp.NewToolResultStructured(completion, strings.Join(completion.Values, "\n")), nil
+}
+
+// Completions completes the path of the file resource template and the path arguments of prompts,
+// implementing server.ResourceCompletionProvider and server.PromptCompletionProvider.
+type Completions struct {
+	completer   tester.ToolHandler
+	allowedDirs []string
+
+	mu sync.Mutex
+	// promptPaths maps the name of each prompt to its path arguments.
+	promptPaths map[string][]string
+}
+
+// NewCompletions creates the completions of paths in allowedDirs, found by completer, typically a wrapped PathCompleter.
+func NewCompletions(completer tester.ToolHandler, allowedDirs []string) *Completions {
+	return &Completions{completer: completer, allowedDirs: allowedDirs, promptPaths: map[string][]string{}}
+}
+
+// AddPathArgument declares that argument of prompt is a path, to be completed like the file resource template.
+func (c *Completions) AddPathArgument(prompt, argument string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.promptPaths[prompt] = append(c.promptPaths[prompt], argument)
+}
+
+func (c *Completions) CompleteResourceArgument(ctx context.Context, uri string, argument mcp.CompleteArgument, _ mcp.CompleteContext) (*mcp.Completion, error) {
+	if uri != fileURITemplate || argument.Name != "path" {
+		return &mcp.Completion{Values: []string{}}, nil
+	}
+	return CompletePath(ctx, c.completer, argument.Value, c.allowedDirs)
+}
+
+func (c *Completions) CompletePromptArgument(ctx context.Context, prompt string, argument mcp.CompleteArgument, _ mcp.CompleteContext) (*mcp.Completion, error) {
+	c.mu.Lock()
+	isPath := slices.Contains(c.promptPaths[prompt], argument.Name)
+	c.mu.Unlock()
+	if !isPath {
+		return &mcp.Completion{Values: []string{}}, nil
+	}
+	return CompletePath(ctx, c.completer, argument.Value, c.allowedDirs)
+}
@@ -0,0 +1,109 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCompletions(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{"docs", "data", "secrets", ".git", "many"} {
+		if err := os.Mkdir(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	for _, file := range []string{"docs/readme.md", "docs/notes.txt", "draft.txt", ".env"} {
+		if err := os.WriteFile(filepath.Join(tempDir, file), []byte("content"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	for i := 0; i < maxCompletions+20; i++ {
+		if err := os.WriteFile(filepath.Join(tempDir, "many", fmt.Sprintf("file%03d", i)), nil, 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	policy, err := NewPolicy(nil, []string{"secrets/"})
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	completions := NewCompletions(policy.Wrap(PathCompleter), []string{tempDir})
+	completions.AddPathArgument("summarize", "path")
+	sep := string(filepath.Separator)
+	complete := func(t *testing.T, value string) *mcp.Completion {
+		t.Helper()
+		completion, err := completions.CompleteResourceArgument(context.Background(), fileURITemplate,
+			mcp.CompleteArgument{Name: "path", Value: value}, mcp.CompleteContext{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return completion
+	}
+
+	testCases := []struct {
+		name     string
+		value    string
+		expected []string
+	}{
+		{"Empty value suggests the allowed directories", "", []string{tempDir + sep}},
+		{"Allowed directory is completed", tempDir[:len(tempDir)-2], []string{tempDir + sep}},
+		{"Entries are completed", filepath.Join(tempDir, "d"), []string{
+			filepath.Join(tempDir, "data") + sep, filepath.Join(tempDir, "docs") + sep, filepath.Join(tempDir, "draft.txt")}},
+		{"Directory entries are listed", filepath.Join(tempDir, "docs") + sep, []string{
+			filepath.Join(tempDir, "docs", "notes.txt"), filepath.Join(tempDir, "docs", "readme.md")}},
+		{"Hidden entries need a dot", tempDir + sep + ".", []string{
+			filepath.Join(tempDir, ".env"), filepath.Join(tempDir, ".git") + sep}},
+		{"Denied entries are not suggested", filepath.Join(tempDir, "s"), []string{}},
+		{"Paths outside allowed directories are not completed", filepath.Join(t.TempDir(), "x"), []string{}},
+		{"Files have no entries", filepath.Join(tempDir, "draft.txt") + sep, []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			completion := complete(t, tc.value)
+			if !slices.Equal(completion.Values, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, completion.Values)
+			}
+		})
+	}
+
+	t.Run("Completions are limited", func(t *testing.T) {
+		completion := complete(t, filepath.Join(tempDir, "many", "file"))
+		if len(completion.Values) != maxCompletions || !completion.HasMore || completion.Total != maxCompletions+20 {
+			t.Errorf("Expected %d of %d values, got %d of %d", maxCompletions, maxCompletions+20, len(completion.Values), completion.Total)
+		}
+	})
+
+	t.Run("Only path arguments are completed", func(t *testing.T) {
+		argument := mcp.CompleteArgument{Name: "path", Value: tempDir + sep + "dr"}
+		completion, err := completions.CompletePromptArgument(context.Background(), "summarize", argument, mcp.CompleteContext{})
+		if err != nil || !slices.Equal(completion.Values, []string{filepath.Join(tempDir, "draft.txt")}) {
+			t.Errorf("Expected prompt path to be completed, got %v, %v", completion, err)
+		}
+		argument.Name = "style"
+		completion, err = completions.CompletePromptArgument(context.Background(), "summarize", argument, mcp.CompleteContext{})
+		if err != nil || len(completion.Values) != 0 {
+			t.Errorf("Expected no completions for other arguments, got %v, %v", completion, err)
+		}
+		completion, err = completions.CompleteResourceArgument(context.Background(), "other://{x}",
+			mcp.CompleteArgument{Name: "x", Value: tempDir}, mcp.CompleteContext{})
+		if err != nil || len(completion.Values) != 0 {
+			t.Errorf("Expected no completions for other templates, got %v, %v", completion, err)
+		}
+	})
+
+	t.Run("Invalid arguments fail", func(t *testing.T) {
+		if _, err := CompletePath(context.Background(), tester.ToolHandler{Handler: CompletePathHandler}, "", nil); err != nil {
+			t.Errorf("Unexpected error without allowed directories: %v", err)
+		}
+		req := mcp.CallToolRequest{}
+		result, _ := CompletePathHandler(context.Background(), req, []string{tempDir})
+		if !result.IsError {
+			t.Errorf("Expected error without a value")
+		}
+	})
+}
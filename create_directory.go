@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/mark3labs/mcp-go/mcp"
-	"os"
 )
 
 func DefineCreateDirectoryTool() mcp.Tool {
@@ -14,21 +13,46 @@ func DefineCreateDirectoryTool() mcp.Tool {
 				"nested directories in one operation. If the directory already exists, "+
 				"this operation will succeed silently. Perfect for setting up directory "+
 				"structures for projects or ensuring required paths exist. Only works within allowed directories."),
-		mcp.WithString("path", mcp.Required(), mcp.Description("Path for the new directory")),
+		mcp.WithReadOnlyHintAnnotation(false),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+		withArguments[CreateDirectoryArgs](),
 	)
 }
 
-func CreateDirectoryHandler(_ context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
-	path, ok := req.Params.Arguments["path"].(string)
-	if !ok {
-		return mcp.NewToolResultError("path must be a string"), nil
+// CreateDirectoryArgs are the arguments of create_directory.
+type CreateDirectoryArgs struct {
+	Path string `arg:"path,required" desc:"Path for the new directory"`
+}
+
+func CreateDirectoryHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[CreateDirectoryArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	validPath, err := validatePath(ctx, args.Path, allowedDirs)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := ctx.Err(); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := checkWritable(ctx, validPath); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-	validPath, err := validatePath(path, allowedDirs)
+	defer lockWrites(ctx)()
+	refund, err := chargeMkdirAll(ctx, validPath)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	if err := os.MkdirAll(validPath, 0755); err != nil {
+	done := noteChange(ctx, validPath)
+	if err := traced(ctx, "fs.mkdir", validPath, func() error {
+		return mkdirAll(backendFromContext(ctx), validPath, 0755)
+	}); err != nil {
+		refund()
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	return mcp.NewToolResultText(fmt.Sprintf("Successfully created directory %s", path)), nil
+	done(validPath)
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully created directory %s", args.Path)), nil
 }
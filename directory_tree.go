@@ -4,8 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/mark3labs/mcp-go/mcp"
-	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
 func DefineDirectoryTreeTool() mcp.Tool {
@@ -15,52 +16,101 @@ func DefineDirectoryTreeTool() mcp.Tool {
 				"Each entry includes 'name', 'type' (file/directory), and 'children' for directories. "+
 				"Files have no children array, while directories always have a children array (which may be empty). "+
 				"Only works within allowed directories."),
-		mcp.WithString("path", mcp.Required(), mcp.Description("Root path for the tree")),
-		mcp.WithBoolean("pretty", mcp.Description("Format the output with 2-space indentation for readability. "), mcp.DefaultBool(true)),
-		mcp.WithNumber("maxDepth", mcp.Description("Maximum depth of recursion"), mcp.DefaultNumber(100)),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+		withArguments[DirectoryTreeArgs](),
+		// The schema is written out because TreeEntry is recursive
+		mcp.WithRawOutputSchema(json.RawMessage(directoryTreeSchema)),
 	)
 }
 
-func DirectoryTreeHandler(_ context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
-	path, ok := req.Params.Arguments["path"].(string)
-	if !ok {
-		return mcp.NewToolResultError("path must be a string"), nil
+// DirectoryTreeArgs are the arguments of directory_tree.
+type DirectoryTreeArgs struct {
+	Path     string `arg:"path,required" desc:"Root path for the tree"`
+	Pretty   bool   `arg:"pretty,default=true" desc:"Format the output with 2-space indentation for readability"`
+	MaxDepth int    `arg:"maxDepth,default=100,min=0" desc:"Maximum depth of recursion, 0 for the default"`
+}
+
+const directoryTreeSchema = `{
+  "type": "object",
+  "properties": {
+    "entries": {"type": "array", "items": {"$ref": "#/$defs/entry"}},
+    "truncated": {"type": "string"}
+  },
+  "required": ["entries"],
+  "additionalProperties": false,
+  "$defs": {
+    "entry": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "type": {"type": "string", "enum": ["file", "directory"]},
+        "children": {"type": "array", "items": {"$ref": "#/$defs/entry"}}
+      },
+      "required": ["name", "type"],
+      "additionalProperties": false
+    }
+  }
+}`
+
+type TreeEntry struct {
+	Name     string      `json:"name"`
+	Type     string      `json:"type"`
+	Children []TreeEntry `json:"children,omitempty"`
+}
+
+// DirectoryTree is the structured content of directory_tree, whose text content is the bare list of entries.
+// Truncated explains why entries are missing, if they are.
+type DirectoryTree struct {
+	Entries   []TreeEntry `json:"entries"`
+	Truncated string      `json:"truncated,omitempty"`
+}
+
+func DirectoryTreeHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[DirectoryTreeArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-	pretty, _ := req.Params.Arguments["pretty"].(bool)
-	maxDepthNum, _ := req.Params.Arguments["maxDepth"].(float64)
-	maxDepth := int(maxDepthNum)
-	if maxDepth == 0 {
-		maxDepth = 100
-	} else if maxDepth <= 0 {
-		return mcp.NewToolResultError("maxDepth must be a positive integer"), nil
+	if args.MaxDepth == 0 {
+		// As before arguments were typed, 0 stands for the default
+		args.MaxDepth = 100
 	}
-	validPath, err := validatePath(path, allowedDirs)
+	ctx = withProgress(ctx, req, "entries scanned")
+	validPath, err := validatePath(ctx, args.Path, allowedDirs)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	type TreeEntry struct {
-		Name     string      `json:"name"`
-		Type     string      `json:"type"`
-		Children []TreeEntry `json:"children,omitempty"`
-	}
-
+	budget := newWalkBudget(ctx, validPath)
+	defer budget.end()
 	var buildTree func(string, int) ([]TreeEntry, error)
 	buildTree = func(currentPath string, depth int) ([]TreeEntry, error) {
-		entries, err := os.ReadDir(currentPath)
+		entries, err := backendFromContext(ctx).ReadDir(currentPath)
 		if err != nil {
 			return nil, err
 		}
 		var result []TreeEntry
 		for _, entry := range entries {
+			if !budget.next() {
+				if err := budget.err(); err != nil {
+					return nil, err
+				}
+				break
+			}
+			entryPath := filepath.Join(currentPath, entry.Name())
+			if isDeniedEntry(ctx, entryPath, pathInfo{name: entry.Name(), dir: entry.IsDir()}) {
+				continue
+			}
 			entryData := TreeEntry{
 				Name: entry.Name(),
 				Type: "file",
 			}
 			if entry.IsDir() {
 				entryData.Type = "directory"
-				if depth < maxDepth {
-					children, err := buildTree(filepath.Join(currentPath, entry.Name()), depth+1)
+				if depth < args.MaxDepth {
+					children, err := buildTree(entryPath, depth+1)
 					if err != nil {
 						return nil, err
 					}
@@ -81,12 +131,79 @@ func DirectoryTreeHandler(_ context.Context, req mcp.CallToolRequest, allowedDir
 		tree = []TreeEntry{}
 	}
 	indent := ""
-	if pretty {
+	if args.Pretty {
 		indent = "  "
 	}
 	jsonData, err := json.MarshalIndent(tree, "", indent)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	return mcp.NewToolResultText(string(jsonData)), nil
+	marker := budget.marker()
+	// Leave out entries rather than cut the JSON, so the text and the structured content stay whole
+	if maxResponse := limitsFromContext(ctx).MaxResponseBytes; maxResponse > 0 && int64(len(jsonData)+len(marker)) > maxResponse {
+		if tree, jsonData, marker, err = fitTree(tree, indent, marker, maxResponse); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+	structured := DirectoryTree{Entries: tree, Truncated: strings.TrimSpace(marker)}
+	result := mcp.NewToolResultStructured(structured, string(jsonData))
+	if structured.Truncated != "" {
+		// Keep the JSON intact and report the truncation separately
+		result.Content = append(result.Content, mcp.NewTextContent(structured.Truncated))
+	}
+	return result, nil
+}
+
+// fitTree keeps the most entries of tree, in the order they were walked, whose JSON and truncation
+// markers fit in maxBytes. marker is the marker of the walk, if it was cut short.
+func fitTree(tree []TreeEntry, indent, marker string, maxBytes int64) ([]TreeEntry, []byte, string, error) {
+	total := countEntries(tree)
+	build := func(n int) ([]TreeEntry, []byte, string, error) {
+		kept := firstEntries(tree, &n)
+		if kept == nil {
+			kept = []TreeEntry{}
+		}
+		data, err := json.MarshalIndent(kept, "", indent)
+		return kept, data, marker + truncationMarker(
+			"response reached the limit of %d bytes, %d entries left out", maxBytes, total-countEntries(kept)), err
+	}
+	// The entries that fit are found by bisection, as the size of the JSON grows with each entry
+	var failed error
+	n := sort.Search(total, func(n int) bool {
+		_, data, m, err := build(n + 1)
+		if err != nil {
+			failed = err
+			return true
+		}
+		return int64(len(data)+len(m)) > maxBytes
+	})
+	if failed != nil {
+		return nil, nil, "", failed
+	}
+	return build(n)
+}
+
+// firstEntries returns the first n entries of a tree in walk order, decrementing n by the number kept.
+func firstEntries(entries []TreeEntry, n *int) []TreeEntry {
+	var kept []TreeEntry
+	for _, entry := range entries {
+		if *n == 0 {
+			break
+		}
+		*n--
+		if entry.Children != nil {
+			entry.Children = firstEntries(entry.Children, n)
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
+
+// countEntries returns the number of entries in a tree.
+func countEntries(entries []TreeEntry) int {
+	n := len(entries)
+	for _, entry := range entries {
+		n += countEntries(entry.Children)
+	}
+	return n
 }
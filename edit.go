@@ -1,9 +1,9 @@
 package top
 
 import (
+	"context"
 	"fmt"
 	"github.com/pmezard/go-difflib/difflib"
-	"os"
 	"regexp"
 	"strings"
 )
@@ -42,17 +42,26 @@ func createUnifiedDiff(originalContent, newContent string, path string) (string,
 
 // Edit represents a single text replacement operation
 type Edit struct {
-	OldText string `json:"oldText"`
-	NewText string `json:"newText"`
+	OldText string `json:"oldText" arg:"oldText,required" desc:"Text to replace"`
+	NewText string `json:"newText" arg:"newText,required" desc:"Replacement text"`
 }
 
 // ApplyFileEdits applies a series of edits to a file and returns a formatted diff
-func applyFileEdits(originalPath, filePath string, edits []Edit, dryRun bool) (string, error) {
+func applyFileEdits(ctx context.Context, originalPath, filePath string, edits []Edit, dryRun bool) (string, error) {
+	if !dryRun {
+		// The quota is charged the growth from the content read here
+		defer lockWrites(ctx)()
+	}
+
 	// Read file content
-	contentBytes, err := os.ReadFile(filePath)
+	if err := checkFileSize(ctx, filePath); err != nil {
+		return "", err
+	}
+	contentBytes, err := readFileContext(ctx, filePath)
 	if err != nil {
 		return "", err
 	}
+	noteRead(ctx, len(contentBytes))
 
 	// Detect original line ending style before normalization
 	originalContent := string(contentBytes)
@@ -64,6 +73,9 @@ func applyFileEdits(originalPath, filePath string, edits []Edit, dryRun bool) (s
 	// Apply edits sequentially
 	modifiedContent := content
 	for _, edit := range edits {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
 		normalizedOld := normalizeLineEndings(edit.OldText)
 		normalizedNew := normalizeLineEndings(edit.NewText)
 
@@ -149,16 +161,31 @@ func applyFileEdits(originalPath, filePath string, edits []Edit, dryRun bool) (s
 		strings.Repeat("`", numBackticks))
 
 	if !dryRun {
+		// Don't write anything if the request was abandoned in the meantime
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
 		// Convert back to original line ending style before writing
 		finalContent := modifiedContent
 		if lineEndingStyle == "\r\n" {
 			finalContent = strings.ReplaceAll(modifiedContent, "\n", "\r\n")
 		}
 
-		err = os.WriteFile(filePath, []byte(finalContent), 0644)
+		refund, err := chargeQuota(ctx, filePath, int64(len(finalContent)-len(originalContent)), 0)
+		if err != nil {
+			return "", err
+		}
+		done := noteChange(ctx, filePath)
+		err = traced(ctx, "fs.write", filePath, func() error {
+			return writeFile(backendFromContext(ctx), filePath, []byte(finalContent), 0644)
+		})
 		if err != nil {
+			refund()
 			return "", err
 		}
+		noteWritten(ctx, len(finalContent))
+		done(filePath)
 	}
 
 	return formattedDiff, nil
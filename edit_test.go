@@ -1,6 +1,7 @@
 package top
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
@@ -27,7 +28,7 @@ func TestApplyFileEdits_ExactMatch(t *testing.T) {
 	}
 
 	// Apply edits in dry-run mode
-	diff, err := applyFileEdits("test.txt", testFilePath, edits, true)
+	diff, err := applyFileEdits(context.Background(), "test.txt", testFilePath, edits, true)
 	if err != nil {
 		t.Fatalf("Failed to apply edits: %v", err)
 	}
@@ -50,7 +51,7 @@ func TestApplyFileEdits_ExactMatch(t *testing.T) {
 	}
 
 	// Apply edits for real
-	_, err = applyFileEdits("test.txt", testFilePath, edits, false)
+	_, err = applyFileEdits(context.Background(), "test.txt", testFilePath, edits, false)
 	if err != nil {
 		t.Fatalf("Failed to apply edits: %v", err)
 	}
@@ -87,7 +88,7 @@ func TestApplyFileEdits_NoMatch(t *testing.T) {
 	}
 
 	// Apply edits in dry-run mode
-	_, err = applyFileEdits("test.txt", testFilePath, edits, true)
+	_, err = applyFileEdits(context.Background(), "test.txt", testFilePath, edits, true)
 	if err == nil {
 		t.Errorf("Expected error for non-matching text, but got none")
 	}
@@ -113,7 +114,7 @@ func TestApplyFileEdits_WhitespaceIndentation(t *testing.T) {
 	}
 
 	// Apply edits in dry-run mode
-	diff, err := applyFileEdits("test.txt", testFilePath, edits, true)
+	diff, err := applyFileEdits(context.Background(), "test.txt", testFilePath, edits, true)
 	if err != nil {
 		t.Fatalf("Failed to apply edits: %v", err)
 	}
@@ -130,7 +131,7 @@ func TestApplyFileEdits_WhitespaceIndentation(t *testing.T) {
 	}
 
 	// Apply edits for real
-	_, err = applyFileEdits("test.txt", testFilePath, edits, false)
+	_, err = applyFileEdits(context.Background(), "test.txt", testFilePath, edits, false)
 	if err != nil {
 		t.Fatalf("Failed to apply edits: %v", err)
 	}
@@ -167,7 +168,7 @@ func TestApplyFileEdits_RelativeIndentation(t *testing.T) {
 	}
 
 	// Apply edits in dry-run mode
-	diff, err := applyFileEdits("test.txt", testFilePath, edits, true)
+	diff, err := applyFileEdits(context.Background(), "test.txt", testFilePath, edits, true)
 	if err != nil {
 		t.Fatalf("Failed to apply edits: %v", err)
 	}
@@ -184,7 +185,7 @@ func TestApplyFileEdits_RelativeIndentation(t *testing.T) {
 	}
 
 	// Apply edits for real
-	_, err = applyFileEdits("test.txt", testFilePath, edits, false)
+	_, err = applyFileEdits(context.Background(), "test.txt", testFilePath, edits, false)
 	if err != nil {
 		t.Fatalf("Failed to apply edits: %v", err)
 	}
@@ -225,7 +226,7 @@ func TestApplyFileEdits_MultipleEdits(t *testing.T) {
 	}
 
 	// Apply edits in dry-run mode
-	diff, err := applyFileEdits("test.txt", testFilePath, edits, true)
+	diff, err := applyFileEdits(context.Background(), "test.txt", testFilePath, edits, true)
 	if err != nil {
 		t.Fatalf("Failed to apply edits: %v", err)
 	}
@@ -248,7 +249,7 @@ func TestApplyFileEdits_MultipleEdits(t *testing.T) {
 	}
 
 	// Apply edits for real
-	_, err = applyFileEdits("test.txt", testFilePath, edits, false)
+	_, err = applyFileEdits(context.Background(), "test.txt", testFilePath, edits, false)
 	if err != nil {
 		t.Fatalf("Failed to apply edits: %v", err)
 	}
@@ -285,7 +286,7 @@ func TestApplyFileEdits_LineEndingNormalization(t *testing.T) {
 	}
 
 	// Apply edits
-	_, err = applyFileEdits("test.txt", testFilePath, edits, false)
+	_, err = applyFileEdits(context.Background(), "test.txt", testFilePath, edits, false)
 	if err != nil {
 		t.Fatalf("Failed to apply edits: %v", err)
 	}
@@ -324,7 +325,7 @@ func TestApplyFileEdits_MixedLineEndings(t *testing.T) {
 	}
 
 	// Apply edits
-	_, err = applyFileEdits("mixed.txt", testFilePath, edits, false)
+	_, err = applyFileEdits(context.Background(), "mixed.txt", testFilePath, edits, false)
 	if err != nil {
 		t.Fatalf("Failed to apply edits: %v", err)
 	}
@@ -3,9 +3,7 @@ package top
 import (
 	"context"
 	"encoding/json"
-	"github.com/djherbis/times"
 	"github.com/mark3labs/mcp-go/mcp"
-	"os"
 	"time"
 )
 
@@ -16,10 +14,20 @@ func DefineGetFileInfoTool() mcp.Tool {
 				"information including size, creation time, last modified time, permissions, "+
 				"and type. This tool is perfect for understanding file characteristics "+
 				"without reading the actual content. Only works within allowed directories."),
-		mcp.WithString("path", mcp.Required(), mcp.Description("Path to query")),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+		withArguments[GetFileInfoArgs](),
+		mcp.WithOutputSchema[FileInfo](),
 	)
 }
 
+// GetFileInfoArgs are the arguments of get_file_info.
+type GetFileInfoArgs struct {
+	Path string `arg:"path,required" desc:"Path to query"`
+}
+
 type FileInfo struct {
 	Permissions string `json:"permissions"`
 	Symlink     string `json:"symlink,omitempty"`
@@ -30,45 +38,55 @@ type FileInfo struct {
 	Accessed    string `json:"accessed"`
 }
 
-func GetFileInfoHandler(_ context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
-	path, ok := req.Params.Arguments["path"].(string)
-	if !ok {
-		return mcp.NewToolResultError("path must be a string"), nil
+func GetFileInfoHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[GetFileInfoArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-	validPath, err := validatePath(path, allowedDirs)
+	validPath, err := validatePath(ctx, args.Path, allowedDirs)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	info, err := os.Lstat(validPath)
+	b := backendFromContext(ctx)
+	info, err := b.Lstat(validPath)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	t, err := times.Stat(validPath)
+	target, err := b.Stat(validPath)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 	fileStats := FileInfo{
 		Permissions: info.Mode().String(),
 		Size:        info.Size(),
-		Modified:    t.ModTime().Format(time.RFC3339),
-		Accessed:    t.AccessTime().Format(time.RFC3339),
+		Modified:    target.ModTime().Format(time.RFC3339),
+		Accessed:    target.ModTime().Format(time.RFC3339),
 	}
 	if isSymlink(info) {
-		linkTarget, err := os.Readlink(validPath)
+		linkTarget, err := b.Readlink(validPath)
 		if err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
 		fileStats.Symlink = linkTarget
 	}
-	if t.HasBirthTime() {
-		fileStats.Created = t.BirthTime().Format(time.RFC3339)
-	}
-	if t.HasChangeTime() {
-		fileStats.Changed = t.ChangeTime().Format(time.RFC3339)
+	// Backends that only know the modification time report it as the access time
+	if tb, ok := b.(timesBackend); ok {
+		t, err := tb.Times(validPath)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		fileStats.Modified = t.ModTime().Format(time.RFC3339)
+		fileStats.Accessed = t.AccessTime().Format(time.RFC3339)
+		if t.HasBirthTime() {
+			fileStats.Created = t.BirthTime().Format(time.RFC3339)
+		}
+		if t.HasChangeTime() {
+			fileStats.Changed = t.ChangeTime().Format(time.RFC3339)
+		}
 	}
 	jsonData, err := json.Marshal(fileStats)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	return mcp.NewToolResultText(string(jsonData)), nil
+	return mcp.NewToolResultStructured(fileStats, string(jsonData)), nil
 }
@@ -0,0 +1,57 @@
+package top
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func DefineGetQuotaTool() mcp.Tool {
+	return mcp.NewTool("get_quota",
+		mcp.WithDescription(
+			"Report the write quota of each allowed directory and how much of it this session has used. "+
+				"Bytes are the net growth of the directory, files the number of files and directories created. "+
+				"A limit of 0 means unlimited. Use this before large writes to check that they will fit."),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+		mcp.WithOutputSchema[QuotaList](),
+	)
+}
+
+type QuotaInfo struct {
+	Root       string `json:"root"`
+	BytesUsed  int64  `json:"bytesUsed"`
+	BytesLimit int64  `json:"bytesLimit"`
+	FilesUsed  int    `json:"filesUsed"`
+	FilesLimit int    `json:"filesLimit"`
+}
+
+// QuotaList is the structured content of get_quota, whose text content is the bare list.
+type QuotaList struct {
+	Quotas []QuotaInfo `json:"quotas"`
+}
+
+func GetQuotaHandler(ctx context.Context, _ mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	infos := []QuotaInfo{}
+	scope := quotaScopeFromContext(ctx)
+	for _, dir := range allowedDirs {
+		info := QuotaInfo{Root: dir}
+		if scope != nil {
+			root := anchorOf(ctx, dir, allowedDirs)
+			quota := scope.quotas.Quota(root)
+			usage := scope.quotas.Usage(scope.session, root)
+			info.BytesUsed = usage.Bytes
+			info.BytesLimit = quota.MaxBytes
+			info.FilesUsed = usage.Files
+			info.FilesLimit = quota.MaxFiles
+		}
+		infos = append(infos, info)
+	}
+	jsonData, err := json.Marshal(infos)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return mcp.NewToolResultStructured(QuotaList{Quotas: infos}, string(jsonData)), nil
+}
@@ -0,0 +1,53 @@
+package top
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/landlock-lsm/go-landlock/landlock"
+	llsyscall "github.com/landlock-lsm/go-landlock/landlock/syscall"
+	"time"
+)
+
+// ErrLandlockUnavailable is returned by Landlock when the kernel does not support Landlock.
+var ErrLandlockUnavailable = errors.New("landlock is not supported by this kernel")
+
+// resolverFiles are the system files read to resolve host names, on each lookup if they changed.
+var resolverFiles = []string{"/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf", "/etc/host.conf", "/etc/gai.conf"}
+
+// Landlock restricts the filesystem access of the current process, and of all its threads,
+// to the given directories. It must be called after any other files the process needs,
+// such as logs, have been opened. Missing directories are ignored.
+// If network is set, as when the process exports traces, the files of host name resolution stay
+// readable and the system certificates are loaded beforehand.
+// On kernels with an older Landlock ABI, it enforces as much as the kernel supports
+// and returns the ABI version in use.
+func Landlock(readWrite, readOnly []string, network bool) (int, error) {
+	abi, err := llsyscall.LandlockGetABIVersion()
+	if err != nil || abi < 1 {
+		return 0, ErrLandlockUnavailable
+	}
+
+	// Load the local time zone while its definition is still readable
+	time.Now().Zone()
+
+	var rules []landlock.Rule
+	if len(readWrite) > 0 {
+		// Refer is needed to move files between directories
+		rules = append(rules, landlock.RWDirs(readWrite...).WithRefer().IgnoreIfMissing())
+	}
+	if len(readOnly) > 0 {
+		rules = append(rules, landlock.RODirs(readOnly...).IgnoreIfMissing())
+	}
+	if network {
+		// Certificates are loaded once, and kept for every connection
+		if _, err := x509.SystemCertPool(); err != nil {
+			return abi, fmt.Errorf("loading system certificates: %w", err)
+		}
+		rules = append(rules, landlock.ROFiles(resolverFiles...).IgnoreIfMissing())
+	}
+	if err := landlock.V5.BestEffort().RestrictPaths(rules...); err != nil {
+		return abi, fmt.Errorf("landlock: %w", err)
+	}
+	return abi, nil
+}
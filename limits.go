@@ -0,0 +1,214 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits caps the resources a single tool call may consume. Zero values mean unlimited.
+type Limits struct {
+	// MaxFileBytes is the maximum number of bytes read from any single file.
+	MaxFileBytes int64
+	// MaxResponseBytes is the maximum total size of the text returned by a call.
+	MaxResponseBytes int64
+	// MaxWalkEntries is the maximum number of entries visited by a recursive walk.
+	MaxWalkEntries int
+	// CallTimeout is the maximum wall-clock time of a call.
+	CallTimeout time.Duration
+}
+
+type limitsKey struct{}
+
+// WithLimits returns a context carrying the given limits for handlers to enforce.
+func WithLimits(ctx context.Context, limits Limits) context.Context {
+	return context.WithValue(ctx, limitsKey{}, limits)
+}
+
+func limitsFromContext(ctx context.Context) Limits {
+	limits, _ := ctx.Value(limitsKey{}).(Limits)
+	return limits
+}
+
+// Wrap returns a copy of t whose handler runs under these limits.
+// Text content exceeding MaxResponseBytes is truncated with a marker; results with structured content
+// are turned into errors, as their JSON cannot be cut.
+func (l Limits) Wrap(t tester.ToolHandler) tester.ToolHandler {
+	handler := t.Handler
+	t.Handler = func(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+		if l.CallTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, l.CallTimeout)
+			defer cancel()
+		}
+		result, err := handler(WithLimits(ctx, l), req, allowedDirs)
+		if err == nil && result != nil && l.MaxResponseBytes > 0 {
+			truncateResult(result, l.MaxResponseBytes)
+		}
+		return result, err
+	}
+	return t
+}
+
+// truncationMarker formats the notice appended to truncated output.
+func truncationMarker(format string, args ...interface{}) string {
+	return fmt.Sprintf("\n[truncated: %s]", fmt.Sprintf(format, args...))
+}
+
+// truncateString cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// truncateResult cuts the text content of result so its total size stays within maxBytes.
+func truncateResult(result *mcp.CallToolResult, maxBytes int64) {
+	remaining := maxBytes
+	for i, c := range result.Content {
+		text, ok := c.(mcp.TextContent)
+		if !ok {
+			continue
+		}
+		if int64(len(text.Text)) > remaining {
+			text.Text = truncateString(text.Text, int(remaining)) +
+				truncationMarker("response exceeds the limit of %d bytes", maxBytes)
+			result.Content[i] = text
+			result.Content = result.Content[:i+1]
+			// Structured content mirrors the text, so it would exceed the limit as well, and a
+			// successful result without it would not match the output schema of the tool
+			if result.StructuredContent != nil {
+				result.StructuredContent = nil
+				result.IsError = true
+			}
+			return
+		}
+		remaining -= int64(len(text.Text))
+	}
+}
+
+// readFileLimited reads path up to the per-file limit of the call.
+// It returns the content read, the full size of the file and whether the content was truncated.
+func readFileLimited(ctx context.Context, path string) ([]byte, int64, bool, error) {
+	f, err := openFile(backendFromContext(ctx), path)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	maxBytes := limitsFromContext(ctx).MaxFileBytes
+	if maxBytes <= 0 || info.Size() <= maxBytes {
+		content, err := io.ReadAll(contextReader{ctx, f})
+		if err != nil {
+			return nil, 0, false, err
+		}
+		noteRead(ctx, len(content))
+		return content, int64(len(content)), false, nil
+	}
+	content := make([]byte, maxBytes)
+	n, err := io.ReadFull(contextReader{ctx, f}, content)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, 0, false, err
+	}
+	noteRead(ctx, n)
+	return content[:n], info.Size(), true, nil
+}
+
+// checkFileSize returns an error if a file that must be processed whole exceeds the per-file limit.
+func checkFileSize(ctx context.Context, path string) error {
+	maxBytes := limitsFromContext(ctx).MaxFileBytes
+	if maxBytes <= 0 {
+		return nil
+	}
+	info, err := backendFromContext(ctx).Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() > maxBytes {
+		return fmt.Errorf("file is %d bytes, which exceeds the limit of %d bytes", info.Size(), maxBytes)
+	}
+	return nil
+}
+
+// walkBudget tracks the entries visited by a recursive walk against the limits of the call.
+// Running out of time or entries truncates the walk, while cancellation aborts it.
+// The entries visited are reported as the progress of the call, if requested, and the walk is
+// traced as a span of the call until end is called.
+type walkBudget struct {
+	ctx        context.Context
+	maxEntries int
+	entries    int
+	exhausted  string
+	canceled   error
+	progress   *progressReporter
+	span       trace.Span
+}
+
+// newWalkBudget starts the budget of a walk of root, or of all allowed directories if root is "".
+func newWalkBudget(ctx context.Context, root string) *walkBudget {
+	_, span := startSpan(ctx, "fs.walk", root)
+	return &walkBudget{
+		ctx:        ctx,
+		maxEntries: limitsFromContext(ctx).MaxWalkEntries,
+		progress:   progressFromContext(ctx),
+		span:       span,
+	}
+}
+
+// end ends the span of the walk.
+func (b *walkBudget) end() {
+	b.span.SetAttributes(attribute.Int("fs.walk.entries", b.entries))
+	if b.exhausted != "" {
+		b.span.SetAttributes(attribute.String("fs.walk.truncated", b.exhausted))
+	}
+	endSpan(b.span, b.canceled)
+}
+
+// next reports whether the walk may visit one more entry.
+// Once it returns false, marker describes why the walk was cut short.
+func (b *walkBudget) next() bool {
+	if b.exhausted != "" || b.canceled != nil {
+		return false
+	}
+	if err := b.ctx.Err(); err == context.Canceled {
+		b.canceled = err
+		return false
+	} else if err == context.DeadlineExceeded {
+		b.exhausted = "time limit reached"
+		return false
+	}
+	if b.maxEntries > 0 && b.entries >= b.maxEntries {
+		b.exhausted = fmt.Sprintf("walked the limit of %d entries", b.maxEntries)
+		return false
+	}
+	b.entries++
+	b.progress.add(1)
+	noteWalked(b.ctx, 1)
+	return true
+}
+
+// err returns the cancellation error if the walk was aborted.
+func (b *walkBudget) err() error {
+	return b.canceled
+}
+
+// marker returns the truncation marker for an exhausted budget, or "" if the walk completed.
+func (b *walkBudget) marker() string {
+	if b.exhausted == "" {
+		return ""
+	}
+	return truncationMarker("%s", b.exhausted)
+}
@@ -0,0 +1,131 @@
+package top
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	tempDir := t.TempDir()
+	bigFile := filepath.Join(tempDir, "big.txt")
+	if err := os.WriteFile(bigFile, []byte(strings.Repeat("x", 100)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		path := filepath.Join(tempDir, fmt.Sprintf("file%d.txt", i))
+		if err := os.WriteFile(path, []byte("small"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	limits := Limits{MaxFileBytes: 10, MaxResponseBytes: 400, MaxWalkEntries: 5}
+	call := func(t *testing.T, name string, args map[string]interface{}) *mcp.CallToolResult {
+		t.Helper()
+		for _, tool := range Tools {
+			if tool.Tool.Name == name {
+				req := mcp.CallToolRequest{}
+				req.Params.Name = name
+				req.Params.Arguments = args
+				result, err := limits.Wrap(tool).Handler(context.Background(), req, []string{tempDir})
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return result
+			}
+		}
+		t.Fatalf("Tool %s not found", name)
+		return nil
+	}
+	text := func(t *testing.T, result *mcp.CallToolResult, i int) string {
+		t.Helper()
+		if len(result.Content) <= i {
+			t.Fatalf("Expected at least %d contents, got %v", i+1, result.Content)
+		}
+		return result.Content[i].(mcp.TextContent).Text
+	}
+
+	t.Run("read_file truncates large file", func(t *testing.T) {
+		got := text(t, call(t, "read_file", map[string]interface{}{"path": bigFile}), 0)
+		if !strings.HasPrefix(got, strings.Repeat("x", 10)+"\n[truncated: file is 100 bytes") {
+			t.Errorf("Unexpected content: %s", got)
+		}
+	})
+
+	t.Run("read_multiple_files stops at response limit", func(t *testing.T) {
+		var paths []interface{}
+		for i := 0; i < 10; i++ {
+			paths = append(paths, filepath.Join(tempDir, fmt.Sprintf("file%d.txt", i)))
+		}
+		got := text(t, call(t, "read_multiple_files", map[string]interface{}{"paths": paths}), 0)
+		if !strings.Contains(got, "[truncated:") || strings.Contains(got, "file9.txt") {
+			t.Errorf("Unexpected content: %s", got)
+		}
+	})
+
+	t.Run("search_files stops at walk limit", func(t *testing.T) {
+		got := text(t, call(t, "search_files", map[string]interface{}{"path": tempDir, "pattern": "file"}), 0)
+		if !strings.Contains(got, "[truncated: walked the limit of 5 entries]") {
+			t.Errorf("Unexpected content: %s", got)
+		}
+	})
+
+	t.Run("directory_tree reports truncation separately", func(t *testing.T) {
+		result := call(t, "directory_tree", map[string]interface{}{"path": tempDir, "pretty": false})
+		if got := text(t, result, 1); got != "[truncated: walked the limit of 5 entries]" {
+			t.Errorf("Unexpected marker: %s", got)
+		}
+		if got := text(t, result, 0); strings.Count(got, `"name"`) != 5 {
+			t.Errorf("Unexpected tree: %s", got)
+		}
+	})
+
+	t.Run("edit_file rejects large file", func(t *testing.T) {
+		result := call(t, "edit_file", map[string]interface{}{
+			"path":  bigFile,
+			"edits": []interface{}{map[string]interface{}{"oldText": "x", "newText": "y"}},
+		})
+		if !result.IsError || !strings.Contains(text(t, result, 0), "exceeds the limit") {
+			t.Errorf("Expected size error, got: %v", result.Content)
+		}
+	})
+
+	// Without a walk limit, the response limit is what cuts the tree
+	limits = Limits{MaxResponseBytes: 200}
+
+	t.Run("directory_tree leaves out entries at response limit", func(t *testing.T) {
+		result := call(t, "directory_tree", map[string]interface{}{"path": tempDir, "pretty": false})
+		if result.IsError {
+			t.Fatalf("Unexpected error: %v", result.Content)
+		}
+		marker := text(t, result, 1)
+		if !strings.HasPrefix(marker, "[truncated: response reached the limit of 200 bytes") {
+			t.Errorf("Unexpected marker: %s", marker)
+		}
+		tree := text(t, result, 0)
+		if len(tree)+len(marker) > 200 {
+			t.Errorf("Expected the response to fit in 200 bytes, got %d", len(tree)+len(marker))
+		}
+		var entries []TreeEntry
+		if err := json.Unmarshal([]byte(tree), &entries); err != nil || len(entries) == 0 || len(entries) == 11 {
+			t.Errorf("Expected some of the entries as valid JSON, got %s, %v", tree, err)
+		}
+		structured, ok := result.StructuredContent.(DirectoryTree)
+		if !ok || len(structured.Entries) != len(entries) || structured.Truncated != marker {
+			t.Errorf("Expected the structured content to match the text, got %+v", result.StructuredContent)
+		}
+	})
+
+	t.Run("Results with structured content cut by the response limit are errors", func(t *testing.T) {
+		limits = Limits{MaxResponseBytes: 20}
+		result := call(t, "get_file_info", map[string]interface{}{"path": bigFile})
+		if !result.IsError || result.StructuredContent != nil {
+			t.Errorf("Expected an error without structured content, got %v", result)
+		}
+	})
+}
@@ -12,6 +12,10 @@ func DefineListAllowedDirectoriesTool() mcp.Tool {
 		mcp.WithDescription(
 			"Returns the list of directories that this server is allowed to access. "+
 				"Use this to understand which directories are available before trying to access files."),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
 	)
 }
 
@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/mark3labs/mcp-go/mcp"
-	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -15,33 +15,45 @@ func DefineListDirectoryTool() mcp.Tool {
 				"Results clearly distinguish between files and directories with [FILE] and [DIR] "+
 				"prefixes. This tool is essential for understanding directory structure and "+
 				"finding specific files within a directory. Only works within allowed directories."),
-		mcp.WithString("path", mcp.Required(), mcp.Description("Path to the directory")),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+		withArguments[ListDirectoryArgs](),
 	)
 }
 
-func ListDirectoryHandler(_ context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
-	path, ok := req.Params.Arguments["path"].(string)
-	if !ok {
-		return mcp.NewToolResultError("path must be a string"), nil
-	}
-	validPath, err := validatePath(path, allowedDirs)
+// ListDirectoryArgs are the arguments of list_directory.
+type ListDirectoryArgs struct {
+	Path string `arg:"path,required" desc:"Path to the directory"`
+}
+
+func ListDirectoryHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[ListDirectoryArgs](req.GetArguments())
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	entries, err := os.ReadDir(validPath)
+	validPath, err := validatePath(ctx, args.Path, allowedDirs)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	if len(entries) == 0 {
-		return mcp.NewToolResultText("Empty directory"), nil
+	entries, err := backendFromContext(ctx).ReadDir(validPath)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 	var lines []string
 	for _, entry := range entries {
+		if isDeniedEntry(ctx, filepath.Join(validPath, entry.Name()), pathInfo{name: entry.Name(), dir: entry.IsDir()}) {
+			continue
+		}
 		prefix := "[FILE]"
 		if entry.IsDir() {
 			prefix = "[DIR]"
 		}
 		lines = append(lines, fmt.Sprintf("%s %s", prefix, entry.Name()))
 	}
+	if len(lines) == 0 {
+		return mcp.NewToolResultText("Empty directory"), nil
+	}
 	return mcp.NewToolResultText(strings.Join(lines, "\n")), nil
 }
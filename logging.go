@@ -0,0 +1,27 @@
+package top
+
+import (
+	"context"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"log/slog"
+)
+
+// clientLogger names the server in the log messages sent to clients.
+const clientLogger = "filesystem"
+
+// warn logs a problem met by a call, such as an entry skipped by a walk or a denied path, and forwards
+// it to the client of the call as notifications/message, if the client asked for warnings with
+// logging/setLevel. Clients that set no level, or cannot be notified, get nothing.
+func warn(ctx context.Context, msg, path string, err error) {
+	data := map[string]any{"message": msg, "path": path}
+	attrs := []any{"path", path}
+	if err != nil {
+		data["error"] = err.Error()
+		attrs = append(attrs, "error", err)
+	}
+	slog.WarnContext(ctx, msg, attrs...)
+	if srv := server.ServerFromContext(ctx); srv != nil {
+		_ = srv.SendLogMessageToClient(ctx, mcp.NewLoggingMessageNotification(mcp.LoggingLevelWarning, clientLogger, data))
+	}
+}
@@ -0,0 +1,99 @@
+package top
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loggingSession is a notified session whose log level can be set.
+type loggingSession struct {
+	notifiedSession
+	level mcp.LoggingLevel
+}
+
+func (s *loggingSession) SetLogLevel(level mcp.LoggingLevel) { s.level = level }
+func (s *loggingSession) GetLogLevel() mcp.LoggingLevel      { return s.level }
+
+func TestLogging(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	loop := filepath.Join(tempDir, "loop")
+	if err := os.Symlink(filepath.Join(tempDir, "back"), loop); err != nil {
+		t.Skipf("Symlinks are unavailable: %v", err)
+	}
+	if err := os.Symlink(loop, filepath.Join(tempDir, "back")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	policy, err := NewPolicy(nil, []string{"secret.txt"})
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	srv := server.NewMCPServer("test", "1.0", server.WithToolCapabilities(false), server.WithLogging())
+	for _, tool := range Tools {
+		handler := policy.Wrap(tool).Handler
+		srv.AddTool(tool.Tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return handler(ctx, req, []string{tempDir})
+		})
+	}
+	send := func(t *testing.T, session *loggingSession, method string, params map[string]any) {
+		t.Helper()
+		message, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+		if response, ok := srv.HandleMessage(srv.WithContext(context.Background(), session), message).(mcp.JSONRPCResponse); !ok {
+			t.Fatalf("Unexpected response: %+v", response)
+		}
+	}
+	readFile := func(t *testing.T, session *loggingSession, path string) []mcp.JSONRPCNotification {
+		t.Helper()
+		send(t, session, "tools/call", map[string]any{"name": "read_file", "arguments": map[string]any{"path": path}})
+		var notifications []mcp.JSONRPCNotification
+		for {
+			select {
+			case notification := <-session.notifications:
+				notifications = append(notifications, notification)
+			default:
+				return notifications
+			}
+		}
+	}
+	newSession := func() *loggingSession {
+		return &loggingSession{notifiedSession: notifiedSession{
+			rootsSession:  rootsSession{id: "logging"},
+			notifications: make(chan mcp.JSONRPCNotification, 10),
+		}}
+	}
+
+	t.Run("Warnings are sent once the level is set", func(t *testing.T) {
+		session := newSession()
+		if notifications := readFile(t, session, filepath.Join(tempDir, "secret.txt")); len(notifications) != 0 {
+			t.Errorf("Unexpected notifications before setting the level: %+v", notifications)
+		}
+		send(t, session, "logging/setLevel", map[string]any{"level": "warning"})
+		for _, path := range []string{filepath.Join(tempDir, "secret.txt"), loop} {
+			notifications := readFile(t, session, path)
+			if len(notifications) != 1 {
+				t.Fatalf("Expected 1 notification for %s, got %+v", path, notifications)
+			}
+			fields := notifications[0].Params.AdditionalFields
+			data, _ := fields["data"].(map[string]any)
+			if notifications[0].Method != string(mcp.MethodNotificationMessage) ||
+				fields["level"] != mcp.LoggingLevelWarning || data["path"] != path {
+				t.Errorf("Unexpected notification: %+v", notifications[0])
+			}
+		}
+	})
+
+	t.Run("Warnings are filtered by level", func(t *testing.T) {
+		session := newSession()
+		send(t, session, "logging/setLevel", map[string]any{"level": "error"})
+		if notifications := readFile(t, session, filepath.Join(tempDir, "secret.txt")); len(notifications) != 0 {
+			t.Errorf("Unexpected notifications at error level: %+v", notifications)
+		}
+	})
+}
@@ -0,0 +1,441 @@
+package top
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxMemorySymlinks is the number of symlinks a path of a MemoryBackend may go through, as on Linux.
+const maxMemorySymlinks = 40
+
+// MemoryBackend is a filesystem held in memory, starting with an empty root directory. It follows
+// the semantics of the local filesystem, symlinks included, so that tools behave alike on both,
+// which makes it suitable for tests.
+type MemoryBackend struct {
+	mu       sync.Mutex
+	root     *memoryNode
+	size     int64 // Bytes of content of the files
+	maxBytes int64 // Limit of size, if not 0
+}
+
+// memoryNode is a file, directory or symlink of a MemoryBackend.
+type memoryNode struct {
+	mode     fs.FileMode
+	modTime  time.Time
+	data     []byte                 // Content of files
+	source   *memorySource          // Content of files kept elsewhere, instead of data
+	target   string                 // Target of symlinks
+	children map[string]*memoryNode // Entries of directories
+}
+
+// memorySource is the content of a file kept outside of memory, such as in an archive, which is read
+// when the file is.
+type memorySource struct {
+	size int64
+	open func() (io.ReadCloser, error)
+}
+
+// NewMemoryBackend creates an empty filesystem.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{root: newMemoryDir(0755)}
+}
+
+// newLimitedMemoryBackend creates an empty filesystem whose files may hold up to maxBytes of content
+// together. Writes beyond it fail with syscall.ENOSPC, as on a full disk.
+func newLimitedMemoryBackend(maxBytes int64) *MemoryBackend {
+	return &MemoryBackend{root: newMemoryDir(0755), maxBytes: maxBytes}
+}
+
+// fits reports whether n more bytes of content fit in the filesystem.
+func (m *MemoryBackend) fits(n int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.maxBytes == 0 || m.size+n <= m.maxBytes
+}
+
+func newMemoryDir(perm fs.FileMode) *memoryNode {
+	return &memoryNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now(), children: map[string]*memoryNode{}}
+}
+
+// lookup resolves name, following symlinks on the way and, if follow is set, at its end. It returns
+// the directory holding the last element and its name, and the node of the last element, nil if it
+// does not exist. The root has no parent. The caller must hold the lock.
+func (m *MemoryBackend) lookup(name string, follow bool) (*memoryNode, string, *memoryNode, error) {
+	if !filepath.IsAbs(name) {
+		return nil, "", nil, syscall.EINVAL
+	}
+	path := filepath.Clean(name)
+	for links := 0; ; {
+		parts := strings.Split(strings.Trim(path, string(filepath.Separator)), string(filepath.Separator))
+		if parts[0] == "" {
+			return nil, "", m.root, nil
+		}
+		dir, resolved := m.root, string(filepath.Separator)
+		for i, part := range parts {
+			last := i == len(parts)-1
+			node := dir.children[part]
+			if node == nil {
+				if last {
+					return dir, part, nil, nil
+				}
+				return nil, "", nil, syscall.ENOENT
+			}
+			if node.mode&fs.ModeSymlink != 0 && (!last || follow) {
+				if links++; links > maxMemorySymlinks {
+					return nil, "", nil, syscall.ELOOP
+				}
+				target := node.target
+				if !filepath.IsAbs(target) {
+					target = filepath.Join(resolved, target)
+				}
+				// Resolve the rest of the path from the target
+				path = filepath.Join(append([]string{target}, parts[i+1:]...)...)
+				break
+			}
+			if last {
+				return dir, part, node, nil
+			}
+			if !node.mode.IsDir() {
+				return nil, "", nil, syscall.ENOTDIR
+			}
+			dir, resolved = node, filepath.Join(resolved, part)
+		}
+	}
+}
+
+// node returns the existing node at name. The caller must hold the lock.
+func (m *MemoryBackend) node(op, name string, follow bool) (*memoryNode, error) {
+	_, _, node, err := m.lookup(name, follow)
+	if err == nil && node == nil {
+		err = syscall.ENOENT
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return node, nil
+}
+
+func (m *MemoryBackend) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.node("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return node.info(filepath.Base(name)), nil
+}
+
+func (m *MemoryBackend) Lstat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.node("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return node.info(filepath.Base(name)), nil
+}
+
+func (m *MemoryBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.node("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: syscall.ENOTDIR}
+	}
+	entries := make([]fs.DirEntry, 0, len(node.children))
+	for childName, child := range node.children {
+		entries = append(entries, fs.FileInfoToDirEntry(child.info(childName)))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+func (m *MemoryBackend) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, base, node, err := m.lookup(name, true)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	switch {
+	case node == nil && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.ENOENT}
+	case node == nil:
+		node = &memoryNode{mode: perm.Perm(), modTime: time.Now()}
+		dir.children[base] = node
+	case flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EEXIST}
+	case node.mode.IsDir() && writable:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	case writable && node.source != nil && flag&os.O_TRUNC == 0:
+		// Content kept elsewhere can only be replaced
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EROFS}
+	case writable && flag&os.O_TRUNC != 0:
+		m.size -= int64(len(node.data))
+		node.data, node.source = nil, nil
+		node.modTime = time.Now()
+	}
+	return &memoryFile{backend: m, node: node, name: name, flag: flag}, nil
+}
+
+func (m *MemoryBackend) Mkdir(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, base, node, err := m.lookup(name, false)
+	if err == nil && node != nil {
+		err = syscall.EEXIST
+	}
+	if err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	dir.children[base] = newMemoryDir(perm)
+	dir.modTime = time.Now()
+	return nil
+}
+
+func (m *MemoryBackend) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fail := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	oldDir, oldBase, node, err := m.lookup(oldpath, false)
+	if err == nil && node == nil {
+		err = syscall.ENOENT
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if oldDir == nil {
+		return fail(syscall.EBUSY)
+	}
+	newDir, newBase, existing, err := m.lookup(newpath, false)
+	if err != nil {
+		return fail(err)
+	}
+	if newDir == nil {
+		return fail(syscall.EBUSY)
+	}
+	if existing == node {
+		return nil
+	}
+	if node.mode.IsDir() && isWithin(newpath, oldpath) {
+		return fail(syscall.EINVAL)
+	}
+	if existing != nil {
+		switch {
+		case node.mode.IsDir() && !existing.mode.IsDir():
+			return fail(syscall.ENOTDIR)
+		case !node.mode.IsDir() && existing.mode.IsDir():
+			return fail(syscall.EISDIR)
+		case existing.mode.IsDir() && len(existing.children) > 0:
+			return fail(syscall.ENOTEMPTY)
+		}
+	}
+	if existing != nil {
+		m.size -= int64(len(existing.data))
+	}
+	delete(oldDir.children, oldBase)
+	newDir.children[newBase] = node
+	oldDir.modTime, newDir.modTime = time.Now(), time.Now()
+	return nil
+}
+
+func (m *MemoryBackend) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, base, node, err := m.lookup(name, false)
+	switch {
+	case err != nil:
+	case node == nil:
+		err = syscall.ENOENT
+	case dir == nil:
+		err = syscall.EBUSY
+	case node.mode.IsDir() && len(node.children) > 0:
+		err = syscall.ENOTEMPTY
+	}
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	m.size -= int64(len(node.data))
+	delete(dir.children, base)
+	dir.modTime = time.Now()
+	return nil
+}
+
+func (m *MemoryBackend) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.node("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if node.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	return node.target, nil
+}
+
+func (m *MemoryBackend) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, base, node, err := m.lookup(newname, false)
+	if err == nil && node != nil {
+		err = syscall.EEXIST
+	}
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	dir.children[base] = &memoryNode{mode: fs.ModeSymlink | 0777, modTime: time.Now(), target: oldname}
+	dir.modTime = time.Now()
+	return nil
+}
+
+// setModTime sets the modification time of the node at name, without following symlinks, for nodes
+// copied from elsewhere.
+func (m *MemoryBackend) setModTime(name string, modTime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.node("chtimes", name, false)
+	if err != nil {
+		return err
+	}
+	node.modTime = modTime
+	return nil
+}
+
+// setSource makes the content of the file at name, without following symlinks, be read from source.
+func (m *MemoryBackend) setSource(name string, source *memorySource) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.node("open", name, false)
+	if err != nil {
+		return err
+	}
+	if !node.mode.IsRegular() {
+		return &fs.PathError{Op: "open", Path: name, Err: syscall.EINVAL}
+	}
+	m.size -= int64(len(node.data))
+	node.data, node.source = nil, source
+	return nil
+}
+
+// info describes the node as an entry named name.
+func (n *memoryNode) info(name string) fs.FileInfo {
+	size := int64(len(n.data))
+	if n.source != nil {
+		size = n.source.size
+	}
+	if n.mode&fs.ModeSymlink != 0 {
+		size = int64(len(n.target))
+	}
+	return memoryInfo{name: name, size: size, mode: n.mode, modTime: n.modTime}
+}
+
+// memoryInfo describes a node of a MemoryBackend as it was when it was described.
+type memoryInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i memoryInfo) Name() string       { return i.name }
+func (i memoryInfo) Size() int64        { return i.size }
+func (i memoryInfo) Mode() fs.FileMode  { return i.mode }
+func (i memoryInfo) ModTime() time.Time { return i.modTime }
+func (i memoryInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i memoryInfo) Sys() interface{}   { return nil }
+
+// memoryFile is an open file of a MemoryBackend. It sees the writes of other open files at once.
+type memoryFile struct {
+	backend *MemoryBackend
+	node    *memoryNode
+	name    string
+	flag    int
+	offset  int
+	reader  io.ReadCloser // Content kept elsewhere, once read
+}
+
+func (f *memoryFile) Read(p []byte) (int, error) {
+	f.backend.mu.Lock()
+	source := f.node.source
+	f.backend.mu.Unlock()
+	if source != nil {
+		// Read without the lock, as the content may be slow to come
+		return f.readSource(source, p)
+	}
+	f.backend.mu.Lock()
+	defer f.backend.mu.Unlock()
+	if f.node.mode.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+	if f.flag&os.O_WRONLY != 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: syscall.EBADF}
+	}
+	if f.offset >= len(f.node.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += n
+	return n, nil
+}
+
+func (f *memoryFile) Write(p []byte) (int, error) {
+	f.backend.mu.Lock()
+	defer f.backend.mu.Unlock()
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = len(f.node.data)
+	}
+	if end := f.offset + len(p); end > len(f.node.data) {
+		grow := int64(end - len(f.node.data))
+		if m := f.backend; m.maxBytes != 0 && m.size+grow > m.maxBytes {
+			return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.ENOSPC}
+		}
+		f.backend.size += grow
+		f.node.data = append(f.node.data, make([]byte, end-len(f.node.data))...)
+	}
+	n := copy(f.node.data[f.offset:], p)
+	f.offset += n
+	f.node.modTime = time.Now()
+	return n, nil
+}
+
+// readSource reads content kept elsewhere, which it opens on the first read.
+func (f *memoryFile) readSource(source *memorySource, p []byte) (int, error) {
+	if f.reader == nil {
+		r, err := source.open()
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		f.reader = r
+	}
+	return f.reader.Read(p)
+}
+
+func (f *memoryFile) Close() error {
+	if f.reader != nil {
+		return f.reader.Close()
+	}
+	return nil
+}
+
+func (f *memoryFile) Stat() (fs.FileInfo, error) {
+	f.backend.mu.Lock()
+	defer f.backend.mu.Unlock()
+	return f.node.info(filepath.Base(f.name)), nil
+}
@@ -0,0 +1,218 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the buckets of the call latency histograms.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Error categories of failed calls
+const (
+	ErrorAccessDenied    = "access_denied"
+	ErrorNotFound        = "not_found"
+	ErrorInvalidArgument = "invalid_argument"
+	ErrorQuota           = "quota"
+	ErrorLimit           = "limit"
+	ErrorTimeout         = "timeout"
+	ErrorCanceled        = "canceled"
+	ErrorInternal        = "internal"
+	ErrorOther           = "other"
+)
+
+// Metrics collects statistics of tool calls and sessions, and exposes them in the Prometheus text format.
+type Metrics struct {
+	mu       sync.Mutex
+	tools    map[string]*toolMetrics
+	sessions int64
+}
+
+// toolMetrics are the statistics of the calls of one tool.
+type toolMetrics struct {
+	calls        int64
+	errors       map[string]int64
+	buckets      []int64 // Calls per latency bucket, the last one unbounded
+	latencySum   float64
+	bytesRead    int64
+	bytesWritten int64
+	walkEntries  int64
+}
+
+// NewMetrics creates empty metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{tools: map[string]*toolMetrics{}}
+}
+
+// Wrap returns a copy of t whose handler counts its calls, errors, latency, bytes and walked entries.
+func (m *Metrics) Wrap(t tester.ToolHandler) tester.ToolHandler {
+	name := t.Tool.Name
+	handler := t.Handler
+	m.mu.Lock()
+	m.tool(name)
+	m.mu.Unlock()
+	t.Handler = func(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		rec := &callRecord{}
+		result, err := handler(withCallRecord(ctx, rec), req, allowedDirs)
+		elapsed := time.Since(start).Seconds()
+		category := errorCategory(result, err)
+
+		rec.mu.Lock()
+		bytesRead, bytesWritten, walkEntries := rec.bytesRead, rec.bytesWritten, rec.walkEntries
+		rec.mu.Unlock()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		tm := m.tool(name)
+		tm.calls++
+		if category != "" {
+			tm.errors[category]++
+		}
+		bucket, _ := slices.BinarySearch(latencyBuckets, elapsed)
+		tm.buckets[bucket]++
+		tm.latencySum += elapsed
+		tm.bytesRead += bytesRead
+		tm.bytesWritten += bytesWritten
+		tm.walkEntries += walkEntries
+		return result, err
+	}
+	return t
+}
+
+// tool returns the statistics of a tool, creating them if needed. The caller must hold the lock.
+func (m *Metrics) tool(name string) *toolMetrics {
+	tm, ok := m.tools[name]
+	if !ok {
+		tm = &toolMetrics{errors: map[string]int64{}, buckets: make([]int64, len(latencyBuckets)+1)}
+		m.tools[name] = tm
+	}
+	return tm
+}
+
+// Register counts a new session. It is meant to be called by the server hooks.
+func (m *Metrics) Register(_ context.Context, _ server.ClientSession) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions++
+}
+
+// Forget counts the end of a session. It is meant to be called by the server hooks.
+func (m *Metrics) Forget(_ context.Context, _ server.ClientSession) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions--
+}
+
+// errorCategory classifies a failed call by its error, or returns "" if the call succeeded.
+// Handlers report most errors as text, so the text is matched against the messages they use.
+func errorCategory(result *mcp.CallToolResult, err error) string {
+	if err != nil {
+		return ErrorInternal
+	}
+	if result == nil || !result.IsError {
+		return ""
+	}
+	text := strings.ToLower(resultText(result))
+	switch {
+	case strings.HasPrefix(text, "access denied"):
+		return ErrorAccessDenied
+	case strings.Contains(text, "quota exceeded"):
+		return ErrorQuota
+	case strings.Contains(text, "exceeds the limit"), strings.Contains(text, "too large"):
+		return ErrorLimit
+	case strings.Contains(text, "deadline exceeded"):
+		return ErrorTimeout
+	case strings.Contains(text, "context canceled"):
+		return ErrorCanceled
+	case strings.Contains(text, "no such file"), strings.Contains(text, "not found"):
+		return ErrorNotFound
+	case strings.Contains(text, "must be"), strings.Contains(text, "is required"),
+		strings.Contains(text, "invalid"), strings.Contains(text, "missing"):
+		return ErrorInvalidArgument
+	}
+	return ErrorOther
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.Write(w)
+}
+
+// Write writes the metrics to w in the Prometheus text exposition format.
+func (m *Metrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b strings.Builder
+	names := make([]string, 0, len(m.tools))
+	for name := range m.tools {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	counter := func(metric, help string, value func(*toolMetrics) int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", metric, help, metric)
+		for _, name := range names {
+			fmt.Fprintf(&b, "%s{tool=%s} %d\n", metric, labelValue(name), value(m.tools[name]))
+		}
+	}
+
+	counter("mcp_fs_tool_calls_total", "Tool calls, including failed ones.",
+		func(tm *toolMetrics) int64 { return tm.calls })
+	fmt.Fprintf(&b, "# HELP mcp_fs_tool_errors_total Failed tool calls by category.\n# TYPE mcp_fs_tool_errors_total counter\n")
+	for _, name := range names {
+		tm := m.tools[name]
+		categories := make([]string, 0, len(tm.errors))
+		for category := range tm.errors {
+			categories = append(categories, category)
+		}
+		slices.Sort(categories)
+		for _, category := range categories {
+			fmt.Fprintf(&b, "mcp_fs_tool_errors_total{tool=%s,category=%s} %d\n",
+				labelValue(name), labelValue(category), tm.errors[category])
+		}
+	}
+	fmt.Fprintf(&b, "# HELP mcp_fs_tool_call_duration_seconds Latency of tool calls.\n# TYPE mcp_fs_tool_call_duration_seconds histogram\n")
+	for _, name := range names {
+		tm := m.tools[name]
+		var cumulative int64
+		for i, count := range tm.buckets {
+			cumulative += count
+			le := "+Inf"
+			if i < len(latencyBuckets) {
+				le = fmt.Sprint(latencyBuckets[i])
+			}
+			fmt.Fprintf(&b, "mcp_fs_tool_call_duration_seconds_bucket{tool=%s,le=%q} %d\n", labelValue(name), le, cumulative)
+		}
+		fmt.Fprintf(&b, "mcp_fs_tool_call_duration_seconds_sum{tool=%s} %g\n", labelValue(name), tm.latencySum)
+		fmt.Fprintf(&b, "mcp_fs_tool_call_duration_seconds_count{tool=%s} %d\n", labelValue(name), tm.calls)
+	}
+	counter("mcp_fs_read_bytes_total", "Bytes read from the filesystem by tool calls.",
+		func(tm *toolMetrics) int64 { return tm.bytesRead })
+	counter("mcp_fs_written_bytes_total", "Bytes written to the filesystem by tool calls.",
+		func(tm *toolMetrics) int64 { return tm.bytesWritten })
+	counter("mcp_fs_walk_entries_total", "Entries visited by the recursive walks of tool calls.",
+		func(tm *toolMetrics) int64 { return tm.walkEntries })
+	fmt.Fprintf(&b, "# HELP mcp_fs_active_sessions Client sessions currently connected.\n# TYPE mcp_fs_active_sessions gauge\n")
+	fmt.Fprintf(&b, "mcp_fs_active_sessions %d\n", m.sessions)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labelValueEscaper escapes label values as the text exposition format requires.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue quotes a label value.
+func labelValue(value string) string {
+	return `"` + labelValueEscaper.Replace(value) + `"`
+}
@@ -0,0 +1,73 @@
+package top
+
+import (
+	"context"
+	"github.com/mark3labs/mcp-go/mcp"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("hello"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	metrics := NewMetrics()
+	auditLog := NewAuditLog(&strings.Builder{})
+	handlers := map[string]func(context.Context, mcp.CallToolRequest, []string) (*mcp.CallToolResult, error){}
+	for _, tool := range Tools {
+		// Metrics and audit collect the same facts of a call independently
+		handlers[tool.Tool.Name] = metrics.Wrap(auditLog.Wrap(tool)).Handler
+	}
+	call := func(name string, args map[string]interface{}) {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = name
+		req.Params.Arguments = args
+		if _, err := handlers[name](context.Background(), req, []string{tempDir}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	call("read_file", map[string]interface{}{"path": testFile})
+	call("read_file", map[string]interface{}{"path": filepath.Join(tempDir, "missing.txt")})
+	call("read_file", map[string]interface{}{"path": "/etc/passwd"})
+	call("read_file", map[string]interface{}{})
+	call("write_file", map[string]interface{}{"path": filepath.Join(tempDir, "new.txt"), "content": "abc"})
+	call("directory_tree", map[string]interface{}{"path": tempDir})
+	metrics.Register(context.Background(), nil)
+	metrics.Register(context.Background(), nil)
+	metrics.Forget(context.Background(), nil)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", contentType)
+	}
+	output := recorder.Body.String()
+	for _, expected := range []string{
+		`mcp_fs_tool_calls_total{tool="read_file"} 4`,
+		`mcp_fs_tool_calls_total{tool="move_file"} 0`,
+		`mcp_fs_tool_errors_total{tool="read_file",category="not_found"} 1`,
+		`mcp_fs_tool_errors_total{tool="read_file",category="access_denied"} 1`,
+		`mcp_fs_tool_errors_total{tool="read_file",category="invalid_argument"} 1`,
+		`mcp_fs_tool_call_duration_seconds_bucket{tool="read_file",le="+Inf"} 4`,
+		`mcp_fs_tool_call_duration_seconds_count{tool="write_file"} 1`,
+		`mcp_fs_read_bytes_total{tool="read_file"} 5`,
+		`mcp_fs_written_bytes_total{tool="write_file"} 3`,
+		`mcp_fs_walk_entries_total{tool="directory_tree"} 2`,
+		"# TYPE mcp_fs_tool_call_duration_seconds histogram",
+		"mcp_fs_active_sessions 1",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in metrics, got:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, `tool="write_file",category=`) {
+		t.Errorf("Unexpected write_file error in metrics:\n%s", output)
+	}
+}
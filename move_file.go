@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/mark3labs/mcp-go/mcp"
-	"os"
 )
 
 func DefineMoveFileTool() mcp.Tool {
@@ -14,35 +13,58 @@ func DefineMoveFileTool() mcp.Tool {
 				"and rename them in a single operation. If the destination exists, the "+
 				"operation will fail. Works across different directories and can be used "+
 				"for simple renaming within the same directory. Both source and destination must be within allowed directories."),
-		mcp.WithString("source", mcp.Required(), mcp.Description("Source path")),
-		mcp.WithString("destination", mcp.Required(), mcp.Description("Destination path")),
+		mcp.WithReadOnlyHintAnnotation(false),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(false),
+		mcp.WithOpenWorldHintAnnotation(false),
+		withArguments[MoveFileArgs](),
 	)
 }
 
-func MoveFileHandler(_ context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
-	source, ok := req.Params.Arguments["source"].(string)
-	if !ok {
-		return mcp.NewToolResultError("source must be a string"), nil
-	}
-	dest, ok := req.Params.Arguments["destination"].(string)
-	if !ok {
-		return mcp.NewToolResultError("destination must be a string"), nil
+// MoveFileArgs are the arguments of move_file.
+type MoveFileArgs struct {
+	Source      string `arg:"source,required" desc:"Source path"`
+	Destination string `arg:"destination,required" desc:"Destination path"`
+}
+
+func MoveFileHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[MoveFileArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-	validSource, err := validatePath(source, allowedDirs)
+	validSource, err := validatePath(ctx, args.Source, allowedDirs)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	validDest, err := validatePath(dest, allowedDirs)
+	validDest, err := validatePath(ctx, args.Destination, allowedDirs)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
+	for _, p := range []string{validSource, validDest} {
+		if err := checkWritable(ctx, p); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+	defer lockWrites(ctx)()
 	// Check if destination exists.
-	// Not atomic, but os.Rename cannot generally be expected to be anyway.
-	if _, err := os.Stat(validDest); err == nil {
+	// Not atomic, but a rename cannot generally be expected to be anyway.
+	if _, err := backendFromContext(ctx).Stat(validDest); err == nil {
 		return mcp.NewToolResultError("Destination already exists"), nil
 	}
-	if err := os.Rename(validSource, validDest); err != nil {
+	if err := ctx.Err(); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	refund, err := chargeMove(ctx, validSource, validDest)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	done := noteChange(ctx, validSource)
+	if err := traced(ctx, "fs.rename", validSource, func() error {
+		return backendFromContext(ctx).Rename(validSource, validDest)
+	}); err != nil {
+		refund()
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	return mcp.NewToolResultText(fmt.Sprintf("Successfully moved %s to %s", source, dest)), nil
+	done(validDest)
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully moved %s to %s", args.Source, args.Destination)), nil
 }
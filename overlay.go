@@ -0,0 +1,967 @@
+package top
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/djherbis/times"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Overlays gives each session a copy-on-write layer over the backend, so that agents can try changes
+// without touching the allowed directories. Writes, edits, moves and removals go to the layer of the
+// session, held in memory, while reads fall through to the backend for what the layer does not
+// change. The session reviews its pending changes with overlay_diff and applies them with
+// overlay_commit or drops them with overlay_discard.
+//
+// Each layer holds up to a number of bytes of file content, beyond which writing to it fails with
+// syscall.ENOSPC, as on a full disk.
+type Overlays struct {
+	mu       sync.Mutex
+	layers   map[string]*overlayBackend
+	maxBytes int64
+}
+
+// overlayTools are the tools of overlay mode, which servers only expose in that mode.
+var overlayTools = []string{"overlay_diff", "overlay_commit", "overlay_discard"}
+
+// NewOverlays creates an empty set of overlays whose layers hold up to maxBytes of file content each,
+// or any amount if it is 0.
+func NewOverlays(maxBytes int64) *Overlays {
+	return &Overlays{layers: map[string]*overlayBackend{}, maxBytes: maxBytes}
+}
+
+// Wrap returns a copy of t whose handler operates on the overlay of its session. Calls made without a
+// client session share the overlay of the session "".
+func (o *Overlays) Wrap(t tester.ToolHandler) tester.ToolHandler {
+	handler := t.Handler
+	t.Handler = func(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+		return handler(withBackend(ctx, o.layer(sessionID(ctx), backendFromContext(ctx))), req, allowedDirs)
+	}
+	return t
+}
+
+// layer returns the overlay of a session over lower, creating it on first use.
+func (o *Overlays) layer(session string, lower Backend) *overlayBackend {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	layer, ok := o.layers[session]
+	if !ok {
+		layer = newOverlayBackend(lower, o.maxBytes)
+		o.layers[session] = layer
+	}
+	return layer
+}
+
+// Forget drops the pending changes of a session that has ended.
+func (o *Overlays) Forget(_ context.Context, session server.ClientSession) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.layers, session.SessionID())
+}
+
+// overlayBackend is the overlay of a session. Its layer may be used by several calls at once, so the
+// backend serializes them.
+type overlayBackend struct {
+	mu    sync.Mutex
+	layer *overlayLayer
+}
+
+func newOverlayBackend(lower Backend, maxBytes int64) *overlayBackend {
+	return &overlayBackend{layer: newOverlayLayer(lower, maxBytes)}
+}
+
+func (o *overlayBackend) Stat(name string) (fs.FileInfo, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.layer.Stat(name)
+}
+
+func (o *overlayBackend) Lstat(name string) (fs.FileInfo, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.layer.Lstat(name)
+}
+
+func (o *overlayBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.layer.ReadDir(name)
+}
+
+func (o *overlayBackend) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.layer.OpenFile(name, flag, perm)
+}
+
+func (o *overlayBackend) Mkdir(name string, perm fs.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.layer.Mkdir(name, perm)
+}
+
+func (o *overlayBackend) Rename(oldpath, newpath string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.layer.Rename(oldpath, newpath)
+}
+
+func (o *overlayBackend) Remove(name string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.layer.Remove(name)
+}
+
+func (o *overlayBackend) Readlink(name string) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.layer.Readlink(name)
+}
+
+func (o *overlayBackend) Symlink(oldname, newname string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.layer.Symlink(oldname, newname)
+}
+
+// Times returns the times known to the lower backend of what the overlay leaves as it is, and reports
+// the modification time as the access time of the rest.
+func (o *overlayBackend) Times(name string) (times.Timespec, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if tb, ok := o.layer.lower.(timesBackend); ok && !o.layer.inUpper(name) && !o.layer.hidden(name) {
+		return tb.Times(name)
+	}
+	info, err := o.layer.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return modTimes(info.ModTime()), nil
+}
+
+// changes returns the pending changes of the overlay.
+func (o *overlayBackend) changes() ([]overlayChange, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.layer.changes()
+}
+
+// commit applies the pending changes to the lower backend, then drops them. It refuses to if any of
+// them conflicts with a change made to the lower backend since. If it fails midway, the error lists the
+// changes that were applied, and the others stay pending.
+func (o *overlayBackend) commit(ctx context.Context) ([]overlayChange, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	changes, err := o.layer.changes()
+	if err != nil {
+		return nil, err
+	}
+	var conflicts []string
+	for _, c := range changes {
+		if c.conflict {
+			conflicts = append(conflicts, c.path)
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("nothing was committed, as these paths changed outside the overlay since this session copied them: %s",
+			strings.Join(conflicts, ", "))
+	}
+	applied, err := o.layer.apply(ctx, changes)
+	if err != nil && len(applied) > 0 {
+		paths := make([]string, 0, len(applied))
+		for _, c := range applied {
+			paths = append(paths, c.path)
+		}
+		return nil, fmt.Errorf("%w; %d of %d changes were committed before, and are no longer pending: %s",
+			err, len(applied), len(changes), strings.Join(paths, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.layer = newOverlayLayer(o.layer.lower, o.layer.upper.maxBytes)
+	return changes, nil
+}
+
+// discard drops the pending changes and returns how many there were.
+func (o *overlayBackend) discard() (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	changes, err := o.layer.changes()
+	if err != nil {
+		return 0, err
+	}
+	o.layer = newOverlayLayer(o.layer.lower, o.layer.upper.maxBytes)
+	return len(changes), nil
+}
+
+// errOverlayDisabled is returned by the overlay tools when the call does not operate on an overlay.
+var errOverlayDisabled = errors.New("overlay mode is not enabled")
+
+// overlayFromContext returns the overlay the call operates on.
+func overlayFromContext(ctx context.Context) (*overlayBackend, error) {
+	if o, ok := backendFromContext(ctx).(*overlayBackend); ok {
+		return o, nil
+	}
+	return nil, errOverlayDisabled
+}
+
+// overlayLayer is a copy-on-write layer over a lower backend, whose changes are kept in an upper layer
+// in memory. Files and directories are copied up from the lower backend before they change. Removed
+// paths are recorded as whiteouts, which hide the lower backend at and below them; a directory
+// created over a whiteout is opaque, and hides what the lower backend has below it. It is not safe
+// for concurrent use.
+//
+// The layer records what the lower backend has at each path when it first depends on it, that is when
+// the path is copied up, created or hidden, so that changes made to the lower backend since are found
+// as conflicts rather than reverted by a commit.
+type overlayLayer struct {
+	lower     Backend
+	upper     *MemoryBackend
+	whiteouts map[string]bool
+	opaque    map[string]bool
+	stamps    map[string]overlayStamp
+}
+
+func newOverlayLayer(lower Backend, maxBytes int64) *overlayLayer {
+	return &overlayLayer{
+		lower:     lower,
+		upper:     newLimitedMemoryBackend(maxBytes),
+		whiteouts: map[string]bool{},
+		opaque:    map[string]bool{},
+		stamps:    map[string]overlayStamp{},
+	}
+}
+
+// remember records what the lower backend has at name, unless the layer already depends on it. Paths
+// without a record are those the lower backend did not have when the layer came to hide them.
+func (l *overlayLayer) remember(name string) error {
+	if _, ok := l.stamps[name]; ok {
+		return nil
+	}
+	stamp, err := stampOf(l.lower, name)
+	if err != nil {
+		return err
+	}
+	l.stamps[name] = stamp
+	return nil
+}
+
+// hidden reports whether the lower backend is hidden at name by a whiteout at or above it, or by an
+// opaque directory above it.
+func (l *overlayLayer) hidden(name string) bool {
+	for p := name; ; p = filepath.Dir(p) {
+		if l.whiteouts[p] || (p != name && l.opaque[p]) {
+			return true
+		}
+		if filepath.Dir(p) == p {
+			return false
+		}
+	}
+}
+
+// inUpper reports whether the upper layer decides what is at name: it has it, or a parent of it is
+// not a directory there.
+func (l *overlayLayer) inUpper(name string) bool {
+	_, err := l.upper.Lstat(name)
+	return err == nil || !errors.Is(err, fs.ErrNotExist)
+}
+
+func (l *overlayLayer) Stat(name string) (fs.FileInfo, error) {
+	return l.stat(name, 0)
+}
+
+// stat follows the symlinks of the upper layer, which may point to the lower backend.
+func (l *overlayLayer) stat(name string, links int) (fs.FileInfo, error) {
+	if !l.inUpper(name) {
+		if l.hidden(name) {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: syscall.ENOENT}
+		}
+		return l.lower.Stat(name)
+	}
+	info, err := l.upper.Lstat(name)
+	if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		return info, err
+	}
+	if links >= maxMemorySymlinks {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: syscall.ELOOP}
+	}
+	target, err := l.upper.Readlink(name)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(name), target)
+	}
+	return l.stat(target, links+1)
+}
+
+func (l *overlayLayer) Lstat(name string) (fs.FileInfo, error) {
+	if l.inUpper(name) {
+		return l.upper.Lstat(name)
+	}
+	if l.hidden(name) {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: syscall.ENOENT}
+	}
+	return l.lower.Lstat(name)
+}
+
+// ReadDir merges the entries of both layers, those of the upper layer taking precedence.
+func (l *overlayLayer) ReadDir(name string) ([]fs.DirEntry, error) {
+	info, err := l.Stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: underlyingError(err)}
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: syscall.ENOTDIR}
+	}
+	merged := map[string]fs.DirEntry{}
+	if lower, err := l.lower.ReadDir(name); err == nil {
+		for _, entry := range lower {
+			if !l.hidden(filepath.Join(name, entry.Name())) {
+				merged[entry.Name()] = entry
+			}
+		}
+	}
+	if upper, err := l.upper.ReadDir(name); err == nil {
+		for _, entry := range upper {
+			merged[entry.Name()] = entry
+		}
+	}
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, entry := range merged {
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+// OpenFile opens files for reading where they are, and copies them up before opening them for writing.
+func (l *overlayLayer) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE) == 0 {
+		if l.inUpper(name) {
+			return l.upper.OpenFile(name, flag, perm)
+		}
+		if l.hidden(name) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.ENOENT}
+		}
+		return l.lower.OpenFile(name, flag, perm)
+	}
+	info, err := l.Stat(name)
+	switch {
+	case err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EEXIST}
+	case err == nil && info.IsDir():
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	case err != nil && (flag&os.O_CREATE == 0 || !errors.Is(err, fs.ErrNotExist)):
+		return nil, &fs.PathError{Op: "open", Path: name, Err: underlyingError(err)}
+	case err != nil:
+		if err := l.checkParent(name); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	if err := l.copyUp(name, flag&os.O_TRUNC == 0); err != nil {
+		return nil, err
+	}
+	delete(l.whiteouts, name)
+	return l.upper.OpenFile(name, flag&^os.O_EXCL, perm)
+}
+
+// checkParent returns the error of creating an entry at name if its parent is not a directory.
+func (l *overlayLayer) checkParent(name string) error {
+	info, err := l.Stat(filepath.Dir(name))
+	if err != nil {
+		return underlyingError(err)
+	}
+	if !info.IsDir() {
+		return syscall.ENOTDIR
+	}
+	return nil
+}
+
+// copyUp copies name to the upper layer, with its parents, unless it is already there. Files get their
+// content only if data is set, as they are about to be truncated otherwise. Only the parents are
+// copied if the lower backend does not have name.
+func (l *overlayLayer) copyUp(name string, data bool) error {
+	if _, err := l.upper.Lstat(name); err == nil {
+		return nil
+	}
+	if parent := filepath.Dir(name); parent != name {
+		if err := l.copyUp(parent, false); err != nil {
+			return err
+		}
+	}
+	if l.hidden(name) {
+		return nil
+	}
+	if err := l.remember(name); err != nil {
+		return err
+	}
+	info, err := l.lower.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.IsDir():
+		return l.upper.Mkdir(name, info.Mode().Perm())
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := l.lower.Readlink(name)
+		if err != nil {
+			return err
+		}
+		return l.upper.Symlink(target, name)
+	case !data:
+		return writeFile(l.upper, name, nil, info.Mode().Perm())
+	case !l.upper.fits(info.Size()):
+		// Checked before reading the file, which may be too large to hold
+		return &fs.PathError{Op: "open", Path: name, Err: syscall.ENOSPC}
+	}
+	content, err := readAll(l.lower, name)
+	if err != nil {
+		return err
+	}
+	return writeFile(l.upper, name, content, info.Mode().Perm())
+}
+
+func (l *overlayLayer) Mkdir(name string, perm fs.FileMode) error {
+	if _, err := l.Lstat(name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: syscall.EEXIST}
+	}
+	if err := l.checkParent(name); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	if err := l.copyUp(filepath.Dir(name), false); err != nil {
+		return err
+	}
+	if !l.hidden(name) {
+		if err := l.remember(name); err != nil {
+			return err
+		}
+	}
+	if err := l.upper.Mkdir(name, perm); err != nil {
+		return err
+	}
+	if l.whiteouts[name] {
+		delete(l.whiteouts, name)
+		l.opaque[name] = true
+	}
+	return nil
+}
+
+// Rename copies the tree at oldpath to newpath and removes the original, as entries cannot be moved
+// out of the lower backend.
+func (l *overlayLayer) Rename(oldpath, newpath string) error {
+	fail := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: underlyingError(err)}
+	}
+	info, err := l.Lstat(oldpath)
+	if err != nil {
+		return fail(err)
+	}
+	if filepath.Dir(oldpath) == oldpath || filepath.Dir(newpath) == newpath {
+		return fail(syscall.EBUSY)
+	}
+	if oldpath == newpath {
+		return nil
+	}
+	if info.IsDir() && isWithin(newpath, oldpath) {
+		return fail(syscall.EINVAL)
+	}
+	existing, err := l.Lstat(newpath)
+	switch {
+	case err == nil && info.IsDir() && !existing.IsDir():
+		return fail(syscall.ENOTDIR)
+	case err == nil && !info.IsDir() && existing.IsDir():
+		return fail(syscall.EISDIR)
+	case err == nil && existing.IsDir():
+		entries, err := l.ReadDir(newpath)
+		if err != nil {
+			return fail(err)
+		}
+		if len(entries) > 0 {
+			return fail(syscall.ENOTEMPTY)
+		}
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return fail(err)
+	case err != nil:
+		if err := l.checkParent(newpath); err != nil {
+			return fail(err)
+		}
+	}
+	// The tree is copied under a staging name first and only then takes the place of newpath, so that
+	// a copy that fails, as when the layer is full, leaves both paths as they were
+	staging, err := l.stagingName(newpath)
+	if err != nil {
+		return fail(err)
+	}
+	if err := l.copyTree(oldpath, staging); err != nil {
+		l.dropStaging(staging)
+		return fail(err)
+	}
+	if err := l.swapIn(staging, newpath, info.IsDir()); err != nil {
+		l.dropStaging(staging)
+		return fail(err)
+	}
+	if err := l.removeTree(oldpath); err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+// stagingName returns an unused name beside name, which neither the overlay nor the lower backend has.
+func (l *overlayLayer) stagingName(name string) (string, error) {
+	for i := 0; ; i++ {
+		staging := filepath.Join(filepath.Dir(name), fmt.Sprintf(".%s.overlay-%d", filepath.Base(name), i))
+		free := true
+		for _, b := range []Backend{l, l.lower} {
+			_, err := b.Lstat(staging)
+			if err == nil {
+				free = false
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+		}
+		if free {
+			return staging, nil
+		}
+	}
+}
+
+// dropStaging removes what a rename copied under a staging name, along with what the layer recorded
+// about it. The name is unused in the lower backend, so only the upper layer holds it.
+func (l *overlayLayer) dropStaging(staging string) {
+	if _, err := l.upper.Lstat(staging); err == nil {
+		_ = l.removeTree(staging)
+	}
+	for path := range l.stamps {
+		if isWithin(path, staging) {
+			delete(l.stamps, path)
+		}
+	}
+}
+
+// swapIn puts the tree copied under a staging name in the place of name, removing what name held.
+func (l *overlayLayer) swapIn(staging, name string, isDir bool) error {
+	if !l.hidden(name) {
+		if err := l.remember(name); err != nil {
+			return err
+		}
+	}
+	if _, err := l.Lstat(name); err == nil {
+		if err := l.Remove(name); err != nil {
+			return err
+		}
+	}
+	if err := l.upper.Rename(staging, name); err != nil {
+		return err
+	}
+	for path := range l.stamps {
+		if isWithin(path, staging) {
+			delete(l.stamps, path)
+		}
+	}
+	if l.whiteouts[name] {
+		delete(l.whiteouts, name)
+		if isDir {
+			l.opaque[name] = true
+		}
+	}
+	return nil
+}
+
+// copyTree copies the entry at oldpath, and everything below it, to newpath.
+func (l *overlayLayer) copyTree(oldpath, newpath string) error {
+	info, err := l.Lstat(oldpath)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.IsDir():
+		if err := l.Mkdir(newpath, info.Mode().Perm()); err != nil {
+			return err
+		}
+		entries, err := l.ReadDir(oldpath)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := l.copyTree(filepath.Join(oldpath, entry.Name()), filepath.Join(newpath, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := l.Readlink(oldpath)
+		if err != nil {
+			return err
+		}
+		return l.Symlink(target, newpath)
+	}
+	if !l.upper.fits(info.Size()) {
+		return syscall.ENOSPC
+	}
+	content, err := readAll(l, oldpath)
+	if err != nil {
+		return err
+	}
+	return writeFile(l, newpath, content, info.Mode().Perm())
+}
+
+// removeTree removes the entry at name and everything below it.
+func (l *overlayLayer) removeTree(name string) error {
+	info, err := l.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		entries, err := l.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := l.removeTree(filepath.Join(name, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return l.Remove(name)
+}
+
+// Remove removes name from the upper layer and hides it in the lower backend.
+func (l *overlayLayer) Remove(name string) error {
+	info, err := l.Lstat(name)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: underlyingError(err)}
+	}
+	if filepath.Dir(name) == name {
+		return &fs.PathError{Op: "remove", Path: name, Err: syscall.EBUSY}
+	}
+	if info.IsDir() {
+		if entries, err := l.ReadDir(name); err != nil || len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	if _, err := l.upper.Lstat(name); err == nil {
+		if err := l.upper.Remove(name); err != nil {
+			return err
+		}
+	}
+	if _, err := l.lower.Lstat(name); err == nil && !l.hidden(name) {
+		if err := l.remember(name); err != nil {
+			return err
+		}
+		l.whiteouts[name] = true
+	}
+	// The marks below name are covered by its whiteout, or were of entries that are gone with it
+	delete(l.opaque, name)
+	for _, marks := range []map[string]bool{l.whiteouts, l.opaque} {
+		for p := range marks {
+			if p != name && isWithin(p, name) {
+				delete(marks, p)
+			}
+		}
+	}
+	return nil
+}
+
+func (l *overlayLayer) Readlink(name string) (string, error) {
+	if l.inUpper(name) {
+		return l.upper.Readlink(name)
+	}
+	if l.hidden(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: syscall.ENOENT}
+	}
+	return l.lower.Readlink(name)
+}
+
+func (l *overlayLayer) Symlink(oldname, newname string) error {
+	fail := func(err error) error {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	if _, err := l.Lstat(newname); err == nil {
+		return fail(syscall.EEXIST)
+	}
+	if err := l.checkParent(newname); err != nil {
+		return fail(err)
+	}
+	if err := l.copyUp(filepath.Dir(newname), false); err != nil {
+		return err
+	}
+	if !l.hidden(newname) {
+		if err := l.remember(newname); err != nil {
+			return err
+		}
+	}
+	if err := l.upper.Symlink(oldname, newname); err != nil {
+		return err
+	}
+	delete(l.whiteouts, newname)
+	return nil
+}
+
+// overlayEntry is what a path holds in one of the layers, for comparing them. The content of files is
+// not kept, but compared and copied as needed, so that changes cost no more memory than the layer.
+type overlayEntry struct {
+	exists bool
+	mode   fs.FileMode
+	size   int64  // Size of files
+	target string // Target of symlinks
+}
+
+// entryOf describes what b has at name.
+func entryOf(b Backend, name string) (overlayEntry, error) {
+	info, err := b.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return overlayEntry{}, nil
+	}
+	if err != nil {
+		return overlayEntry{}, err
+	}
+	entry := overlayEntry{exists: true, mode: info.Mode()}
+	switch {
+	case info.IsDir():
+	case info.Mode()&fs.ModeSymlink != 0:
+		entry.target, err = b.Readlink(name)
+	default:
+		entry.size = info.Size()
+	}
+	return entry, err
+}
+
+// sameContent reports whether the files at name in a and b have the same content, reading them a
+// block at a time.
+func sameContent(a, b Backend, name string) (bool, error) {
+	fa, err := openFile(a, name)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := openFile(b, name)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+	bufA, bufB := make([]byte, 32*1024), make([]byte, 32*1024)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		for _, err := range []error{errA, errB} {
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return false, err
+			}
+		}
+		if errA != nil || errB != nil {
+			return errA != nil && errB != nil, nil
+		}
+	}
+}
+
+// overlayStamp is what the lower backend has at a path, to tell whether it changed. Directories are
+// only told apart by their type, as their times change with their entries.
+type overlayStamp struct {
+	exists  bool
+	mode    fs.FileMode
+	size    int64
+	modTime int64
+}
+
+// stampOf returns the stamp of what b has at name.
+func stampOf(b Backend, name string) (overlayStamp, error) {
+	info, err := b.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return overlayStamp{}, nil
+	}
+	if err != nil {
+		return overlayStamp{}, err
+	}
+	if info.IsDir() {
+		return overlayStamp{exists: true, mode: fs.ModeDir}, nil
+	}
+	return overlayStamp{exists: true, mode: info.Mode(), size: info.Size(), modTime: info.ModTime().UnixNano()}, nil
+}
+
+// replaces reports whether an entry takes the place of the entry before, which must be removed first.
+// Files are written over and directories kept if they stay so.
+func (e overlayEntry) replaces(before overlayEntry) bool {
+	return before.exists && (!e.exists || e.mode.Type() != before.mode.Type() || before.mode&fs.ModeSymlink != 0)
+}
+
+// overlayChange is a pending change of a path, from what the lower backend has to what the overlay has.
+// It conflicts if the lower backend changed at the path since the layer came to depend on it.
+type overlayChange struct {
+	path          string
+	before, after overlayEntry
+	conflict      bool
+}
+
+// changes returns the pending changes in lexical order of their paths: what the upper layer holds
+// that differs from the lower backend, and what the whiteouts and opaque directories hide.
+func (l *overlayLayer) changes() ([]overlayChange, error) {
+	paths := map[string]bool{}
+	err := walkDir(l.upper, string(filepath.Separator), func(path string, _ fs.DirEntry, err error) error {
+		paths[path] = true
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, marks := range []map[string]bool{l.whiteouts, l.opaque} {
+		for root := range marks {
+			err := walkDir(l.lower, root, func(path string, _ fs.DirEntry, err error) error {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				paths[path] = true
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	var changes []overlayChange
+	for _, path := range slices.Sorted(maps.Keys(paths)) {
+		before, err := entryOf(l.lower, path)
+		if err != nil {
+			return nil, err
+		}
+		after, err := entryOf(l, path)
+		if err != nil {
+			return nil, err
+		}
+		changed := before.exists != after.exists || before.mode.Type() != after.mode.Type() ||
+			before.target != after.target || before.size != after.size
+		if !changed && after.exists && after.mode.IsRegular() {
+			same, err := sameContent(l.lower, l, path)
+			if err != nil {
+				return nil, err
+			}
+			changed = !same
+		}
+		if changed {
+			stamp, err := stampOf(l.lower, path)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, overlayChange{path: path, before: before, after: after, conflict: stamp != l.stamps[path]})
+		}
+	}
+	return changes, nil
+}
+
+// apply makes changes to the lower backend and returns those it made. What they replace is removed
+// first, deepest first, so that directories are empty when their turn comes; what they add is then
+// written, parents first. The files written and removed are audited as changes of the call. The layer
+// then depends on what each step left in the lower backend, even one that failed, and drops the
+// changes made, so that if applying fails midway only the others stay pending.
+func (l *overlayLayer) apply(ctx context.Context, changes []overlayChange) ([]overlayChange, error) {
+	ctx = withBackend(ctx, l.lower)
+	var applied []overlayChange
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		if !c.after.replaces(c.before) {
+			continue
+		}
+		done := noteChange(ctx, c.path)
+		err := l.lower.Remove(c.path)
+		if err == nil {
+			done(c.path)
+		}
+		if err := l.restamp(c.path, err); err != nil {
+			return applied, err
+		}
+		if !c.after.exists {
+			l.settle(c)
+			applied = append(applied, c)
+		}
+	}
+	for _, c := range changes {
+		if !c.after.exists {
+			continue
+		}
+		var err error
+		done := noteChange(ctx, c.path)
+		switch {
+		case c.after.mode.IsDir():
+			err = l.lower.Mkdir(c.path, c.after.mode.Perm())
+		case c.after.mode&fs.ModeSymlink != 0:
+			err = l.lower.Symlink(c.after.target, c.path)
+		default:
+			var n int64
+			n, err = copyContent(l.lower, l, c.path, c.after.mode.Perm())
+			noteWritten(ctx, int(n))
+		}
+		if err == nil {
+			done(c.path)
+		}
+		if err := l.restamp(c.path, err); err != nil {
+			return applied, err
+		}
+		l.settle(c)
+		applied = append(applied, c)
+	}
+	slices.SortFunc(applied, func(a, b overlayChange) int { return strings.Compare(a.path, b.path) })
+	return applied, nil
+}
+
+// restamp records what the lower backend has at name after a step of apply changed it, and returns
+// the error of the step, if any, or of recording it.
+func (l *overlayLayer) restamp(name string, err error) error {
+	delete(l.stamps, name)
+	if stampErr := l.remember(name); err == nil {
+		err = stampErr
+	}
+	return err
+}
+
+// settle drops a change that was applied from the layer, giving back the space of its content. The
+// lower backend now has what the change made, so its whiteout is no longer needed, and neither is the
+// upper copy of a file or symlink, unless a directory above hides the lower backend. Directories stay,
+// as they may hold changes still pending.
+func (l *overlayLayer) settle(c overlayChange) {
+	delete(l.whiteouts, c.path)
+	if c.after.exists && !c.after.mode.IsDir() && !l.hidden(c.path) {
+		_ = l.upper.Remove(c.path)
+	}
+}
+
+// readAll reads a whole file of b.
+func readAll(b Backend, name string) ([]byte, error) {
+	f, err := openFile(b, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// underlyingError returns the error of the system call that err reports, such as syscall.ENOENT.
+func underlyingError(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return linkErr.Err
+	}
+	return err
+}
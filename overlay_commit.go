@@ -0,0 +1,45 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"strings"
+)
+
+func DefineOverlayCommitTool() mcp.Tool {
+	return mcp.NewTool("overlay_commit",
+		mcp.WithDescription(
+			"Apply the changes this session made in overlay mode to the allowed directories, "+
+				"overwriting and removing files as the changes require, and start over with no pending changes. "+
+				"Review the changes with overlay_diff first. Nothing is applied if any path was changed outside "+
+				"the overlay since this session copied it. If applying fails midway, "+
+				"the error lists the changes that were applied, and the others stay pending."),
+		mcp.WithReadOnlyHintAnnotation(false),
+		mcp.WithDestructiveHintAnnotation(true),
+		mcp.WithIdempotentHintAnnotation(false),
+		mcp.WithOpenWorldHintAnnotation(false),
+	)
+}
+
+func OverlayCommitHandler(ctx context.Context, _ mcp.CallToolRequest, _ []string) (*mcp.CallToolResult, error) {
+	overlay, err := overlayFromContext(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := ctx.Err(); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	changes, err := overlay.commit(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if len(changes) == 0 {
+		return mcp.NewToolResultText("No pending changes"), nil
+	}
+	lines := make([]string, 0, len(changes))
+	for _, c := range changes {
+		lines = append(lines, describeChange(c))
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Committed %d changes:\n%s", len(changes), strings.Join(lines, "\n"))), nil
+}
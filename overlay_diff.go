@@ -0,0 +1,108 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"io/fs"
+	"strings"
+)
+
+func DefineOverlayDiffTool() mcp.Tool {
+	return mcp.NewTool("overlay_diff",
+		mcp.WithDescription(
+			"Show the changes this session made in overlay mode, which are pending until committed. "+
+				"Each created, modified or removed file, directory or symlink is described on a line, "+
+				"followed for created and modified files by a unified diff of their content. "+
+				"Changes marked as conflicts are of paths that were changed outside the overlay since this session "+
+				"copied them, which overlay_commit refuses to overwrite. "+
+				"Use this to review changes before applying them with overlay_commit or dropping them with overlay_discard."),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+	)
+}
+
+func OverlayDiffHandler(ctx context.Context, _ mcp.CallToolRequest, _ []string) (*mcp.CallToolResult, error) {
+	overlay, err := overlayFromContext(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	changes, err := overlay.changes()
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if len(changes) == 0 {
+		return mcp.NewToolResultText("No pending changes"), nil
+	}
+	var b strings.Builder
+	for _, c := range changes {
+		b.WriteString(describeChange(c) + "\n")
+		if !c.after.exists || !c.after.mode.IsRegular() {
+			continue
+		}
+		diff, err := overlay.contentDiff(ctx, c)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		b.WriteString(diff)
+	}
+	return mcp.NewToolResultText(b.String()), nil
+}
+
+// describeChange describes a pending change on a line, without its newline.
+func describeChange(c overlayChange) string {
+	kind := func(e overlayEntry) string {
+		switch {
+		case e.mode.IsDir():
+			return "directory"
+		case e.mode&fs.ModeSymlink != 0:
+			return "symlink"
+		}
+		return "file"
+	}
+	var line string
+	switch {
+	case !c.before.exists:
+		line = fmt.Sprintf("Created %s %s", kind(c.after), c.path)
+	case !c.after.exists:
+		line = fmt.Sprintf("Removed %s %s", kind(c.before), c.path)
+	case kind(c.before) != kind(c.after):
+		line = fmt.Sprintf("Replaced %s %s with a %s", kind(c.before), c.path, kind(c.after))
+	default:
+		line = fmt.Sprintf("Modified %s %s", kind(c.after), c.path)
+	}
+	if c.after.mode&fs.ModeSymlink != 0 {
+		line += " -> " + c.after.target
+	}
+	if c.conflict {
+		line += " (conflict: changed outside the overlay since this session copied it)"
+	}
+	return line
+}
+
+// contentDiff returns the unified diff of a file the overlay created or modified, against what the
+// lower backend has at its path. Files beyond the per-file limit of the call are not read, and the
+// content of files that are only removed is not shown, so that a diff costs no more than its files.
+func (o *overlayBackend) contentDiff(ctx context.Context, c overlayChange) (string, error) {
+	if maxBytes := limitsFromContext(ctx).MaxFileBytes; maxBytes > 0 && max(c.before.size, c.after.size) > maxBytes {
+		return fmt.Sprintf("[content not shown: the file exceeds the limit of %d bytes]\n", maxBytes), nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// Entries that are not files have no content
+	var before []byte
+	if c.before.exists && c.before.mode.IsRegular() {
+		var err error
+		if before, err = readAll(o.layer.lower, c.path); err != nil {
+			return "", err
+		}
+	}
+	after, err := readAll(o.layer, c.path)
+	if err != nil {
+		return "", err
+	}
+	noteRead(ctx, len(before)+len(after))
+	return createUnifiedDiff(string(before), string(after), c.path)
+}
@@ -0,0 +1,31 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func DefineOverlayDiscardTool() mcp.Tool {
+	return mcp.NewTool("overlay_discard",
+		mcp.WithDescription(
+			"Drop the changes this session made in overlay mode, leaving the allowed directories as they are. "+
+				"Subsequent reads see the allowed directories again."),
+		mcp.WithReadOnlyHintAnnotation(false),
+		mcp.WithDestructiveHintAnnotation(true),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+	)
+}
+
+func OverlayDiscardHandler(ctx context.Context, _ mcp.CallToolRequest, _ []string) (*mcp.CallToolResult, error) {
+	overlay, err := overlayFromContext(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	count, err := overlay.discard()
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Discarded %d pending changes", count)), nil
+}
@@ -0,0 +1,289 @@
+package top
+
+import (
+	"context"
+	"errors"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestOverlays(t *testing.T) {
+	tempDir := t.TempDir()
+	for name, content := range map[string]string{
+		"keep.txt":      "one\ntwo\n",
+		"gone.txt":      "bye\n",
+		"sub/inner.txt": "inner\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(tempDir, name)), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	overlays := NewOverlays(0)
+	call := func(t *testing.T, name string, args map[string]interface{}, middlewares ...tester.Middleware) (string, bool) {
+		t.Helper()
+		_, client := tester.BypassFactory(Tools, middlewares...)(context.Background(), []string{tempDir})
+		req := mcp.CallToolRequest{}
+		req.Params.Name = name
+		req.Params.Arguments = args
+		result, err := client.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return resultText(result), result.IsError
+	}
+	run := func(t *testing.T, name string, args map[string]interface{}, expected string) {
+		t.Helper()
+		text, isError := call(t, name, args, overlays.Wrap)
+		if isError || !strings.Contains(text, expected) {
+			t.Fatalf("Expected %s to return %q, got %q", name, expected, text)
+		}
+	}
+	assertDisk := func(t *testing.T, name, expected string) {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(tempDir, name))
+		if expected == "" && !os.IsNotExist(err) {
+			t.Errorf("Expected %s not to exist on disk, got %q, %v", name, data, err)
+		} else if expected != "" && string(data) != expected {
+			t.Errorf("Expected %s to contain %q on disk, got %q, %v", name, expected, data, err)
+		}
+	}
+
+	t.Run("Changes stay in the overlay", func(t *testing.T) {
+		run(t, "write_file", map[string]interface{}{"path": filepath.Join(tempDir, "new.txt"), "content": "new\n"}, "Successfully wrote")
+		run(t, "edit_file", map[string]interface{}{"path": filepath.Join(tempDir, "keep.txt"),
+			"edits": []interface{}{map[string]interface{}{"oldText": "two", "newText": "three"}}}, "+three")
+		run(t, "move_file", map[string]interface{}{"source": filepath.Join(tempDir, "gone.txt"),
+			"destination": filepath.Join(tempDir, "moved.txt")}, "Successfully moved")
+		run(t, "move_file", map[string]interface{}{"source": filepath.Join(tempDir, "sub"),
+			"destination": filepath.Join(tempDir, "sub2")}, "Successfully moved")
+		run(t, "create_directory", map[string]interface{}{"path": filepath.Join(tempDir, "empty")}, "Successfully created")
+
+		run(t, "read_file", map[string]interface{}{"path": filepath.Join(tempDir, "keep.txt")}, "one\nthree\n")
+		run(t, "list_directory", map[string]interface{}{"path": tempDir},
+			"[DIR] empty\n[FILE] keep.txt\n[FILE] moved.txt\n[FILE] new.txt\n[DIR] sub2")
+		run(t, "read_file", map[string]interface{}{"path": filepath.Join(tempDir, "sub2", "inner.txt")}, "inner\n")
+		if text, isError := call(t, "read_file", map[string]interface{}{"path": filepath.Join(tempDir, "gone.txt")}, overlays.Wrap); !isError {
+			t.Errorf("Expected the moved file to be gone, got %q", text)
+		}
+		assertDisk(t, "keep.txt", "one\ntwo\n")
+		assertDisk(t, "gone.txt", "bye\n")
+		assertDisk(t, "new.txt", "")
+	})
+
+	t.Run("Pending changes are shown as a diff", func(t *testing.T) {
+		text, isError := call(t, "overlay_diff", nil, overlays.Wrap)
+		if isError {
+			t.Fatalf("Unexpected error: %s", text)
+		}
+		for _, expected := range []string{
+			"Created directory " + filepath.Join(tempDir, "empty") + "\n",
+			"Removed file " + filepath.Join(tempDir, "gone.txt") + "\n",
+			"Modified file " + filepath.Join(tempDir, "keep.txt") + "\n",
+			"-two\n+three\n",
+			"Created file " + filepath.Join(tempDir, "new.txt") + "\n",
+			"Removed directory " + filepath.Join(tempDir, "sub") + "\n",
+			"Created file " + filepath.Join(tempDir, "sub2", "inner.txt") + "\n",
+		} {
+			if !strings.Contains(text, expected) {
+				t.Errorf("Expected the diff to contain %q, got %q", expected, text)
+			}
+		}
+		// The content of removed files is not read
+		if strings.Contains(text, "-bye") {
+			t.Errorf("Expected no diff of removed files, got %q", text)
+		}
+		text, isError = call(t, "overlay_diff", nil, overlays.Wrap, Limits{MaxFileBytes: 5}.Wrap)
+		if isError || !strings.Contains(text, "Modified file "+filepath.Join(tempDir, "keep.txt")+"\n[content not shown: ") {
+			t.Errorf("Expected the content of files beyond the limit not to be shown, got %q", text)
+		}
+	})
+
+	t.Run("Commit applies the changes", func(t *testing.T) {
+		run(t, "overlay_commit", nil, "Committed 9 changes")
+		assertDisk(t, "keep.txt", "one\nthree\n")
+		assertDisk(t, "gone.txt", "")
+		assertDisk(t, "moved.txt", "bye\n")
+		assertDisk(t, "new.txt", "new\n")
+		assertDisk(t, "sub/inner.txt", "")
+		assertDisk(t, "sub2/inner.txt", "inner\n")
+		if info, err := os.Stat(filepath.Join(tempDir, "empty")); err != nil || !info.IsDir() {
+			t.Errorf("Expected the directory to be created: %v", err)
+		}
+		run(t, "overlay_diff", nil, "No pending changes")
+	})
+
+	t.Run("Discard drops the changes", func(t *testing.T) {
+		run(t, "write_file", map[string]interface{}{"path": filepath.Join(tempDir, "keep.txt"), "content": "scratch"}, "Successfully wrote")
+		run(t, "overlay_discard", nil, "Discarded 1 pending changes")
+		run(t, "read_file", map[string]interface{}{"path": filepath.Join(tempDir, "keep.txt")}, "one\nthree\n")
+		assertDisk(t, "keep.txt", "one\nthree\n")
+	})
+
+	t.Run("Untouched files keep the times of the lower backend", func(t *testing.T) {
+		args := map[string]interface{}{"path": filepath.Join(tempDir, "keep.txt")}
+		direct, _ := call(t, "get_file_info", args)
+		overlaid, isError := call(t, "get_file_info", args, overlays.Wrap)
+		if isError || overlaid != direct || !strings.Contains(direct, `"changed"`) {
+			t.Errorf("Expected the times of the lower backend, %s, got %s", direct, overlaid)
+		}
+	})
+
+	t.Run("Changes made outside the overlay are not overwritten", func(t *testing.T) {
+		run(t, "edit_file", map[string]interface{}{"path": filepath.Join(tempDir, "keep.txt"),
+			"edits": []interface{}{map[string]interface{}{"oldText": "three", "newText": "four"}}}, "+four")
+		run(t, "write_file", map[string]interface{}{"path": filepath.Join(tempDir, "other.txt"), "content": "mine\n"}, "Successfully wrote")
+		if err := os.WriteFile(filepath.Join(tempDir, "keep.txt"), []byte("one\nthree\nand more\n"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(tempDir, "other.txt"), []byte("theirs\n"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		run(t, "overlay_diff", nil, "Modified file "+filepath.Join(tempDir, "keep.txt")+" (conflict: ")
+		run(t, "overlay_diff", nil, "Modified file "+filepath.Join(tempDir, "other.txt")+" (conflict: ")
+		text, isError := call(t, "overlay_commit", nil, overlays.Wrap)
+		if !isError || !strings.Contains(text, "nothing was committed") || !strings.Contains(text, filepath.Join(tempDir, "keep.txt")) {
+			t.Errorf("Expected the commit to be refused, got %q", text)
+		}
+		assertDisk(t, "keep.txt", "one\nthree\nand more\n")
+		assertDisk(t, "other.txt", "theirs\n")
+		run(t, "overlay_discard", nil, "Discarded 2 pending changes")
+		if err := os.Remove(filepath.Join(tempDir, "other.txt")); err != nil {
+			t.Fatalf("Failed to remove file: %v", err)
+		}
+	})
+
+	t.Run("Overlay tools need overlay mode", func(t *testing.T) {
+		if text, isError := call(t, "overlay_diff", nil); !isError || !strings.Contains(text, "overlay mode is not enabled") {
+			t.Errorf("Expected overlay mode to be required, got %q", text)
+		}
+	})
+
+	t.Run("The overlay follows the local semantics", func(t *testing.T) {
+		lower := NewMemoryBackend()
+		if err := mkdirAll(lower, "/d/e", 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := writeFile(lower, "/d/a.txt", []byte("a"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		o := newOverlayBackend(lower, 0)
+		if err := o.Remove("/d"); !errors.Is(err, syscall.ENOTEMPTY) {
+			t.Errorf("Expected ENOTEMPTY, got %v", err)
+		}
+		if err := o.Rename("/d", "/d/e/d"); !errors.Is(err, syscall.EINVAL) {
+			t.Errorf("Expected EINVAL moving a directory into itself, got %v", err)
+		}
+		if err := o.Mkdir("/d/a.txt/x", 0755); !errors.Is(err, syscall.ENOTDIR) {
+			t.Errorf("Expected ENOTDIR, got %v", err)
+		}
+		// A directory created where one was removed does not show what the lower backend has in it
+		for _, name := range []string{"/d/a.txt", "/d/e", "/d"} {
+			if err := o.Remove(name); err != nil {
+				t.Fatalf("Failed to remove %s: %v", name, err)
+			}
+		}
+		if err := o.Mkdir("/d", 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if entries, err := o.ReadDir("/d"); err != nil || len(entries) != 0 {
+			t.Errorf("Expected an empty directory, got %v, %v", entries, err)
+		}
+		if _, err := o.Stat("/d/a.txt"); !errors.Is(err, syscall.ENOENT) {
+			t.Errorf("Expected ENOENT, got %v", err)
+		}
+		if _, err := o.commit(context.Background()); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		if entries, err := lower.ReadDir("/d"); err != nil || len(entries) != 0 {
+			t.Errorf("Expected the lower directory to be emptied, got %v, %v", entries, err)
+		}
+	})
+
+	t.Run("The layer holds a limited amount of content", func(t *testing.T) {
+		lower := NewMemoryBackend()
+		if err := writeFile(lower, "/big.txt", []byte(strings.Repeat("x", 100)), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		o := newOverlayBackend(lower, 64)
+		if err := o.Rename("/big.txt", "/moved.txt"); !errors.Is(err, syscall.ENOSPC) {
+			t.Errorf("Expected ENOSPC moving a file larger than the layer, got %v", err)
+		}
+		if _, err := o.OpenFile("/big.txt", os.O_WRONLY|os.O_APPEND, 0); !errors.Is(err, syscall.ENOSPC) {
+			t.Errorf("Expected ENOSPC appending to a file larger than the layer, got %v", err)
+		}
+		if err := writeFile(o, "/a.txt", []byte(strings.Repeat("a", 40)), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := writeFile(o, "/b.txt", []byte(strings.Repeat("b", 40)), 0644); !errors.Is(err, syscall.ENOSPC) {
+			t.Errorf("Expected ENOSPC, got %v", err)
+		}
+		// Removing files gives their space back
+		for _, name := range []string{"/a.txt", "/b.txt"} {
+			if err := o.Remove(name); err != nil {
+				t.Fatalf("Failed to remove %s: %v", name, err)
+			}
+		}
+		if err := writeFile(o, "/b.txt", []byte(strings.Repeat("b", 60)), 0644); err != nil {
+			t.Errorf("Expected the space of removed files to be reused, got %v", err)
+		}
+	})
+
+	t.Run("A commit that fails midway drops the changes it applied", func(t *testing.T) {
+		lower := newLimitedMemoryBackend(40)
+		o := newOverlayBackend(lower, 0)
+		for _, name := range []string{"/a.txt", "/b.txt"} {
+			if err := writeFile(o, name, []byte(strings.Repeat("x", 30)), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+		}
+		_, err := o.commit(context.Background())
+		if !errors.Is(err, syscall.ENOSPC) || !strings.Contains(err.Error(), "1 of 2 changes were committed before, and are no longer pending: /a.txt") {
+			t.Fatalf("Expected the committed changes to be reported, got %v", err)
+		}
+		changes, err := o.layer.changes()
+		if err != nil || len(changes) != 1 || changes[0].path != "/b.txt" || changes[0].conflict {
+			t.Errorf("Expected only /b.txt to stay pending, got %v, %v", changes, err)
+		}
+		if o.layer.upper.size != 30 {
+			t.Errorf("Expected the layer to give back the space of /a.txt, got %d bytes", o.layer.upper.size)
+		}
+	})
+
+	t.Run("A move that fails leaves both paths as they were", func(t *testing.T) {
+		lower := NewMemoryBackend()
+		for _, name := range []string{"/src", "/dst"} {
+			if err := lower.Mkdir(name, 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+		}
+		for _, name := range []string{"/src/a.txt", "/src/b.txt"} {
+			if err := writeFile(lower, name, []byte(strings.Repeat("x", 30)), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+		}
+		o := newOverlayBackend(lower, 50)
+		if err := o.Rename("/src", "/dst"); !errors.Is(err, syscall.ENOSPC) {
+			t.Fatalf("Expected ENOSPC moving a directory larger than the layer, got %v", err)
+		}
+		if info, err := o.Lstat("/dst"); err != nil || !info.IsDir() {
+			t.Errorf("Expected the destination to be kept, got %v, %v", info, err)
+		}
+		if entries, err := o.ReadDir("/src"); err != nil || len(entries) != 2 {
+			t.Errorf("Expected the source to be kept, got %v, %v", entries, err)
+		}
+		if entries, err := o.ReadDir("/"); err != nil || len(entries) != 2 {
+			t.Errorf("Expected no partial copy to be left, got %v, %v", entries, err)
+		}
+		if changes, err := o.layer.changes(); err != nil || len(changes) != 0 {
+			t.Errorf("Expected no pending changes, got %v, %v", changes, err)
+		}
+	})
+}
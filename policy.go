@@ -0,0 +1,124 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Policy restricts what may be done inside the allowed directories.
+type Policy struct {
+	readOnly []string
+	deny     ExcludeMatcher
+}
+
+// NewPolicy creates a policy under which nothing inside the readOnly directories may be modified,
+// and paths matching any of the gitignore-style deny patterns, relative to their allowed
+// directory, may not be accessed at all.
+func NewPolicy(readOnly []string, deny []string) (*Policy, error) {
+	p := &Policy{
+		readOnly: readOnly,
+		deny:     NewExcludeMatcher(),
+	}
+	for _, pattern := range deny {
+		if err := p.deny.AddPattern(pattern); err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q: %w", pattern, err)
+		}
+	}
+	return p, nil
+}
+
+// Wrap returns a copy of t whose handler enforces this policy.
+func (p *Policy) Wrap(t tester.ToolHandler) tester.ToolHandler {
+	handler := t.Handler
+	t.Handler = func(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+		scope := &policyScope{policy: p, allowedDirs: allowedDirs}
+		return handler(context.WithValue(ctx, policyScopeKey{}, scope), req, allowedDirs)
+	}
+	return t
+}
+
+// policyScope binds a policy to the allowed directories of a call.
+type policyScope struct {
+	policy      *Policy
+	allowedDirs []string
+}
+
+type policyScopeKey struct{}
+
+func policyScopeFromContext(ctx context.Context) *policyScope {
+	scope, _ := ctx.Value(policyScopeKey{}).(*policyScope)
+	return scope
+}
+
+// isDenied reports whether path, or any of its parents below its allowed directory, matches a deny pattern.
+func isDenied(ctx context.Context, path string) bool {
+	scope := policyScopeFromContext(ctx)
+	if scope == nil {
+		return false
+	}
+	root := anchorOf(ctx, path, scope.allowedDirs)
+	if root == "" {
+		return false
+	}
+	for p := path; p != root && p != filepath.Dir(p); p = filepath.Dir(p) {
+		var info os.FileInfo
+		if p != path {
+			// Parents are directories, whether or not they exist yet
+			info = pathInfo{name: filepath.Base(p), dir: true}
+		} else if existing, err := backendFromContext(ctx).Lstat(p); err == nil {
+			info = existing
+		} else {
+			info = pathInfo{name: filepath.Base(p)}
+		}
+		if scope.policy.deny.Match(root, p, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDeniedEntry reports whether an entry found while walking a directory matches a deny pattern.
+// Unlike isDenied, it does not check the parents, which the walk has already visited.
+func isDeniedEntry(ctx context.Context, path string, info os.FileInfo) bool {
+	scope := policyScopeFromContext(ctx)
+	if scope == nil {
+		return false
+	}
+	root := anchorOf(ctx, path, scope.allowedDirs)
+	return root != "" && path != root && scope.policy.deny.Match(root, path, info)
+}
+
+// checkWritable returns an error if path lies in a read-only directory.
+func checkWritable(ctx context.Context, path string) error {
+	scope := policyScopeFromContext(ctx)
+	if scope == nil {
+		return nil
+	}
+	if rootOf(path, scope.policy.readOnly) != "" {
+		return fmt.Errorf("access denied - read-only directory: %s", path)
+	}
+	return nil
+}
+
+// pathInfo is the minimal os.FileInfo needed to match paths that may not exist.
+type pathInfo struct {
+	name string
+	dir  bool
+}
+
+func (i pathInfo) Name() string { return i.name }
+func (i pathInfo) Size() int64  { return 0 }
+func (i pathInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir
+	}
+	return 0
+}
+func (i pathInfo) ModTime() time.Time { return time.Time{} }
+func (i pathInfo) IsDir() bool        { return i.dir }
+func (i pathInfo) Sys() interface{}   { return nil }
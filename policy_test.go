@@ -0,0 +1,152 @@
+package top
+
+import (
+	"context"
+	"github.com/mark3labs/mcp-go/mcp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	rwDir := t.TempDir()
+	roDir := t.TempDir()
+	for _, dir := range []string{rwDir, roDir} {
+		if err := os.MkdirAll(filepath.Join(dir, "secrets"), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		for _, name := range []string{"public.txt", "server.key", "secrets/token.txt"} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte("content"), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+		}
+	}
+
+	policy, err := NewPolicy([]string{roDir}, []string{"*.key", "secrets/"})
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	if _, err := NewPolicy(nil, []string{"[unclosed"}); err == nil {
+		t.Errorf("Expected error for invalid deny pattern")
+	}
+
+	call := func(t *testing.T, name string, args map[string]interface{}) (bool, string) {
+		t.Helper()
+		for _, tool := range Tools {
+			if tool.Tool.Name == name {
+				req := mcp.CallToolRequest{}
+				req.Params.Name = name
+				req.Params.Arguments = args
+				result, err := policy.Wrap(tool).Handler(context.Background(), req, []string{rwDir, roDir})
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return result.IsError, result.Content[0].(mcp.TextContent).Text
+			}
+		}
+		t.Fatalf("Tool %s not found", name)
+		return false, ""
+	}
+
+	tests := []struct {
+		name          string
+		tool          string
+		args          map[string]interface{}
+		expectedError string
+		check         func(string) bool
+	}{
+		{
+			name: "Read allowed file",
+			tool: "read_file",
+			args: map[string]interface{}{"path": filepath.Join(roDir, "public.txt")},
+		},
+		{
+			name:          "Read denied file",
+			tool:          "read_file",
+			args:          map[string]interface{}{"path": filepath.Join(rwDir, "server.key")},
+			expectedError: "deny pattern",
+		},
+		{
+			name:          "Read file in denied directory",
+			tool:          "read_file",
+			args:          map[string]interface{}{"path": filepath.Join(rwDir, "secrets/token.txt")},
+			expectedError: "deny pattern",
+		},
+		{
+			name:          "Create file in denied directory",
+			tool:          "write_file",
+			args:          map[string]interface{}{"path": filepath.Join(rwDir, "secrets/new.txt"), "content": "x"},
+			expectedError: "deny pattern",
+		},
+		{
+			name: "Write in read-write directory",
+			tool: "write_file",
+			args: map[string]interface{}{"path": filepath.Join(rwDir, "new.txt"), "content": "x"},
+		},
+		{
+			name:          "Write in read-only directory",
+			tool:          "write_file",
+			args:          map[string]interface{}{"path": filepath.Join(roDir, "new.txt"), "content": "x"},
+			expectedError: "read-only",
+		},
+		{
+			name:          "Move out of read-only directory",
+			tool:          "move_file",
+			args:          map[string]interface{}{"source": filepath.Join(roDir, "public.txt"), "destination": filepath.Join(rwDir, "moved.txt")},
+			expectedError: "read-only",
+		},
+		{
+			name: "Dry run edit in read-only directory",
+			tool: "edit_file",
+			args: map[string]interface{}{
+				"path":   filepath.Join(roDir, "public.txt"),
+				"edits":  []interface{}{map[string]interface{}{"oldText": "content", "newText": "changed"}},
+				"dryRun": true,
+			},
+		},
+		{
+			name: "Listing hides denied entries",
+			tool: "list_directory",
+			args: map[string]interface{}{"path": rwDir},
+			check: func(text string) bool {
+				return strings.Contains(text, "public.txt") && !strings.Contains(text, "server.key") &&
+					!strings.Contains(text, "secrets")
+			},
+		},
+		{
+			name: "Search skips denied entries",
+			tool: "search_files",
+			args: map[string]interface{}{"path": rwDir, "pattern": "t"},
+			check: func(text string) bool {
+				return strings.Contains(text, "public.txt") && !strings.Contains(text, "token.txt")
+			},
+		},
+		{
+			name: "Tree skips denied entries",
+			tool: "directory_tree",
+			args: map[string]interface{}{"path": rwDir},
+			check: func(text string) bool {
+				return strings.Contains(text, "public.txt") && !strings.Contains(text, "secrets") &&
+					!strings.Contains(text, "server.key")
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			isError, text := call(t, tc.tool, tc.args)
+			if tc.expectedError != "" {
+				if !isError || !strings.Contains(text, tc.expectedError) {
+					t.Errorf("Expected error containing %q, got: %s", tc.expectedError, text)
+				}
+				return
+			}
+			if isError {
+				t.Fatalf("Unexpected error: %s", text)
+			}
+			if tc.check != nil && !tc.check(text) {
+				t.Errorf("Content check failed. Got: %s", text)
+			}
+		})
+	}
+}
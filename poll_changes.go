@@ -0,0 +1,63 @@
+package top
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func DefinePollChangesTool() mcp.Tool {
+	return mcp.NewTool("poll_changes",
+		mcp.WithDescription(
+			"Return the changes found by watch_directory since a cursor, and the cursor to pass next time. "+
+				"Each event has a 'type' (created, modified, deleted or renamed), a 'path' and, for renamed, "+
+				"the 'oldPath'. A change may be reported more than once. The last 1000 events are kept; "+
+				"if 'overflow' is true, changes were lost and the directory should be listed again."),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(false),
+		mcp.WithOpenWorldHintAnnotation(false),
+		withArguments[PollChangesArgs](),
+		mcp.WithOutputSchema[ChangesInfo](),
+	)
+}
+
+// PollChangesArgs are the arguments of poll_changes.
+type PollChangesArgs struct {
+	Cursor string `arg:"cursor,required" desc:"Cursor returned by watch_directory or poll_changes"`
+}
+
+type ChangesInfo struct {
+	Events   []ChangeEvent `json:"events"`
+	Overflow bool          `json:"overflow"`
+	Cursor   string        `json:"cursor"`
+}
+
+func PollChangesHandler(ctx context.Context, req mcp.CallToolRequest, _ []string) (*mcp.CallToolResult, error) {
+	scope := watchScopeFromContext(ctx)
+	if scope == nil {
+		return mcp.NewToolResultError("watching is not available"), nil
+	}
+	args, err := bindArguments[PollChangesArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	id, last, err := parseWatchCursor(args.Cursor)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	dw := scope.watches.lookup(scope.session, id)
+	if dw == nil {
+		return mcp.NewToolResultError("the watch of this cursor has stopped; call watch_directory again"), nil
+	}
+	events, overflow, next, err := dw.poll(last)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	changes := ChangesInfo{Events: events, Overflow: overflow, Cursor: next}
+	jsonData, err := json.Marshal(changes)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return mcp.NewToolResultStructured(changes, string(jsonData)), nil
+}
@@ -0,0 +1,63 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"time"
+)
+
+// progressInterval is the minimum time between two progress notifications of a call.
+const progressInterval = 250 * time.Millisecond
+
+// progressReporter sends notifications/progress for a call whose request carries a progress token.
+// It is used from the goroutine running the call only.
+type progressReporter struct {
+	ctx   context.Context
+	srv   *server.MCPServer
+	token mcp.ProgressToken
+	unit  string
+	count int64
+	sent  time.Time
+}
+
+type progressKey struct{}
+
+// withProgress returns a context reporting the progress of req, counted in unit,
+// if the client asked for progress and can be notified.
+func withProgress(ctx context.Context, req mcp.CallToolRequest, unit string) context.Context {
+	if req.Params.Meta == nil || req.Params.Meta.ProgressToken == nil {
+		return ctx
+	}
+	srv := server.ServerFromContext(ctx)
+	if srv == nil {
+		return ctx
+	}
+	reporter := &progressReporter{ctx: ctx, srv: srv, token: req.Params.Meta.ProgressToken, unit: unit}
+	return context.WithValue(ctx, progressKey{}, reporter)
+}
+
+func progressFromContext(ctx context.Context) *progressReporter {
+	reporter, _ := ctx.Value(progressKey{}).(*progressReporter)
+	return reporter
+}
+
+// add counts n more units of work, notifying the client at most once per interval.
+// It is a no-op on a nil reporter.
+func (p *progressReporter) add(n int64) {
+	if p == nil {
+		return
+	}
+	p.count += n
+	if time.Since(p.sent) < progressInterval {
+		return
+	}
+	p.sent = time.Now()
+	// Progress is best effort: a client too slow to take it misses some notifications
+	_ = p.srv.SendNotificationToClient(p.ctx, string(mcp.MethodNotificationProgress), map[string]any{
+		"progressToken": p.token,
+		"progress":      p.count,
+		"message":       fmt.Sprintf("%d %s", p.count, p.unit),
+	})
+}
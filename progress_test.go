@@ -0,0 +1,84 @@
+package top
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// notifiedSession is a client session that keeps the notifications sent to it.
+type notifiedSession struct {
+	rootsSession
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *notifiedSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func TestProgress(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{"a", "b", "c"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir, "sub"), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	call := func(t *testing.T, name string, token mcp.ProgressToken) []mcp.JSONRPCNotification {
+		t.Helper()
+		session := &notifiedSession{rootsSession: rootsSession{id: "progress"}, notifications: make(chan mcp.JSONRPCNotification, 10)}
+		srv := server.NewMCPServer("test", "1.0", server.WithToolCapabilities(false))
+		for _, tool := range Tools {
+			handler := tool.Handler
+			srv.AddTool(tool.Tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				return handler(ctx, req, []string{tempDir})
+			})
+		}
+		req := map[string]any{
+			"jsonrpc": "2.0",
+			"id":      1,
+			"method":  "tools/call",
+			"params": map[string]any{
+				"name":      name,
+				"arguments": map[string]any{"path": tempDir, "pattern": "sub"},
+			},
+		}
+		if token != nil {
+			req["params"].(map[string]any)["_meta"] = map[string]any{"progressToken": token}
+		}
+		message, _ := json.Marshal(req)
+		response := srv.HandleMessage(srv.WithContext(context.Background(), session), message)
+		if result, ok := response.(mcp.JSONRPCResponse); !ok || result.Result.(*mcp.CallToolResult).IsError {
+			t.Fatalf("Unexpected response: %+v", response)
+		}
+		close(session.notifications)
+		var notifications []mcp.JSONRPCNotification
+		for notification := range session.notifications {
+			notifications = append(notifications, notification)
+		}
+		return notifications
+	}
+
+	for _, name := range []string{"search_files", "directory_tree"} {
+		t.Run(name+" reports entries scanned", func(t *testing.T) {
+			notifications := call(t, name, "token")
+			if len(notifications) == 0 {
+				t.Fatalf("Expected a progress notification")
+			}
+			fields := notifications[0].Params.AdditionalFields
+			if notifications[0].Method != string(mcp.MethodNotificationProgress) ||
+				fields["progressToken"] != "token" || fields["progress"] != int64(1) {
+				t.Errorf("Unexpected notification: %+v", notifications[0])
+			}
+		})
+
+		t.Run(name+" without token is silent", func(t *testing.T) {
+			if notifications := call(t, name, nil); len(notifications) != 0 {
+				t.Errorf("Unexpected notifications: %+v", notifications)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package top
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// promptTemplateExt is the extension of the prompt templates loaded from a directory.
+const promptTemplateExt = ".tmpl"
+
+// promptFuncs gather context for prompt templates. Each takes a path, restricted like the tools, first.
+var promptFuncs = []string{"file", "tree", "list", "search", "diff"}
+
+// LoadPromptTemplates loads a prompt from each *.tmpl file of dir, named after the file. A template is
+// a Go text/template rendered into a single user message. Its arguments are the fields it uses, such as
+// {{.path}}, all required; those passed to the functions below are paths. A leading {{/* comment */}}
+// is the description of the prompt. The functions gather context, each taking a path first:
+//
+//	file path            the content of a file, as read_file returns it
+//	tree path            the directory tree, 3 levels deep, as directory_tree returns it
+//	list path            the entries of a directory, as list_directory returns them
+//	search path pattern  the paths matching a pattern, as search_files returns them
+//	diff path            the uncommitted changes to a file in Git, empty if there are none
+func LoadPromptTemplates(dir string) ([]PromptHandler, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var prompts []PromptHandler
+	var errs []error
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != promptTemplateExt {
+			continue
+		}
+		p, err := loadPromptTemplate(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("prompt template %s: %w", entry.Name(), err))
+			continue
+		}
+		prompts = append(prompts, p)
+	}
+	return prompts, errors.Join(errs...)
+}
+
+func loadPromptTemplate(path string) (PromptHandler, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PromptHandler{}, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), promptTemplateExt)
+	// The functions are bound to each call when the template is executed
+	placeholders := template.FuncMap{}
+	for _, f := range promptFuncs {
+		placeholders[f] = func(...string) (string, error) { return "", nil }
+	}
+	tmpl, err := template.New(name).Funcs(placeholders).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return PromptHandler{}, err
+	}
+
+	options := []mcp.PromptOption{}
+	text := strings.TrimSpace(string(data))
+	if strings.HasPrefix(text, "{{/*") {
+		if end := strings.Index(text, "*/}}"); end >= 0 {
+			options = append(options, mcp.WithPromptDescription(strings.TrimSpace(text[len("{{/*"):end])))
+		}
+	}
+	var args, paths []string
+	templateArguments(tmpl.Root, &args, &paths)
+	for _, arg := range args {
+		options = append(options, mcp.WithArgument(arg, mcp.RequiredArgument()))
+	}
+
+	handler := func(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+		data := map[string]string{}
+		for _, arg := range args {
+			value, ok := req.GetArguments()[arg].(string)
+			if !ok {
+				return mcp.NewToolResultError(arg + " is required"), nil
+			}
+			data[arg] = value
+		}
+		bound, err := tmpl.Clone()
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		bound.Funcs(promptTemplateFuncs(ctx, allowedDirs))
+		var out bytes.Buffer
+		if err := bound.Execute(&out, data); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return mcp.NewToolResultText(strings.TrimSpace(out.String())), nil
+	}
+	return newPromptHandler(mcp.NewPrompt(name, options...), handler, paths...), nil
+}
+
+// promptTemplateFuncs returns the functions of prompt templates, gathering context for a call.
+func promptTemplateFuncs(ctx context.Context, allowedDirs []string) template.FuncMap {
+	return template.FuncMap{
+		"file": func(path string) (string, error) {
+			return toolText(ctx, ReadFileHandler, map[string]interface{}{"path": path}, allowedDirs)
+		},
+		"tree": func(path string) (string, error) {
+			return promptTree(ctx, path, allowedDirs)
+		},
+		"list": func(path string) (string, error) {
+			return toolText(ctx, ListDirectoryHandler, map[string]interface{}{"path": path}, allowedDirs)
+		},
+		"search": func(path, pattern string) (string, error) {
+			return toolText(ctx, SearchFilesHandler, map[string]interface{}{"path": path, "pattern": pattern}, allowedDirs)
+		},
+		"diff": func(path string) (string, error) {
+			validPath, err := validatePath(ctx, path, allowedDirs)
+			if err != nil {
+				return "", err
+			}
+			diff, err := gitDiff(ctx, validPath)
+			if errors.Is(err, errNotVersioned) {
+				return "", nil
+			}
+			return diff, err
+		},
+	}
+}
+
+// templateArguments adds the fields of dot used by node to args, in order of first use, and those passed
+// as the path of a context function to paths. Fields inside range and with refer to another dot.
+func templateArguments(node parse.Node, args, paths *[]string) {
+	add := func(list *[]string, name string) {
+		if !slices.Contains(*list, name) {
+			*list = append(*list, name)
+		}
+	}
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n != nil {
+			for _, child := range n.Nodes {
+				templateArguments(child, args, paths)
+			}
+		}
+	case *parse.ActionNode:
+		templateArguments(n.Pipe, args, paths)
+	case *parse.PipeNode:
+		if n != nil {
+			for _, cmd := range n.Cmds {
+				templateArguments(cmd, args, paths)
+			}
+		}
+	case *parse.CommandNode:
+		for i, arg := range n.Args {
+			field, ok := arg.(*parse.FieldNode)
+			if !ok {
+				templateArguments(arg, args, paths)
+				continue
+			}
+			add(args, field.Ident[0])
+			if ident, ok := n.Args[0].(*parse.IdentifierNode); ok && i == 1 && slices.Contains(promptFuncs, ident.Ident) {
+				add(paths, field.Ident[0])
+			}
+		}
+	case *parse.IfNode:
+		templateArguments(n.Pipe, args, paths)
+		templateArguments(n.List, args, paths)
+		templateArguments(n.ElseList, args, paths)
+	case *parse.RangeNode:
+		templateArguments(n.Pipe, args, paths)
+	case *parse.WithNode:
+		templateArguments(n.Pipe, args, paths)
+	case *parse.TemplateNode:
+		templateArguments(n.Pipe, args, paths)
+	}
+}
@@ -0,0 +1,331 @@
+package top
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// promptTreeDepth is the depth of the directory trees included in prompts.
+	promptTreeDepth = 3
+	// maxPromptFiles is the number of matching files whose contents refactor_files includes.
+	maxPromptFiles = 20
+)
+
+// PromptHandler is a prompt with the handler gathering its messages. The handler is invoked like a tool,
+// so that it can be wrapped the same way, with the prompt arguments as string arguments; each text or
+// embedded resource of its content becomes a user message. PathArguments names the arguments that are
+// paths, which clients can complete.
+type PromptHandler struct {
+	Prompt        mcp.Prompt
+	Handler       tester.ToolHandler
+	PathArguments []string
+}
+
+func newPromptHandler(prompt mcp.Prompt, handler func(context.Context, mcp.CallToolRequest, []string) (*mcp.CallToolResult, error), pathArguments ...string) PromptHandler {
+	return PromptHandler{
+		Prompt:        prompt,
+		Handler:       tester.ToolHandler{Tool: mcp.Tool{Name: "prompts/" + prompt.Name}, Handler: handler},
+		PathArguments: pathArguments,
+	}
+}
+
+// Prompts are the built-in prompts.
+var Prompts = []PromptHandler{
+	newPromptHandler(DefineSummarizeDirectoryPrompt(), SummarizeDirectoryHandler, "path"),
+	newPromptHandler(DefineReviewChangesPrompt(), ReviewChangesHandler, "path"),
+	newPromptHandler(DefineRefactorFilesPrompt(), RefactorFilesHandler, "path"),
+}
+
+// GetPrompt runs the handler of p, typically wrapped, with the arguments of a prompts/get request.
+func GetPrompt(ctx context.Context, p PromptHandler, args map[string]string, allowedDirs []string) (*mcp.GetPromptResult, error) {
+	arguments := map[string]interface{}{}
+	for _, arg := range p.Prompt.Arguments {
+		if arg.Required && args[arg.Name] == "" {
+			return nil, fmt.Errorf("%s is required", arg.Name)
+		}
+	}
+	for name, value := range args {
+		arguments[name] = value
+	}
+	req := mcp.CallToolRequest{}
+	req.Params.Name = p.Handler.Tool.Name
+	req.Params.Arguments = arguments
+	result, err := callResourceHandler(ctx, p.Handler, req, allowedDirs)
+	if err != nil {
+		return nil, err
+	}
+	messages := []mcp.PromptMessage{}
+	for _, c := range result.Content {
+		switch c.(type) {
+		case mcp.TextContent, mcp.EmbeddedResource:
+			messages = append(messages, mcp.NewPromptMessage(mcp.RoleUser, c))
+		}
+	}
+	return mcp.NewGetPromptResult(p.Prompt.Description, messages), nil
+}
+
+// toolText runs a tool handler for a prompt and returns its text, turning an error result into an error.
+func toolText(ctx context.Context, handler func(context.Context, mcp.CallToolRequest, []string) (*mcp.CallToolResult, error), args map[string]interface{}, allowedDirs []string) (string, error) {
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = args
+	result, err := callResourceHandler(ctx, tester.ToolHandler{Handler: handler}, req, allowedDirs)
+	if err != nil {
+		return "", err
+	}
+	var texts []string
+	for _, c := range result.Content {
+		if text, ok := c.(mcp.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// promptTree returns the directory tree of path, to the depth included in prompts.
+func promptTree(ctx context.Context, path string, allowedDirs []string) (string, error) {
+	return toolText(ctx, DirectoryTreeHandler, map[string]interface{}{
+		"path":     path,
+		"pretty":   false,
+		"maxDepth": float64(promptTreeDepth),
+	}, allowedDirs)
+}
+
+// promptFile returns the content of a file, cut to the per-file limit, as a fenced block headed by its path.
+func promptFile(ctx context.Context, path string, allowedDirs []string) (string, error) {
+	content, err := toolText(ctx, ReadFileHandler, map[string]interface{}{"path": path}, allowedDirs)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:\n\n```\n%s\n```", path, content), nil
+}
+
+// errNotVersioned reports that a file is not committed in a Git work tree.
+var errNotVersioned = errors.New("not under version control")
+
+// errGitUnavailable reports that Git cannot be run, as when it is missing or under Landlock.
+var errGitUnavailable = errors.New("Git cannot be run")
+
+// gitDiff returns the changes to the file at validPath since its last commit, cut to the per-file limit.
+// Git only reads the committed content, which no filter applies to: the work tree is read through the
+// backend and compared here, since Git would run the filters and drivers configured by the repository,
+// which the client may have written. No transport is allowed either, so that a partial clone cannot
+// run the commands of its remotes to fetch a missing blob. Git reads the repository wherever it is, even
+// above the allowed directories, but only the committed content of the file is shown.
+func gitDiff(ctx context.Context, validPath string) (string, error) {
+	// Git reads the local filesystem, not that of the backend
+	if !isLocal(ctx, validPath) {
+		return "", errNotVersioned
+	}
+	args := []string{"-C", filepath.Dir(validPath)}
+	for _, protocol := range []string{"", "file.", "git.", "ssh.", "http.", "https.", "ext."} {
+		args = append(args, "-c", "protocol."+protocol+"allow=never")
+	}
+	args = append(args, "cat-file", "blob", "HEAD:./"+filepath.Base(validPath))
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_OPTIONAL_LOCKS=0")
+	committed, err := cmd.Output()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		return "", ctx.Err()
+	case errors.As(err, &exitErr):
+		return "", errNotVersioned
+	default:
+		return "", fmt.Errorf("%w: %v", errGitUnavailable, err)
+	}
+	if err := checkFileSize(ctx, validPath); err != nil {
+		return "", err
+	}
+	current, err := readFileContext(ctx, validPath)
+	if err != nil {
+		return "", err
+	}
+	noteRead(ctx, len(committed)+len(current))
+	diff, err := createUnifiedDiff(string(committed), string(current), validPath)
+	if err != nil {
+		return "", err
+	}
+	if maxBytes := limitsFromContext(ctx).MaxFileBytes; maxBytes > 0 && int64(len(diff)) > maxBytes {
+		diff = truncateString(diff, int(maxBytes)) + truncationMarker("diff exceeds the limit of %d bytes", maxBytes)
+	}
+	return diff, nil
+}
+
+func DefineSummarizeDirectoryPrompt() mcp.Prompt {
+	return mcp.NewPrompt("summarize_directory",
+		mcp.WithPromptDescription(
+			"Summarize what a directory is for and how it is organized, from its tree and README."),
+		withPromptArguments[SummarizeDirectoryArgs](),
+	)
+}
+
+// SummarizeDirectoryArgs are the arguments of summarize_directory.
+type SummarizeDirectoryArgs struct {
+	Path string `arg:"path,required" desc:"Directory to summarize"`
+}
+
+func SummarizeDirectoryHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[SummarizeDirectoryArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	validPath, err := validatePath(ctx, args.Path, allowedDirs)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	tree, err := promptTree(ctx, validPath, allowedDirs)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	result := mcp.NewToolResultText(fmt.Sprintf(
+		"Summarize the directory %s: what it is for, how it is organized and which files matter most. "+
+			"Its tree, %d levels deep, is:\n\n%s", validPath, promptTreeDepth, tree))
+
+	// The README usually says what the tree does not
+	entries, err := backendFromContext(ctx).ReadDir(validPath)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasPrefix(strings.ToLower(entry.Name()), "readme") {
+			continue
+		}
+		readme := filepath.Join(validPath, entry.Name())
+		if isDeniedEntry(ctx, readme, pathInfo{name: entry.Name()}) {
+			continue
+		}
+		content, err := promptFile(ctx, readme, allowedDirs)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		result.Content = append(result.Content, mcp.NewTextContent(content))
+		break
+	}
+	return result, nil
+}
+
+func DefineReviewChangesPrompt() mcp.Prompt {
+	return mcp.NewPrompt("review_changes",
+		mcp.WithPromptDescription(
+			"Review the uncommitted changes to a file, from its Git diff and current content."),
+		withPromptArguments[ReviewChangesArgs](),
+	)
+}
+
+// ReviewChangesArgs are the arguments of review_changes.
+type ReviewChangesArgs struct {
+	Path string `arg:"path,required" desc:"File to review"`
+}
+
+func ReviewChangesHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[ReviewChangesArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	validPath, err := validatePath(ctx, args.Path, allowedDirs)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	info, err := backendFromContext(ctx).Stat(validPath)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if info.IsDir() {
+		return mcp.NewToolResultError("Path must be a file"), nil
+	}
+	content, err := promptFile(ctx, validPath, allowedDirs)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var changes string
+	diff, err := gitDiff(ctx, validPath)
+	switch {
+	case errors.Is(err, errNotVersioned):
+		changes = "It is not under version control, so review it as a whole."
+	case errors.Is(err, errGitUnavailable):
+		changes = fmt.Sprintf("Its changes are unknown, as %v, so review it as a whole.", err)
+	case err != nil:
+		return mcp.NewToolResultError(err.Error()), nil
+	case strings.TrimSpace(diff) == "":
+		changes = "It has no uncommitted changes in Git, so review it as a whole."
+	default:
+		changes = fmt.Sprintf("Its changes since the last commit in Git are:\n\n```diff\n%s\n```", strings.TrimSuffix(diff, "\n"))
+	}
+	return &mcp.CallToolResult{Content: []mcp.Content{
+		mcp.NewTextContent(fmt.Sprintf(
+			"Review the recent changes to %s. Point out bugs, unclear code and missing tests, "+
+				"and suggest concrete improvements.", validPath)),
+		mcp.NewTextContent(changes),
+		mcp.NewTextContent(content),
+	}}, nil
+}
+
+func DefineRefactorFilesPrompt() mcp.Prompt {
+	return mcp.NewPrompt("refactor_files",
+		mcp.WithPromptDescription(
+			"Apply a refactoring to the files whose names match a pattern, from their contents."),
+		withPromptArguments[RefactorFilesArgs](),
+	)
+}
+
+// RefactorFilesArgs are the arguments of refactor_files.
+type RefactorFilesArgs struct {
+	Path         string `arg:"path,required" desc:"Directory to search"`
+	Pattern      string `arg:"pattern,required" desc:"Case-insensitive part of the names of the files to refactor"`
+	Instructions string `arg:"instructions,required" desc:"Refactoring to apply"`
+}
+
+func RefactorFilesHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[RefactorFilesArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	matches, err := toolText(ctx, SearchFilesHandler, map[string]interface{}{"path": args.Path, "pattern": args.Pattern}, allowedDirs)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var files []string
+	total := 0
+	for _, line := range strings.Split(matches, "\n") {
+		// Search results are absolute paths, followed by a marker if the search was cut short
+		if !filepath.IsAbs(line) {
+			continue
+		}
+		if info, err := backendFromContext(ctx).Stat(line); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		total++
+		if len(files) < maxPromptFiles {
+			files = append(files, line)
+		}
+	}
+	if total == 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("no files matching %q in %s", args.Pattern, args.Path)), nil
+	}
+
+	request := fmt.Sprintf("Refactor the files below, whose names match %q in %s, as follows:\n\n%s\n\n"+
+		"Show the edits to make to each file as exact replacements of existing text.", args.Pattern, args.Path, args.Instructions)
+	if total > len(files) {
+		request += fmt.Sprintf(" Only %d of the %d matching files are included; the others need the same changes.", len(files), total)
+	}
+	result := mcp.NewToolResultText(request)
+	for _, file := range files {
+		content, err := promptFile(ctx, file, allowedDirs)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		result.Content = append(result.Content, mcp.NewTextContent(content))
+	}
+	return result, nil
+}
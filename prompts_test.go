@@ -0,0 +1,219 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPrompts(t *testing.T) {
+	tempDir := t.TempDir()
+	write := func(t *testing.T, path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	write(t, filepath.Join(tempDir, "README.md"), "# Project\nDoes things.")
+	write(t, filepath.Join(tempDir, "src", "main.go"), "package main\n")
+	write(t, filepath.Join(tempDir, "src", "util.go"), "package main\n\nfunc util() {}\n")
+	write(t, filepath.Join(tempDir, "secrets", "key.go"), "package secrets\n")
+	policy, err := NewPolicy(nil, []string{"secrets/"})
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	allowedDirs := []string{tempDir}
+	get := func(t *testing.T, p PromptHandler, args map[string]string) (string, error) {
+		t.Helper()
+		p.Handler = policy.Wrap(p.Handler)
+		result, err := GetPrompt(context.Background(), p, args, allowedDirs)
+		if err != nil {
+			return "", err
+		}
+		var texts []string
+		for _, message := range result.Messages {
+			if message.Role != mcp.RoleUser {
+				t.Errorf("Expected user message, got %s", message.Role)
+			}
+			texts = append(texts, message.Content.(mcp.TextContent).Text)
+		}
+		return strings.Join(texts, "\n"), nil
+	}
+	prompt := func(name string) PromptHandler {
+		for _, p := range Prompts {
+			if p.Prompt.Name == name {
+				return p
+			}
+		}
+		t.Fatalf("Missing prompt %s", name)
+		return PromptHandler{}
+	}
+
+	t.Run("Directory summary includes tree and README", func(t *testing.T) {
+		text, err := get(t, prompt("summarize_directory"), map[string]string{"path": tempDir})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, expected := range []string{`"main.go"`, "Does things."} {
+			if !strings.Contains(text, expected) {
+				t.Errorf("Expected %q in prompt, got: %s", expected, text)
+			}
+		}
+		if strings.Contains(text, "key.go") {
+			t.Errorf("Expected denied entries to be left out, got: %s", text)
+		}
+	})
+
+	t.Run("Review includes diff", func(t *testing.T) {
+		file := filepath.Join(tempDir, "src", "main.go")
+		text, err := get(t, prompt("review_changes"), map[string]string{"path": file})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(text, "not under version control") || !strings.Contains(text, "package main") {
+			t.Errorf("Expected content without diff, got: %s", text)
+		}
+
+		git := func(args ...string) {
+			cmd := exec.Command("git", append([]string{"-C", tempDir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+			if output, err := cmd.CombinedOutput(); err != nil {
+				t.Skipf("Git is unavailable: %v\n%s", err, output)
+			}
+		}
+		git("init", "-q")
+		git("add", "src/main.go")
+		git("commit", "-q", "-m", "initial")
+		write(t, file, "package main\n\nfunc main() {}\n")
+		text, err = get(t, prompt("review_changes"), map[string]string{"path": file})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(text, "+func main() {}") {
+			t.Errorf("Expected diff in prompt, got: %s", text)
+		}
+	})
+
+	t.Run("Repository filters are not run", func(t *testing.T) {
+		if _, err := os.Stat(filepath.Join(tempDir, ".git")); err != nil {
+			t.Skip("Git is unavailable")
+		}
+		marker := filepath.Join(t.TempDir(), "filtered")
+		config, err := os.OpenFile(filepath.Join(tempDir, ".git", "config"), os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("Failed to open Git config: %v", err)
+		}
+		_, err = fmt.Fprintf(config, "[filter \"x\"]\n\tclean = touch %s\n\tsmudge = touch %s\n", marker, marker)
+		config.Close()
+		if err != nil {
+			t.Fatalf("Failed to write Git config: %v", err)
+		}
+		write(t, filepath.Join(tempDir, ".gitattributes"), "* filter=x\n")
+		templatesDir := t.TempDir()
+		write(t, filepath.Join(templatesDir, "changes.tmpl"), "{{diff .file}}")
+		templates, err := LoadPromptTemplates(templatesDir)
+		if err != nil || len(templates) != 1 {
+			t.Fatalf("Failed to load template: %v", err)
+		}
+
+		file := filepath.Join(tempDir, "src", "main.go")
+		for _, p := range []PromptHandler{prompt("review_changes"), templates[0]} {
+			text, err := get(t, p, map[string]string{"path": file, "file": file})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !strings.Contains(text, "+func main() {}") {
+				t.Errorf("Expected diff in prompt, got: %s", text)
+			}
+		}
+		if _, err := os.Stat(marker); !os.IsNotExist(err) {
+			t.Errorf("Expected the filter configured by the repository not to run, got %v", err)
+		}
+	})
+
+	t.Run("Git that cannot be run is reported", func(t *testing.T) {
+		t.Setenv("PATH", t.TempDir())
+		text, err := get(t, prompt("review_changes"), map[string]string{"path": filepath.Join(tempDir, "src", "main.go")})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(text, "Git cannot be run") || strings.Contains(text, "not under version control") {
+			t.Errorf("Expected Git to be reported as unavailable, got: %s", text)
+		}
+	})
+
+	t.Run("Refactoring includes matching files", func(t *testing.T) {
+		text, err := get(t, prompt("refactor_files"), map[string]string{"path": tempDir, "pattern": ".go", "instructions": "Rename util."})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(text, "Rename util.") || !strings.Contains(text, "func util() {}") || strings.Contains(text, "package secrets") {
+			t.Errorf("Expected matching files other than denied ones, got: %s", text)
+		}
+		if _, err := get(t, prompt("refactor_files"), map[string]string{"path": tempDir, "pattern": "nothing", "instructions": "x"}); err == nil {
+			t.Errorf("Expected error without matching files")
+		}
+	})
+
+	t.Run("Invalid arguments fail", func(t *testing.T) {
+		if _, err := get(t, prompt("summarize_directory"), map[string]string{}); err == nil {
+			t.Errorf("Expected error for missing argument")
+		}
+		if _, err := get(t, prompt("summarize_directory"), map[string]string{"path": t.TempDir()}); err == nil {
+			t.Errorf("Expected error outside allowed directories")
+		}
+		if _, err := get(t, prompt("review_changes"), map[string]string{"path": filepath.Join(tempDir, "secrets", "key.go")}); err == nil {
+			t.Errorf("Expected error for denied file")
+		}
+	})
+
+	t.Run("Templates are loaded", func(t *testing.T) {
+		templatesDir := t.TempDir()
+		write(t, filepath.Join(templatesDir, "explain.tmpl"),
+			"{{/* Explain a file */}}\nExplain {{.file}} to a {{.audience}}:\n{{file .file}}\n{{if .audience}}Be brief.{{end}}")
+		write(t, filepath.Join(templatesDir, "notes.txt"), "not a template")
+		prompts, err := LoadPromptTemplates(templatesDir)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(prompts) != 1 {
+			t.Fatalf("Expected 1 prompt, got %d", len(prompts))
+		}
+		p := prompts[0]
+		var args []string
+		for _, arg := range p.Prompt.Arguments {
+			args = append(args, arg.Name)
+		}
+		if p.Prompt.Name != "explain" || p.Prompt.Description != "Explain a file" ||
+			!slices.Equal(args, []string{"file", "audience"}) || !slices.Equal(p.PathArguments, []string{"file"}) {
+			t.Errorf("Unexpected prompt %+v with path arguments %v", p.Prompt, p.PathArguments)
+		}
+		text, err := get(t, p, map[string]string{"file": filepath.Join(tempDir, "README.md"), "audience": "child"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := fmt.Sprintf("Explain %s to a child:\n# Project\nDoes things.\nBe brief.", filepath.Join(tempDir, "README.md"))
+		if text != expected {
+			t.Errorf("Expected %q, got %q", expected, text)
+		}
+		if _, err := get(t, p, map[string]string{"file": filepath.Join(tempDir, "secrets", "key.go"), "audience": "child"}); err == nil {
+			t.Errorf("Expected error for denied file")
+		}
+	})
+
+	t.Run("Invalid templates fail", func(t *testing.T) {
+		templatesDir := t.TempDir()
+		write(t, filepath.Join(templatesDir, "broken.tmpl"), "{{.path")
+		if _, err := LoadPromptTemplates(templatesDir); err == nil || !strings.Contains(err.Error(), "broken.tmpl") {
+			t.Errorf("Expected error naming the template, got %v", err)
+		}
+	})
+}
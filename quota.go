@@ -0,0 +1,261 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Quota limits how much a session may grow an allowed root. Zero values mean unlimited.
+type Quota struct {
+	// MaxBytes is the maximum net number of bytes added under the root.
+	MaxBytes int64
+	// MaxFiles is the maximum number of files and directories created under the root.
+	MaxFiles int
+}
+
+// QuotaUsage is the growth of a root accounted so far.
+type QuotaUsage struct {
+	Bytes int64
+	Files int
+}
+
+// Quotas tracks the write usage of each allowed root, separately for each session.
+type Quotas struct {
+	mu       sync.Mutex
+	defaults Quota
+	quotas   map[string]Quota
+	usage    map[usageKey]QuotaUsage
+	writes   map[string]*sync.Mutex // Serializes the accounted writes of each session
+}
+
+// usageKey identifies the usage of a root by a session.
+type usageKey struct {
+	session string
+	root    string
+}
+
+// NewQuotas creates a tracker applying defaults to every root without its own quota.
+func NewQuotas(defaults Quota) *Quotas {
+	return &Quotas{
+		defaults: defaults,
+		quotas:   map[string]Quota{},
+		usage:    map[usageKey]QuotaUsage{},
+		writes:   map[string]*sync.Mutex{},
+	}
+}
+
+// SetQuota sets the quota of a single root, overriding the defaults.
+func (q *Quotas) SetQuota(root string, quota Quota) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.quotas[root] = quota
+}
+
+// Quota returns the quota that applies to root.
+func (q *Quotas) Quota(root string) Quota {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.quotaLocked(root)
+}
+
+func (q *Quotas) quotaLocked(root string) Quota {
+	if quota, ok := q.quotas[root]; ok {
+		return quota
+	}
+	return q.defaults
+}
+
+// Usage returns the usage of root accounted to a session.
+// Calls made without a client session are accounted to the session "".
+func (q *Quotas) Usage(session, root string) QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.usage[usageKey{session: session, root: root}]
+}
+
+// Forget drops the usage of a session that has ended.
+func (q *Quotas) Forget(_ context.Context, session server.ClientSession) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for key := range q.usage {
+		if key.session == session.SessionID() {
+			delete(q.usage, key)
+		}
+	}
+	delete(q.writes, session.SessionID())
+}
+
+// lockWrites waits for the other accounted writes of a session to end, unless no quota applies, and
+// returns the function ending its own.
+func (q *Quotas) lockWrites(session string) func() {
+	q.mu.Lock()
+	if q.defaults == (Quota{}) && len(q.quotas) == 0 {
+		q.mu.Unlock()
+		return func() {}
+	}
+	lock, ok := q.writes[session]
+	if !ok {
+		lock = &sync.Mutex{}
+		q.writes[session] = lock
+	}
+	q.mu.Unlock()
+	lock.Lock()
+	return lock.Unlock
+}
+
+// charge adds bytes and files to the usage of root by session, or returns an error
+// and leaves the usage unchanged if that would exceed the quota.
+func (q *Quotas) charge(session, root string, bytes int64, files int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	quota := q.quotaLocked(root)
+	key := usageKey{session: session, root: root}
+	usage := q.usage[key]
+	if quota.MaxBytes > 0 && bytes > 0 && usage.Bytes+bytes > quota.MaxBytes {
+		return fmt.Errorf("write quota exceeded for %s: %d of %d bytes used, %d more requested",
+			root, usage.Bytes, quota.MaxBytes, bytes)
+	}
+	if quota.MaxFiles > 0 && files > 0 && usage.Files+files > quota.MaxFiles {
+		return fmt.Errorf("file quota exceeded for %s: %d of %d files used, %d more requested",
+			root, usage.Files, quota.MaxFiles, files)
+	}
+	usage.Bytes += bytes
+	usage.Files += files
+	q.usage[key] = usage
+	return nil
+}
+
+// Wrap returns a copy of t whose handler accounts its writes against these quotas.
+func (q *Quotas) Wrap(t tester.ToolHandler) tester.ToolHandler {
+	handler := t.Handler
+	t.Handler = func(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+		scope := &quotaScope{quotas: q, session: sessionID(ctx), allowedDirs: allowedDirs}
+		return handler(context.WithValue(ctx, quotaScopeKey{}, scope), req, allowedDirs)
+	}
+	return t
+}
+
+// quotaScope binds a quota tracker to the session and allowed directories of a call.
+type quotaScope struct {
+	quotas      *Quotas
+	session     string
+	allowedDirs []string
+}
+
+type quotaScopeKey struct{}
+
+func quotaScopeFromContext(ctx context.Context) *quotaScope {
+	scope, _ := ctx.Value(quotaScopeKey{}).(*quotaScope)
+	return scope
+}
+
+// chargeQuota accounts bytes and files written under path before the write happens,
+// failing if the quota of its root would be exceeded. The returned function gives the
+// charge back if the write fails. It is a no-op when the call carries no quota tracker.
+func chargeQuota(ctx context.Context, path string, bytes int64, files int) (func(), error) {
+	scope := quotaScopeFromContext(ctx)
+	if scope == nil {
+		return func() {}, nil
+	}
+	root := anchorOf(ctx, path, scope.allowedDirs)
+	if root == "" {
+		return func() {}, nil
+	}
+	if err := scope.quotas.charge(scope.session, root, bytes, files); err != nil {
+		return nil, err
+	}
+	return func() {
+		_ = scope.quotas.charge(scope.session, root, -bytes, -files)
+	}, nil
+}
+
+// lockWrites serializes the writes of the session of the call that are charged to quotas, from
+// looking at what they replace to writing, so that concurrent writes are not charged for the same
+// change. The returned function ends the write. It is a no-op when the call carries no quota tracker.
+func lockWrites(ctx context.Context) func() {
+	scope := quotaScopeFromContext(ctx)
+	if scope == nil {
+		return func() {}
+	}
+	return scope.quotas.lockWrites(scope.session)
+}
+
+// chargeFileWrite accounts replacing the content of path with size bytes.
+func chargeFileWrite(ctx context.Context, path string, size int64) (func(), error) {
+	info, err := backendFromContext(ctx).Stat(path)
+	if os.IsNotExist(err) {
+		return chargeQuota(ctx, path, size, 1)
+	} else if err != nil {
+		return nil, err
+	}
+	return chargeQuota(ctx, path, size-info.Size(), 0)
+}
+
+// chargeMkdirAll accounts the directories mkdirAll would create for path.
+func chargeMkdirAll(ctx context.Context, path string) (func(), error) {
+	created := 0
+	for p := path; ; p = filepath.Dir(p) {
+		if _, err := backendFromContext(ctx).Stat(p); err == nil {
+			break
+		}
+		created++
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	return chargeQuota(ctx, path, 0, created)
+}
+
+// chargeMove accounts moving the tree at source to dest. A move within a root leaves its usage
+// unchanged, while a move across roots charges the destination root the size and entries of the
+// tree and gives them back to the source root.
+func chargeMove(ctx context.Context, source, dest string) (func(), error) {
+	scope := quotaScopeFromContext(ctx)
+	if scope == nil || anchorOf(ctx, source, scope.allowedDirs) == anchorOf(ctx, dest, scope.allowedDirs) {
+		return func() {}, nil
+	}
+	var bytes int64
+	files := 0
+	err := walkDir(backendFromContext(ctx), source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		files++
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			bytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	refund, err := chargeQuota(ctx, dest, bytes, files)
+	if err != nil {
+		return nil, err
+	}
+	// Giving usage back cannot exceed a quota
+	recharge, _ := chargeQuota(ctx, source, -bytes, -files)
+	return func() {
+		recharge()
+		refund()
+	}, nil
+}
+
+// sessionID returns the ID of the client session of ctx, or "" if there is none.
+func sessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
@@ -0,0 +1,228 @@
+package top
+
+import (
+	"context"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestQuotas(t *testing.T) {
+	tempDir := t.TempDir()
+	quotas := NewQuotas(Quota{MaxBytes: 100, MaxFiles: 3})
+
+	call := func(t *testing.T, name string, args map[string]interface{}) *mcp.CallToolResult {
+		t.Helper()
+		for _, tool := range Tools {
+			if tool.Tool.Name == name {
+				req := mcp.CallToolRequest{}
+				req.Params.Name = name
+				req.Params.Arguments = args
+				result, err := quotas.Wrap(tool).Handler(context.Background(), req, []string{tempDir})
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return result
+			}
+		}
+		t.Fatalf("Tool %s not found", name)
+		return nil
+	}
+	assertUsage := func(t *testing.T, bytes int64, files int) {
+		t.Helper()
+		if usage := quotas.Usage("", tempDir); usage.Bytes != bytes || usage.Files != files {
+			t.Errorf("Expected usage of %d bytes and %d files, got %+v", bytes, files, usage)
+		}
+	}
+
+	testFile := filepath.Join(tempDir, "test.txt")
+	t.Run("New file counts bytes and files", func(t *testing.T) {
+		result := call(t, "write_file", map[string]interface{}{"path": testFile, "content": strings.Repeat("a", 60)})
+		if result.IsError {
+			t.Fatalf("Unexpected error: %v", result.Content)
+		}
+		assertUsage(t, 60, 1)
+	})
+
+	t.Run("Overwrite counts growth only", func(t *testing.T) {
+		result := call(t, "write_file", map[string]interface{}{"path": testFile, "content": strings.Repeat("a", 80)})
+		if result.IsError {
+			t.Fatalf("Unexpected error: %v", result.Content)
+		}
+		assertUsage(t, 80, 1)
+	})
+
+	t.Run("Write exceeding byte quota fails", func(t *testing.T) {
+		result := call(t, "write_file", map[string]interface{}{
+			"path":    filepath.Join(tempDir, "other.txt"),
+			"content": strings.Repeat("a", 30),
+		})
+		if !result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "write quota exceeded") {
+			t.Errorf("Expected quota error, got: %v", result.Content)
+		}
+		if _, err := os.Stat(filepath.Join(tempDir, "other.txt")); !os.IsNotExist(err) {
+			t.Errorf("File was written despite quota: %v", err)
+		}
+		assertUsage(t, 80, 1)
+	})
+
+	t.Run("Edit counts growth", func(t *testing.T) {
+		result := call(t, "edit_file", map[string]interface{}{
+			"path":  testFile,
+			"edits": []interface{}{map[string]interface{}{"oldText": strings.Repeat("a", 80), "newText": "b"}},
+		})
+		if result.IsError {
+			t.Fatalf("Unexpected error: %v", result.Content)
+		}
+		assertUsage(t, 1, 1)
+	})
+
+	t.Run("Directories exceeding file quota fail", func(t *testing.T) {
+		result := call(t, "create_directory", map[string]interface{}{"path": filepath.Join(tempDir, "a/b/c")})
+		if !result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "file quota exceeded") {
+			t.Errorf("Expected quota error, got: %v", result.Content)
+		}
+		result = call(t, "create_directory", map[string]interface{}{"path": filepath.Join(tempDir, "a/b")})
+		if result.IsError {
+			t.Fatalf("Unexpected error: %v", result.Content)
+		}
+		assertUsage(t, 1, 3)
+	})
+
+	t.Run("Failed write is refunded", func(t *testing.T) {
+		result := call(t, "write_file", map[string]interface{}{
+			"path":    filepath.Join(tempDir, "missing/test.txt"),
+			"content": "x",
+		})
+		if !result.IsError {
+			t.Fatalf("Expected error, got: %v", result.Content)
+		}
+		assertUsage(t, 1, 3)
+	})
+
+	t.Run("Sessions are accounted separately", func(t *testing.T) {
+		session := &rootsSession{id: "other"}
+		ctx := server.NewMCPServer("test", "1.0").WithContext(context.Background(), session)
+		for _, tool := range Tools {
+			if tool.Tool.Name == "create_directory" {
+				req := mcp.CallToolRequest{}
+				req.Params.Name = tool.Tool.Name
+				req.Params.Arguments = map[string]interface{}{"path": filepath.Join(tempDir, "other")}
+				result, err := quotas.Wrap(tool).Handler(ctx, req, []string{tempDir})
+				if err != nil || result.IsError {
+					t.Fatalf("Unexpected error: %v %v", err, result)
+				}
+			}
+		}
+		if usage := quotas.Usage("other", tempDir); usage.Files != 1 {
+			t.Errorf("Expected 1 file for the other session, got %+v", usage)
+		}
+		assertUsage(t, 1, 3)
+		quotas.Forget(ctx, session)
+		if usage := quotas.Usage("other", tempDir); usage.Files != 0 {
+			t.Errorf("Expected usage to be forgotten, got %+v", usage)
+		}
+	})
+
+	t.Run("get_quota reports usage", func(t *testing.T) {
+		result := call(t, "get_quota", nil)
+		expected := `[{"root":"` + tempDir + `","bytesUsed":1,"bytesLimit":100,"filesUsed":3,"filesLimit":3}]`
+		if text := result.Content[0].(mcp.TextContent).Text; text != expected {
+			t.Errorf("Unexpected quota report: %s", text)
+		}
+	})
+
+	t.Run("Moves across roots charge the destination", func(t *testing.T) {
+		source, dest := filepath.Join(t.TempDir(), "source"), filepath.Join(t.TempDir(), "dest")
+		for _, dir := range []string{filepath.Join(source, "tree"), dest} {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+		}
+		for _, name := range []string{"a.txt", "b.txt"} {
+			if err := os.WriteFile(filepath.Join(source, "tree", name), []byte(strings.Repeat("a", 40)), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+		}
+		quotas := NewQuotas(Quota{MaxBytes: 100, MaxFiles: 3})
+		move := func(from, to string) *mcp.CallToolResult {
+			for _, tool := range Tools {
+				if tool.Tool.Name == "move_file" {
+					req := mcp.CallToolRequest{}
+					req.Params.Name = tool.Tool.Name
+					req.Params.Arguments = map[string]interface{}{"source": from, "destination": to}
+					result, err := quotas.Wrap(tool).Handler(context.Background(), req, []string{source, dest})
+					if err != nil {
+						t.Fatalf("Unexpected error: %v", err)
+					}
+					return result
+				}
+			}
+			t.Fatalf("Tool move_file not found")
+			return nil
+		}
+
+		if result := move(filepath.Join(source, "tree"), filepath.Join(source, "renamed")); result.IsError {
+			t.Fatalf("Unexpected error: %v", result.Content)
+		}
+		if usage := quotas.Usage("", source); usage != (QuotaUsage{}) {
+			t.Errorf("Expected a move within a root not to be charged, got %+v", usage)
+		}
+		if result := move(filepath.Join(source, "renamed"), filepath.Join(dest, "tree")); result.IsError {
+			t.Fatalf("Unexpected error: %v", result.Content)
+		}
+		if usage := quotas.Usage("", dest); usage != (QuotaUsage{Bytes: 80, Files: 3}) {
+			t.Errorf("Expected the destination to be charged the tree, got %+v", usage)
+		}
+		if usage := quotas.Usage("", source); usage != (QuotaUsage{Bytes: -80, Files: -3}) {
+			t.Errorf("Expected the source to be refunded the tree, got %+v", usage)
+		}
+
+		if err := os.WriteFile(filepath.Join(source, "c.txt"), []byte("c"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		result := move(filepath.Join(source, "c.txt"), filepath.Join(dest, "c.txt"))
+		if !result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "file quota exceeded") {
+			t.Errorf("Expected quota error, got: %v", result.Content)
+		}
+		if _, err := os.Stat(filepath.Join(source, "c.txt")); err != nil {
+			t.Errorf("File was moved despite quota: %v", err)
+		}
+	})
+
+	t.Run("Concurrent writes of a new file charge it once", func(t *testing.T) {
+		dir := t.TempDir()
+		quotas := NewQuotas(Quota{MaxBytes: 1000, MaxFiles: 100})
+		var tool tester.ToolHandler
+		for _, t := range Tools {
+			if t.Tool.Name == "write_file" {
+				tool = quotas.Wrap(t)
+			}
+		}
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				req := mcp.CallToolRequest{}
+				req.Params.Name = "write_file"
+				req.Params.Arguments = map[string]interface{}{"path": filepath.Join(dir, "new.txt"), "content": "new"}
+				if result, err := tool.Handler(context.Background(), req, []string{dir}); err != nil || result.IsError {
+					t.Errorf("Unexpected error: %v %v", err, result)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+		if usage := quotas.Usage("", dir); usage != (QuotaUsage{Bytes: 3, Files: 1}) {
+			t.Errorf("Expected the file to be charged once, got %+v", usage)
+		}
+	})
+}
@@ -3,7 +3,6 @@ package top
 import (
 	"context"
 	"github.com/mark3labs/mcp-go/mcp"
-	"os"
 )
 
 // Tool definitions
@@ -14,23 +13,36 @@ func DefineReadFileTool() mcp.Tool {
 				"Handles various text encodings and provides detailed error messages "+
 				"if the file cannot be read. Use this tool when you need to examine "+
 				"the contents of a single file. Only works within allowed directories."),
-		mcp.WithString("path", mcp.Required(), mcp.Description("Path to the file")),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+		withArguments[ReadFileArgs](),
 	)
 }
 
+// ReadFileArgs are the arguments of read_file.
+type ReadFileArgs struct {
+	Path string `arg:"path,required" desc:"Path to the file"`
+}
+
 // Tool handlers
-func ReadFileHandler(_ context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
-	path, ok := req.Params.Arguments["path"].(string)
-	if !ok {
-		return mcp.NewToolResultError("path must be a string"), nil
+func ReadFileHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[ReadFileArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-	validPath, err := validatePath(path, allowedDirs)
+	validPath, err := validatePath(ctx, args.Path, allowedDirs)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	content, err := os.ReadFile(validPath)
+	content, size, truncated, err := readFileLimited(ctx, validPath)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	return mcp.NewToolResultText(string(content)), nil
+	text := string(content)
+	if truncated {
+		text += truncationMarker("file is %d bytes, only the first %d are shown", size, len(content))
+	}
+	return mcp.NewToolResultText(text), nil
 }
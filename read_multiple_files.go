@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/mark3labs/mcp-go/mcp"
-	"os"
 	"strings"
 )
 
@@ -16,38 +15,59 @@ func DefineReadMultipleFilesTool() mcp.Tool {
 				"or compare multiple files. Each file's content is returned with its "+
 				"path as a reference. Failed reads for individual files won't stop "+
 				"the entire operation. Only works within allowed directories."),
-		mcp.WithArray("paths",
-			mcp.Required(),
-			mcp.Description("Array of file paths"),
-			mcp.Items(map[string]interface{}{
-				"type": "string",
-			})),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+		withArguments[ReadMultipleFilesArgs](),
 	)
 }
 
-func ReadMultipleFilesHandler(_ context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
-	paths, ok := req.Params.Arguments["paths"].([]interface{})
-	if !ok {
-		return mcp.NewToolResultError("paths must be an array"), nil
+// ReadMultipleFilesArgs are the arguments of read_multiple_files. Paths that are not strings fail
+// alone, like those that cannot be read.
+type ReadMultipleFilesArgs struct {
+	Paths []any `arg:"paths,required,items=string" desc:"Array of file paths"`
+}
+
+func ReadMultipleFilesHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[ReadMultipleFilesArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
+	paths := args.Paths
 	var results []string
-	for _, p := range paths {
+	maxResponse := limitsFromContext(ctx).MaxResponseBytes
+	var responseSize int64
+	for i, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if maxResponse > 0 && responseSize >= maxResponse {
+			results = append(results, truncationMarker(
+				"response reached the limit of %d bytes, %d files not read", maxResponse, len(paths)-i))
+			break
+		}
 		path, ok := p.(string)
 		if !ok {
 			results = append(results, fmt.Sprintf("%v: Error - must be a string", p))
 			continue
 		}
-		validPath, err := validatePath(path, allowedDirs)
+		validPath, err := validatePath(ctx, path, allowedDirs)
 		if err != nil {
 			results = append(results, fmt.Sprintf("%s: Error - %v", path, err))
 			continue
 		}
-		content, err := os.ReadFile(validPath)
+		content, size, truncated, err := readFileLimited(ctx, validPath)
 		if err != nil {
 			results = append(results, fmt.Sprintf("%s: Error - %v", path, err))
 			continue
 		}
-		results = append(results, fmt.Sprintf("%s:\n%s", path, string(content)))
+		text := string(content)
+		if truncated {
+			text += truncationMarker("file is %d bytes, only the first %d are shown", size, len(content))
+		}
+		responseSize += int64(len(text))
+		results = append(results, fmt.Sprintf("%s:\n%s", path, text))
 	}
 	return mcp.NewToolResultText(strings.Join(results, "\n---\n")), nil
 }
@@ -0,0 +1,311 @@
+package top
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// resourcePageSize is the number of files returned by each resources/list call.
+	resourcePageSize = 100
+	// fileURITemplate is the URI template of the files in the allowed directories.
+	fileURITemplate = "file://{+path}"
+)
+
+// Resource handlers are invoked like tools, so that they can be wrapped the same way, but are not
+// registered as tools. ResourceLister takes an optional "cursor" argument and returns a
+// mcp.ListResourcesResult as structured content; ResourceReader takes a "uri" argument and
+// returns the contents of the file as an embedded resource.
+var (
+	ResourceLister = tester.ToolHandler{Tool: mcp.Tool{Name: "resources/list"}, Handler: ListResourcesHandler}
+	ResourceReader = tester.ToolHandler{Tool: mcp.Tool{Name: "resources/read"}, Handler: ReadResourceHandler}
+)
+
+// FileResourceTemplate returns the template of the URIs of the files in the allowed directories.
+func FileResourceTemplate() mcp.ResourceTemplate {
+	return mcp.NewResourceTemplate(fileURITemplate, "file",
+		mcp.WithTemplateDescription("A file in one of the allowed directories, by absolute path."),
+	)
+}
+
+// ListResources runs lister, typically a wrapped ResourceLister, for a page of resources.
+func ListResources(ctx context.Context, lister tester.ToolHandler, cursor mcp.Cursor, allowedDirs []string) (*mcp.ListResourcesResult, error) {
+	req := mcp.CallToolRequest{}
+	req.Params.Name = lister.Tool.Name
+	req.Params.Arguments = map[string]interface{}{"cursor": string(cursor)}
+	result, err := callResourceHandler(ctx, lister, req, allowedDirs)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := result.StructuredContent.(mcp.ListResourcesResult)
+	if !ok {
+		return nil, errors.New("unexpected resource list result")
+	}
+	return &list, nil
+}
+
+// ReadResource runs reader, typically a wrapped ResourceReader, to read the resource at uri.
+func ReadResource(ctx context.Context, reader tester.ToolHandler, uri string, allowedDirs []string) ([]mcp.ResourceContents, error) {
+	req := mcp.CallToolRequest{}
+	req.Params.Name = reader.Tool.Name
+	req.Params.Arguments = map[string]interface{}{"uri": uri}
+	result, err := callResourceHandler(ctx, reader, req, allowedDirs)
+	if err != nil {
+		return nil, err
+	}
+	var contents []mcp.ResourceContents
+	for _, c := range result.Content {
+		if embedded, ok := c.(mcp.EmbeddedResource); ok {
+			contents = append(contents, embedded.Resource)
+		}
+	}
+	return contents, nil
+}
+
+// callResourceHandler calls h, turning an error result into an error.
+func callResourceHandler(ctx context.Context, h tester.ToolHandler, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	result, err := h.Handler(ctx, req, allowedDirs)
+	if err != nil {
+		return nil, err
+	}
+	if result.IsError {
+		var messages []string
+		for _, c := range result.Content {
+			if text, ok := c.(mcp.TextContent); ok {
+				messages = append(messages, text.Text)
+			}
+		}
+		return nil, errors.New(strings.Join(messages, "\n"))
+	}
+	return result, nil
+}
+
+// listResourcesArgs are the arguments of ResourceLister.
+type listResourcesArgs struct {
+	Cursor string `arg:"cursor"`
+}
+
+// resourceArgs are the arguments of ResourceReader and of the subscriber of Subscriptions.
+type resourceArgs struct {
+	URI string `arg:"uri,required"`
+}
+
+// ListResourcesHandler lists a page of the regular files in the allowed directories, in walk order.
+// The cursor is the base64-encoded path of the last entry visited for the previous page, so that
+// a page cut short by the walk limits is continued where it stopped.
+func ListResourcesHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[listResourcesArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	after := ""
+	first := 0
+	if args.Cursor != "" {
+		decoded, err := base64.StdEncoding.DecodeString(args.Cursor)
+		if err != nil {
+			return mcp.NewToolResultError("invalid cursor"), nil
+		}
+		after = string(decoded)
+		first = slices.Index(allowedDirs, rootOf(after, allowedDirs))
+		if first < 0 {
+			return mcp.NewToolResultError("invalid cursor: the allowed directories have changed"), nil
+		}
+	}
+
+	resources := []mcp.Resource{}
+	budget := newWalkBudget(ctx, "")
+	defer budget.end()
+	last := ""
+	full := false
+	for i, root := range allowedDirs[first:] {
+		if i > 0 {
+			// Only the directory of the cursor was partly listed
+			after = ""
+		}
+		err := walkDir(backendFromContext(ctx), root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				// Unreadable entries are left out of the listing
+				warn(ctx, "Skipped unreadable entry", path, err)
+				if entry != nil && entry.IsDir() && path != root {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			// The cursor and its parents were visited by the previous page, but
+			// the walk resumes from them; anything before them was listed already
+			resumed := after != "" && isWithin(after, path)
+			if after != "" && !resumed && compareWalkOrder(path, after) < 0 {
+				if entry.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if path == root {
+				return nil
+			}
+			if !resumed && !budget.next() {
+				if err := budget.err(); err != nil {
+					return err
+				}
+				return fs.SkipAll
+			}
+			info, err := entry.Info()
+			if err != nil {
+				last = path
+				return nil
+			}
+			if isDeniedEntry(ctx, path, info) {
+				last = path
+				if entry.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if resumed || !info.Mode().IsRegular() {
+				last = path
+				return nil
+			}
+			if len(resources) == resourcePageSize {
+				full = true
+				return fs.SkipAll
+			}
+			last = path
+			resources = append(resources, fileResource(root, path, info))
+			return nil
+		})
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if full || budget.marker() != "" {
+			break
+		}
+	}
+
+	result := mcp.ListResourcesResult{Resources: resources}
+	if (full || budget.marker() != "") && last != "" {
+		result.NextCursor = mcp.Cursor(base64.StdEncoding.EncodeToString([]byte(last)))
+	}
+	return mcp.NewToolResultStructured(result, fmt.Sprintf("%d resources", len(resources))), nil
+}
+
+// ReadResourceHandler reads a file resource, as text if it is valid UTF-8 and as a blob otherwise.
+func ReadResourceHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[resourceArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	path, err := fileURIPath(args.URI)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	validPath, err := validatePath(ctx, path, allowedDirs)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	info, err := backendFromContext(ctx).Stat(validPath)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !info.Mode().IsRegular() {
+		return mcp.NewToolResultError(fmt.Sprintf("not a regular file: %s", path)), nil
+	}
+	// Resources are read whole, as a truncated file would be indistinguishable from the real one
+	if err := checkFileSize(ctx, validPath); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	content, err := readFileContext(ctx, validPath)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	noteRead(ctx, len(content))
+
+	var contents mcp.ResourceContents
+	if isText(content) {
+		contents = mcp.TextResourceContents{URI: args.URI, MIMEType: mimeType(validPath, content), Text: string(content)}
+	} else {
+		contents = mcp.BlobResourceContents{
+			URI:      args.URI,
+			MIMEType: mimeType(validPath, content),
+			Blob:     base64.StdEncoding.EncodeToString(content),
+		}
+	}
+	return &mcp.CallToolResult{Content: []mcp.Content{mcp.NewEmbeddedResource(contents)}}, nil
+}
+
+// fileResource describes the file at path, found under root.
+func fileResource(root, path string, info os.FileInfo) mcp.Resource {
+	name, err := filepath.Rel(root, path)
+	if err != nil {
+		name = info.Name()
+	}
+	return mcp.NewResource(fileURI(path), filepath.ToSlash(name),
+		mcp.WithMIMEType(mimeType(path, nil)),
+		mcp.WithResourceSize(info.Size()),
+	)
+}
+
+// fileURI returns the file:// URI of an absolute path.
+func fileURI(path string) string {
+	slashed := filepath.ToSlash(path)
+	if !strings.HasPrefix(slashed, "/") {
+		// Windows drive letters
+		slashed = "/" + slashed
+	}
+	u := url.URL{Scheme: "file", Path: slashed}
+	return u.String()
+}
+
+// isText reports whether content can be returned as text.
+func isText(content []byte) bool {
+	return utf8.Valid(content) && !bytes.ContainsRune(content, 0)
+}
+
+// mimeType guesses the MIME type of a file from its extension, or else from its content if known.
+func mimeType(path string, content []byte) string {
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" && content != nil {
+		mimeType = http.DetectContentType(content)
+	}
+	if mimeType == "" {
+		return ""
+	}
+	if base, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = base
+	}
+	if mimeType == "application/octet-stream" && content != nil && isText(content) {
+		return "text/plain"
+	}
+	return mimeType
+}
+
+// isWithin reports whether path is dir or inside it.
+func isWithin(path, dir string) bool {
+	return rootOf(path, []string{dir}) != ""
+}
+
+// compareWalkOrder compares two paths in the order walkDir visits them,
+// which sorts the entries of each directory by name before descending into them.
+func compareWalkOrder(a, b string) int {
+	as := strings.Split(filepath.Clean(a), string(filepath.Separator))
+	bs := strings.Split(filepath.Clean(b), string(filepath.Separator))
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := strings.Compare(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return len(as) - len(bs)
+}
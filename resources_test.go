@@ -0,0 +1,165 @@
+package top
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResources(t *testing.T) {
+	tempDir := t.TempDir()
+	otherDir := t.TempDir()
+	var expected []string
+	write := func(path string, content []byte) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		expected = append(expected, path)
+	}
+	for i := 0; i < 120; i++ {
+		write(filepath.Join(tempDir, "many", fmt.Sprintf("file%03d.txt", i)), []byte("small"))
+	}
+	write(filepath.Join(tempDir, "a", "b", "c", "deep.md"), []byte("# Deep"))
+	write(filepath.Join(otherDir, "image.bin"), []byte{0x89, 'P', 'N', 'G', 0, 1, 2})
+	textFile := filepath.Join(tempDir, "test.txt")
+	write(textFile, []byte("Hello, world!"))
+	if err := os.MkdirAll(filepath.Join(tempDir, "empty", "dir"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	slices.Sort(expected)
+	allowedDirs := []string{tempDir, otherDir}
+
+	listAll := func(t *testing.T, lister func(cursor mcp.Cursor) (*mcp.ListResourcesResult, error)) []string {
+		t.Helper()
+		var paths []string
+		var cursor mcp.Cursor
+		for pages := 0; pages < 100; pages++ {
+			list, err := lister(cursor)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(list.Resources) > resourcePageSize {
+				t.Errorf("Page of %d resources exceeds the page size", len(list.Resources))
+			}
+			for _, resource := range list.Resources {
+				path, err := fileURIPath(resource.URI)
+				if err != nil {
+					t.Fatalf("Invalid URI %s: %v", resource.URI, err)
+				}
+				paths = append(paths, path)
+			}
+			if list.NextCursor == "" {
+				slices.Sort(paths)
+				return paths
+			}
+			cursor = list.NextCursor
+		}
+		t.Fatalf("Listing did not end")
+		return nil
+	}
+
+	t.Run("List pages through all files", func(t *testing.T) {
+		list, err := ListResources(context.Background(), ResourceLister, "", allowedDirs)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(list.Resources) != resourcePageSize || list.NextCursor == "" {
+			t.Errorf("Expected a full first page with a cursor, got %d resources", len(list.Resources))
+		}
+		deep := list.Resources[0]
+		if deep.Name != "a/b/c/deep.md" || deep.MIMEType != "text/markdown" || deep.Size == nil || *deep.Size != 6 {
+			t.Errorf("Unexpected resource: %+v", deep)
+		}
+		paths := listAll(t, func(cursor mcp.Cursor) (*mcp.ListResourcesResult, error) {
+			return ListResources(context.Background(), ResourceLister, cursor, allowedDirs)
+		})
+		if !slices.Equal(paths, expected) {
+			t.Errorf("Expected %d files, got %d: %v", len(expected), len(paths), paths)
+		}
+	})
+
+	t.Run("List continues after walk limit", func(t *testing.T) {
+		lister := Limits{MaxWalkEntries: 7}.Wrap(ResourceLister)
+		paths := listAll(t, func(cursor mcp.Cursor) (*mcp.ListResourcesResult, error) {
+			return ListResources(context.Background(), lister, cursor, allowedDirs)
+		})
+		if !slices.Equal(paths, expected) {
+			t.Errorf("Expected %d files, got %d: %v", len(expected), len(paths), paths)
+		}
+	})
+
+	t.Run("List leaves out denied files", func(t *testing.T) {
+		policy, err := NewPolicy(nil, []string{"many/"})
+		if err != nil {
+			t.Fatalf("Failed to create policy: %v", err)
+		}
+		list, err := ListResources(context.Background(), policy.Wrap(ResourceLister), "", allowedDirs)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(list.Resources) != 3 || list.NextCursor != "" {
+			t.Errorf("Expected 3 resources, got %v", list.Resources)
+		}
+	})
+
+	t.Run("List rejects cursor outside allowed directories", func(t *testing.T) {
+		cursor := mcp.Cursor(base64.StdEncoding.EncodeToString([]byte("/elsewhere")))
+		if _, err := ListResources(context.Background(), ResourceLister, cursor, allowedDirs); err == nil {
+			t.Errorf("Expected error for foreign cursor")
+		}
+	})
+
+	t.Run("Read text file", func(t *testing.T) {
+		contents, err := ReadResource(context.Background(), ResourceReader, fileURI(textFile), allowedDirs)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		text, ok := contents[0].(mcp.TextResourceContents)
+		if !ok || text.Text != "Hello, world!" || text.MIMEType != "text/plain" || text.URI != fileURI(textFile) {
+			t.Errorf("Unexpected contents: %+v", contents)
+		}
+	})
+
+	t.Run("Read binary file", func(t *testing.T) {
+		path := filepath.Join(otherDir, "image.bin")
+		contents, err := ReadResource(context.Background(), ResourceReader, fileURI(path), allowedDirs)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		blob, ok := contents[0].(mcp.BlobResourceContents)
+		if !ok || blob.Blob != base64.StdEncoding.EncodeToString([]byte{0x89, 'P', 'N', 'G', 0, 1, 2}) ||
+			blob.MIMEType != "application/octet-stream" {
+			t.Errorf("Unexpected contents: %+v", contents)
+		}
+	})
+
+	t.Run("Read is restricted", func(t *testing.T) {
+		for _, uri := range []string{
+			fileURI(filepath.Join(t.TempDir(), "outside.txt")),
+			fileURI(filepath.Join(tempDir, "many")),
+			"http://example.com/test.txt",
+			"file://host/test.txt",
+		} {
+			if _, err := ReadResource(context.Background(), ResourceReader, uri, allowedDirs); err == nil {
+				t.Errorf("Expected error reading %s", uri)
+			}
+		}
+		policy, err := NewPolicy(nil, []string{"*.txt"})
+		if err != nil {
+			t.Fatalf("Failed to create policy: %v", err)
+		}
+		_, err = ReadResource(context.Background(), policy.Wrap(ResourceReader), fileURI(textFile), allowedDirs)
+		if err == nil || !strings.Contains(err.Error(), "denied") {
+			t.Errorf("Expected access denied, got %v", err)
+		}
+	})
+}
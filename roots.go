@@ -0,0 +1,211 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Roots derives the allowed directories of each session from the roots exposed by its client.
+// The directories the server was started with act as a ceiling: a client root inside one of them
+// is allowed as is, a client root containing one of them only allows that directory, and any
+// other client root is ignored. Without a ceiling, client roots are allowed as they are.
+// Sessions whose client does not support roots, and requests without a session, keep the ceiling.
+type Roots struct {
+	mu       sync.Mutex
+	sessions map[string]*sessionRoots
+}
+
+// sessionRoots caches the directories listed by the client of a session.
+type sessionRoots struct {
+	// generation is incremented whenever the client reports a change, so that
+	// a listing started before the change is not cached after it.
+	generation int
+	valid      bool
+	// supported is false if the client does not provide roots, in which case dirs is unused.
+	supported bool
+	dirs      []string
+}
+
+// NewRoots creates a tracker of client roots.
+func NewRoots() *Roots {
+	return &Roots{sessions: map[string]*sessionRoots{}}
+}
+
+// Wrap returns a copy of t whose handler is given the allowed directories of the calling session,
+// within the allowed directories it is called with.
+func (r *Roots) Wrap(t tester.ToolHandler) tester.ToolHandler {
+	handler := t.Handler
+	t.Handler = func(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+		dirs, err := r.AllowedDirectories(ctx, allowedDirs)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return handler(context.WithValue(ctx, ceilingKey{}, allowedDirs), req, dirs)
+	}
+	return t
+}
+
+// AllowedDirectories returns the allowed directories of the session in ctx, within ceiling.
+// Roots are requested from the client the first time and after it reports a change.
+func (r *Roots) AllowedDirectories(ctx context.Context, ceiling []string) ([]string, error) {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil || session.SessionID() == "" || !supportsRoots(session) {
+		// Sessionless requests, as in stateless HTTP, have nowhere to keep roots apart
+		return ceiling, nil
+	}
+	r.mu.Lock()
+	cached := r.sessionLocked(session.SessionID())
+	generation, valid, supported, dirs := cached.generation, cached.valid, cached.supported, cached.dirs
+	r.mu.Unlock()
+
+	if !valid {
+		var err error
+		supported, dirs, err = listRoots(ctx, session)
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		if cached.generation == generation {
+			cached.valid, cached.supported, cached.dirs = true, supported, dirs
+		}
+		r.mu.Unlock()
+	}
+	if !supported {
+		return ceiling, nil
+	}
+	return intersectDirs(dirs, ceiling), nil
+}
+
+func (r *Roots) sessionLocked(id string) *sessionRoots {
+	cached, ok := r.sessions[id]
+	if !ok {
+		cached = &sessionRoots{}
+		r.sessions[id] = cached
+	}
+	return cached
+}
+
+// ListChanged handles notifications/roots/list_changed by requesting the roots again on the next call.
+func (r *Roots) ListChanged(ctx context.Context, _ mcp.JSONRPCNotification) {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil || session.SessionID() == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cached := r.sessionLocked(session.SessionID())
+	cached.generation++
+	cached.valid = false
+}
+
+// Forget drops the roots of a session that has ended.
+func (r *Roots) Forget(_ context.Context, session server.ClientSession) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, session.SessionID())
+}
+
+// supportsRoots reports whether the client of session declared the roots capability.
+func supportsRoots(session server.ClientSession) bool {
+	if _, ok := session.(server.SessionWithRoots); !ok {
+		return false
+	}
+	withInfo, ok := session.(server.SessionWithClientInfo)
+	return ok && withInfo.GetClientCapabilities().Roots != nil
+}
+
+// listRoots requests the roots of the client of session and returns the directories they name.
+// A client that fails to list its roots is treated as not supporting them, unless ctx is done.
+func listRoots(ctx context.Context, session server.ClientSession) (bool, []string, error) {
+	result, err := session.(server.SessionWithRoots).ListRoots(ctx, mcp.ListRootsRequest{
+		Request: mcp.Request{Method: string(mcp.MethodListRoots)},
+	})
+	if ctx.Err() != nil {
+		return false, nil, ctx.Err()
+	} else if err != nil {
+		return false, nil, nil
+	}
+	dirs := []string{}
+	for _, root := range result.Roots {
+		dir, err := fileURIPath(root.URI)
+		if err != nil {
+			continue
+		}
+		if info, err := backendFromContext(ctx).Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	return true, dirs, nil
+}
+
+// fileURIPath converts a file:// URI to a clean absolute path.
+func fileURIPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" || (u.Host != "" && u.Host != "localhost") {
+		return "", fmt.Errorf("not a local file URI: %s", uri)
+	}
+	path := u.Path
+	if runtime.GOOS == "windows" {
+		// file:///C:/dir has the path /C:/dir
+		path = strings.TrimPrefix(path, "/")
+	}
+	path = filepath.FromSlash(path)
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("not an absolute path: %s", uri)
+	}
+	return filepath.Clean(path), nil
+}
+
+// intersectDirs returns the parts of dirs that lie within ceiling, or dirs itself if there is no ceiling.
+func intersectDirs(dirs []string, ceiling []string) []string {
+	if len(ceiling) == 0 {
+		return dirs
+	}
+	result := []string{}
+	add := func(dir string) {
+		for _, existing := range result {
+			if existing == dir {
+				return
+			}
+		}
+		result = append(result, dir)
+	}
+	for _, dir := range dirs {
+		if rootOf(dir, ceiling) != "" {
+			add(dir)
+			continue
+		}
+		for _, limit := range ceiling {
+			if rootOf(limit, []string{dir}) != "" {
+				add(limit)
+			}
+		}
+	}
+	return result
+}
+
+type ceilingKey struct{}
+
+// anchorOf returns the directory that policies and quotas apply to for path: the directory the server
+// was started with that contains it, if the allowed directories were narrowed to client roots, or
+// else the allowed directory that contains it. It returns "" if path is in neither.
+func anchorOf(ctx context.Context, path string, allowedDirs []string) string {
+	if ceiling, _ := ctx.Value(ceilingKey{}).([]string); len(ceiling) > 0 {
+		if root := rootOf(path, ceiling); root != "" {
+			return root
+		}
+	}
+	return rootOf(path, allowedDirs)
+}
@@ -0,0 +1,171 @@
+package top
+
+import (
+	"context"
+	"errors"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rootsSession is a client session exposing a settable list of roots.
+type rootsSession struct {
+	id           string
+	roots        []string
+	err          error
+	capabilities mcp.ClientCapabilities
+	listed       int
+}
+
+func (s *rootsSession) Initialize()                                         {}
+func (s *rootsSession) Initialized() bool                                   { return true }
+func (s *rootsSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return nil }
+func (s *rootsSession) SessionID() string                                   { return s.id }
+func (s *rootsSession) GetClientInfo() mcp.Implementation                   { return mcp.Implementation{} }
+func (s *rootsSession) SetClientInfo(mcp.Implementation)                    {}
+func (s *rootsSession) GetClientCapabilities() mcp.ClientCapabilities       { return s.capabilities }
+func (s *rootsSession) SetClientCapabilities(c mcp.ClientCapabilities)      { s.capabilities = c }
+func (s *rootsSession) ListRoots(context.Context, mcp.ListRootsRequest) (*mcp.ListRootsResult, error) {
+	s.listed++
+	if s.err != nil {
+		return nil, s.err
+	}
+	result := &mcp.ListRootsResult{}
+	for _, dir := range s.roots {
+		uri := url.URL{Scheme: "file", Path: filepath.ToSlash(dir)}
+		result.Roots = append(result.Roots, mcp.Root{URI: uri.String()})
+	}
+	return result, nil
+}
+
+func TestRoots(t *testing.T) {
+	ceiling := t.TempDir()
+	outside := t.TempDir()
+	project := filepath.Join(ceiling, "project")
+	secrets := filepath.Join(ceiling, "secrets")
+	for _, dir := range []string{project, secrets} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("content"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	session := &rootsSession{id: "roots-test"}
+	session.capabilities.Roots = &struct {
+		ListChanged bool `json:"listChanged,omitempty"`
+	}{ListChanged: true}
+	ctx := server.NewMCPServer("test", "1.0").WithContext(context.Background(), session)
+	roots := NewRoots()
+	allowed := func(t *testing.T, ctx context.Context, ceiling []string) []string {
+		t.Helper()
+		dirs, err := roots.AllowedDirectories(ctx, ceiling)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return dirs
+	}
+	expect := func(t *testing.T, got []string, expected ...string) {
+		t.Helper()
+		if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	}
+	changeRoots := func(dirs ...string) {
+		session.roots = dirs
+		roots.ListChanged(ctx, mcp.JSONRPCNotification{})
+	}
+
+	t.Run("No session keeps the ceiling", func(t *testing.T) {
+		expect(t, allowed(t, context.Background(), []string{ceiling}), ceiling)
+	})
+
+	t.Run("Client roots are narrowed to the ceiling", func(t *testing.T) {
+		changeRoots(project, outside, "/")
+		expect(t, allowed(t, ctx, []string{ceiling}), project, ceiling)
+	})
+
+	t.Run("Roots are cached until the client reports a change", func(t *testing.T) {
+		changeRoots(project)
+		listed := session.listed
+		allowed(t, ctx, []string{ceiling})
+		expect(t, allowed(t, ctx, []string{ceiling}), project)
+		if session.listed != listed+1 {
+			t.Errorf("Expected roots to be listed once, got %d times", session.listed-listed)
+		}
+		session.roots = []string{secrets}
+		expect(t, allowed(t, ctx, []string{ceiling}), project)
+		roots.ListChanged(ctx, mcp.JSONRPCNotification{})
+		expect(t, allowed(t, ctx, []string{ceiling}), secrets)
+	})
+
+	t.Run("Without a ceiling client roots are allowed", func(t *testing.T) {
+		changeRoots(outside, filepath.Join(ceiling, "missing"))
+		expect(t, allowed(t, ctx, nil), outside)
+	})
+
+	t.Run("Failing client keeps the ceiling", func(t *testing.T) {
+		session.err = errors.New("no roots handler")
+		defer func() { session.err = nil }()
+		changeRoots(project)
+		expect(t, allowed(t, ctx, []string{ceiling}), ceiling)
+	})
+
+	t.Run("Forgotten session lists roots again", func(t *testing.T) {
+		changeRoots(project)
+		allowed(t, ctx, []string{ceiling})
+		listed := session.listed
+		roots.Forget(ctx, session)
+		allowed(t, ctx, []string{ceiling})
+		if session.listed != listed+1 {
+			t.Errorf("Expected roots to be listed again")
+		}
+	})
+
+	t.Run("Policy applies to the ceiling", func(t *testing.T) {
+		policy, err := NewPolicy([]string{ceiling}, []string{"secrets/"})
+		if err != nil {
+			t.Fatalf("Failed to create policy: %v", err)
+		}
+		call := func(t *testing.T, name string, args map[string]interface{}) (bool, string) {
+			t.Helper()
+			for _, tool := range Tools {
+				if tool.Tool.Name == name {
+					req := mcp.CallToolRequest{}
+					req.Params.Name = name
+					req.Params.Arguments = args
+					result, err := roots.Wrap(policy.Wrap(tool)).Handler(ctx, req, []string{ceiling})
+					if err != nil {
+						t.Fatalf("Unexpected error: %v", err)
+					}
+					return result.IsError, result.Content[0].(mcp.TextContent).Text
+				}
+			}
+			t.Fatalf("Tool %s not found", name)
+			return false, ""
+		}
+
+		changeRoots(secrets, project)
+		if isError, text := call(t, "list_allowed_directories", nil); isError || text != "Allowed directories:\n"+secrets+"\n"+project {
+			t.Errorf("Unexpected allowed directories: %s", text)
+		}
+		if isError, text := call(t, "read_file", map[string]interface{}{"path": filepath.Join(secrets, "file.txt")}); !isError || !strings.Contains(text, "deny pattern") {
+			t.Errorf("Expected deny error, got: %s", text)
+		}
+		if isError, text := call(t, "write_file", map[string]interface{}{"path": filepath.Join(project, "new.txt"), "content": "x"}); !isError || !strings.Contains(text, "read-only") {
+			t.Errorf("Expected read-only error, got: %s", text)
+		}
+		if isError, text := call(t, "read_file", map[string]interface{}{"path": filepath.Join(ceiling, "project", "..", "secrets", "file.txt")}); !isError {
+			t.Errorf("Expected error, got: %s", text)
+		}
+		changeRoots(project)
+		if isError, text := call(t, "read_file", map[string]interface{}{"path": filepath.Join(secrets, "file.txt")}); !isError || !strings.Contains(text, "outside allowed directories") {
+			t.Errorf("Expected outside error, got: %s", text)
+		}
+	})
+}
@@ -3,7 +3,7 @@ package top
 import (
 	"context"
 	"github.com/mark3labs/mcp-go/mcp"
-	"os"
+	"io/fs"
 	"path/filepath"
 	"strings"
 )
@@ -16,47 +16,43 @@ func DefineSearchFilesTool() mcp.Tool {
 				"is case-insensitive and matches partial names. Returns full paths to all "+
 				"matching items. Great for finding files when you don't know their exact location. "+
 				"Only searches within allowed directories."),
-		mcp.WithString("path", mcp.Required(), mcp.Description("Starting path")),
-		mcp.WithString("pattern", mcp.Required(), mcp.Description("Search pattern")),
-		mcp.WithArray("excludePatterns",
-			mcp.Description("Patterns to exclude"),
-			func(schema map[string]interface{}) {
-				schema["default"] = []interface{}{}
-			},
-			mcp.Items(map[string]interface{}{
-				"type": "string",
-			}),
-		),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+		withArguments[SearchFilesArgs](),
 	)
 }
 
-func SearchFilesHandler(_ context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
-	path, ok := req.Params.Arguments["path"].(string)
-	if !ok {
-		return mcp.NewToolResultError("path must be a string"), nil
-	}
-	pattern, ok := req.Params.Arguments["pattern"].(string)
-	if !ok {
-		return mcp.NewToolResultError("pattern must be a string"), nil
+// SearchFilesArgs are the arguments of search_files.
+type SearchFilesArgs struct {
+	Path            string   `arg:"path,required" desc:"Starting path"`
+	Pattern         string   `arg:"pattern,required" desc:"Search pattern"`
+	ExcludePatterns []string `arg:"excludePatterns,default=[]" desc:"Patterns to exclude"`
+}
+
+func SearchFilesHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[SearchFilesArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 	excludeMatcher := NewExcludeMatcher()
-	excludePatterns, _ := req.Params.Arguments["excludePatterns"].([]interface{})
-	for _, ep := range excludePatterns {
-		epString := ep.(string)
-		if epString == "" {
+	for _, ep := range args.ExcludePatterns {
+		if ep == "" {
 			continue
 		}
-		err := excludeMatcher.AddPattern(epString)
+		err := excludeMatcher.AddPattern(ep)
 		if err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
 	}
-	validPath, err := validatePath(path, allowedDirs)
+	ctx = withProgress(ctx, req, "entries scanned")
+	validPath, err := validatePath(ctx, args.Path, allowedDirs)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 	// Return an error if the path is not a directory
-	info, err := os.Stat(validPath)
+	info, err := backendFromContext(ctx).Stat(validPath)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
@@ -65,11 +61,31 @@ func SearchFilesHandler(_ context.Context, req mcp.CallToolRequest, allowedDirs
 	}
 
 	var results []string
-	pattern = strings.ToLower(pattern)
-	err = filepath.Walk(validPath, func(filePath string, info os.FileInfo, err error) error {
+	pattern := strings.ToLower(args.Pattern)
+	budget := newWalkBudget(ctx, validPath)
+	defer budget.end()
+	err = walkDir(backendFromContext(ctx), validPath, func(filePath string, entry fs.DirEntry, err error) error {
 		if err != nil {
+			warn(ctx, "Skipped unreadable entry", filePath, err)
 			return nil // Skip errors
 		}
+		info, err := entry.Info()
+		if err != nil {
+			warn(ctx, "Skipped unreadable entry", filePath, err)
+			return nil
+		}
+		if !budget.next() {
+			if err := budget.err(); err != nil {
+				return err
+			}
+			return filepath.SkipAll
+		}
+		if isDeniedEntry(ctx, filePath, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		// Check relative path against exclude patterns
 		if excludeMatcher.Match(validPath, filePath, info) {
 			return nil
@@ -83,7 +99,7 @@ func SearchFilesHandler(_ context.Context, req mcp.CallToolRequest, allowedDirs
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 	if len(results) == 0 {
-		return mcp.NewToolResultText("No matches found"), nil
+		return mcp.NewToolResultText("No matches found" + budget.marker()), nil
 	}
-	return mcp.NewToolResultText(strings.Join(results, "\n")), nil
+	return mcp.NewToolResultText(strings.Join(results, "\n") + budget.marker()), nil
 }
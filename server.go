@@ -0,0 +1,376 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"log/slog"
+	"slices"
+)
+
+// Root is a directory the server allows access to.
+type Root struct {
+	// Path is the directory, or a .zip, .tar, .tar.gz or .tar.zst archive served as a read-only
+	// directory. Archives are indexed when the server is built, and the content of their files is read
+	// from them, or held in memory for compressed tar archives.
+	Path string
+	// ReadOnly forbids modifying anything inside the directory.
+	ReadOnly bool
+	// Quota overrides the server-wide quota of the directory with its non-zero fields.
+	Quota Quota
+}
+
+// Option configures the server built by NewServer.
+type Option func(*serverConfig) error
+
+// serverConfig is what NewServer builds a server from.
+type serverConfig struct {
+	name, version string
+	backend       Backend
+	overlay       bool
+	overlayBytes  int64
+	archiveBytes  int64
+	roots         []Root
+	deny          []string
+	tools         []string
+	toolNames     map[string]string
+	toolPrefix    string
+	limits        Limits
+	quota         Quota
+	middlewares   []tester.Middleware
+	hooks         []func(*server.Hooks)
+	prompts       []PromptHandler
+	options       []server.ServerOption
+}
+
+// WithServerInfo sets the name and version the server reports to clients.
+func WithServerInfo(name, version string) Option {
+	return func(c *serverConfig) error {
+		c.name, c.version = name, version
+		return nil
+	}
+}
+
+// WithBackend serves b rather than the local filesystem. Watching and resource subscriptions are only
+// available on the local filesystem.
+func WithBackend(b Backend) Option {
+	return func(c *serverConfig) error {
+		c.backend = b
+		return nil
+	}
+}
+
+// WithOverlay runs the server in overlay mode: the changes of each session are kept in memory, over the
+// backend, until the session commits them with overlay_commit, which only this mode exposes. Each session
+// holds up to maxBytes of file content, or any amount if it is 0. Watching and resource subscriptions are
+// unavailable in this mode.
+func WithOverlay(maxBytes int64) Option {
+	return func(c *serverConfig) error {
+		c.overlay, c.overlayBytes = true, maxBytes
+		return nil
+	}
+}
+
+// WithRoots adds directories the server allows access to. Clients that expose roots are further
+// restricted to those inside them.
+func WithRoots(roots ...Root) Option {
+	return func(c *serverConfig) error {
+		c.roots = append(c.roots, roots...)
+		return nil
+	}
+}
+
+// WithDeny adds gitignore-style patterns of paths, relative to their allowed directory, that may not
+// be accessed at all.
+func WithDeny(patterns ...string) Option {
+	return func(c *serverConfig) error {
+		c.deny = append(c.deny, patterns...)
+		return nil
+	}
+}
+
+// WithTools enables only the named tools, by their original names. All tools are enabled by default.
+// Files are exposed as resources only if read_file is enabled.
+func WithTools(names ...string) Option {
+	return func(c *serverConfig) error {
+		for _, name := range names {
+			if !slices.ContainsFunc(Tools, func(t tester.ToolHandler) bool { return t.Tool.Name == name }) {
+				return fmt.Errorf("unknown tool %q", name)
+			}
+		}
+		c.tools = append(c.tools, names...)
+		return nil
+	}
+}
+
+// WithToolName exposes a tool under another name. The prefix set by WithToolPrefix is not added to it.
+func WithToolName(name, newName string) Option {
+	return func(c *serverConfig) error {
+		if c.toolNames == nil {
+			c.toolNames = map[string]string{}
+		}
+		c.toolNames[name] = newName
+		return nil
+	}
+}
+
+// WithToolPrefix prefixes the names of the tools, such as fs_ for fs_read_file, so that they can be
+// mounted alongside other tools without clashing.
+func WithToolPrefix(prefix string) Option {
+	return func(c *serverConfig) error {
+		c.toolPrefix = prefix
+		return nil
+	}
+}
+
+// WithCallLimits sets the resources a single call may consume.
+func WithCallLimits(limits Limits) Option {
+	return func(c *serverConfig) error {
+		c.limits = limits
+		return nil
+	}
+}
+
+// WithArchiveBytes limits the content that archive roots whose files cannot be read in place, such as
+// compressed tar archives, hold in memory to maxBytes each. Building the server fails for larger archives.
+func WithArchiveBytes(maxBytes int64) Option {
+	return func(c *serverConfig) error {
+		c.archiveBytes = maxBytes
+		return nil
+	}
+}
+
+// WithQuota sets the quota of each session under each allowed directory, unless its root overrides it.
+func WithQuota(quota Quota) Option {
+	return func(c *serverConfig) error {
+		c.quota = quota
+		return nil
+	}
+}
+
+// WithMiddleware adds middlewares around tools, resources, prompts and completions. They wrap the
+// restrictions of the server, the first being the outermost.
+func WithMiddleware(middlewares ...tester.Middleware) Option {
+	return func(c *serverConfig) error {
+		c.middlewares = append(c.middlewares, middlewares...)
+		return nil
+	}
+}
+
+// WithMetrics collects metrics of calls and sessions, as a middleware added in order with the others.
+func WithMetrics(metrics *Metrics) Option {
+	return func(c *serverConfig) error {
+		c.middlewares = append(c.middlewares, metrics.Wrap)
+		c.hooks = append(c.hooks, func(hooks *server.Hooks) {
+			hooks.AddOnRegisterSession(metrics.Register)
+			hooks.AddOnUnregisterSession(metrics.Forget)
+		})
+		return nil
+	}
+}
+
+// WithPrompts adds prompts, replacing built-in prompts of the same name.
+func WithPrompts(prompts ...PromptHandler) Option {
+	return func(c *serverConfig) error {
+		c.prompts = append(c.prompts, prompts...)
+		return nil
+	}
+}
+
+// WithServerOptions adds options of the underlying MCP server. Hooks must not be set this way, as the
+// server relies on its own.
+func WithServerOptions(options ...server.ServerOption) Option {
+	return func(c *serverConfig) error {
+		c.options = append(c.options, options...)
+		return nil
+	}
+}
+
+// Server is an MCP server exposing the filesystem tools, resources and prompts. Other tools may be
+// added to it. Close releases the watches it holds once it is no longer served.
+type Server struct {
+	*server.MCPServer
+	watches       *Watches
+	subscriptions *Subscriptions
+	archives      []*archiveBackend
+}
+
+// NewServer builds a server from options. Every tool, resource, prompt and completion is wrapped by the
+// middlewares, then run on the backend, or the overlay of its session in overlay mode, and restricted
+// by the limits, client roots, quotas and policy of the server.
+func NewServer(opts ...Option) (*Server, error) {
+	c := &serverConfig{name: "secure-filesystem-server", version: "0.2.0", backend: OSBackend{}}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	allowedDirs := make([]string, 0, len(c.roots))
+	var readOnly []string
+	quotas := NewQuotas(c.quota)
+	mounts := &mountBackend{base: c.backend}
+	srv := &Server{watches: NewWatches()}
+	for _, root := range c.roots {
+		allowedDirs = append(allowedDirs, root.Path)
+		if info, err := c.backend.Stat(root.Path); err == nil && !info.IsDir() && IsArchive(root.Path) {
+			archive, err := openArchive(c.backend, root.Path, c.archiveBytes)
+			if err != nil {
+				srv.Close()
+				return nil, err
+			}
+			srv.archives = append(srv.archives, archive)
+			mounts.mount(root.Path, archive)
+			root.ReadOnly = true
+		}
+		if root.ReadOnly {
+			readOnly = append(readOnly, root.Path)
+		}
+		if root.Quota != (Quota{}) {
+			quota := quotas.Quota(root.Path)
+			if root.Quota.MaxBytes != 0 {
+				quota.MaxBytes = root.Quota.MaxBytes
+			}
+			if root.Quota.MaxFiles != 0 {
+				quota.MaxFiles = root.Quota.MaxFiles
+			}
+			quotas.SetQuota(root.Path, quota)
+		}
+	}
+	policy, err := NewPolicy(readOnly, c.deny)
+	if err != nil {
+		srv.Close()
+		return nil, err
+	}
+	roots := NewRoots()
+	backend := c.backend
+	if len(mounts.points) > 0 {
+		backend = mounts
+	}
+	middlewares := append(slices.Clone(c.middlewares), UseBackend(backend))
+	overlays := NewOverlays(c.overlayBytes)
+	if c.overlay {
+		middlewares = append(middlewares, overlays.Wrap)
+	}
+	wrap := tester.Chain(append(middlewares,
+		c.limits.Wrap, roots.Wrap, quotas.Wrap, srv.watches.Wrap, policy.Wrap)...)
+	// Files are exposed as resources to clients that support them, unless read_file is disabled
+	resources := len(c.tools) == 0 || slices.Contains(c.tools, "read_file")
+
+	// Watch the resources that clients subscribe to, if the platform and backend allow
+	if _, local := c.backend.(OSBackend); resources && local && !c.overlay {
+		srv.subscriptions, err = NewSubscriptions(func(session, uri string) {
+			_ = srv.SendNotificationToSpecificClient(session, mcp.MethodNotificationResourceUpdated, map[string]any{"uri": uri})
+		})
+		if err != nil {
+			slog.Warn("Resource subscriptions are unavailable", "error", err)
+		}
+	}
+
+	// Create MCP server, following the roots of clients that expose them
+	hooks := &server.Hooks{}
+	hooks.AddOnUnregisterSession(roots.Forget)
+	hooks.AddOnUnregisterSession(quotas.Forget)
+	hooks.AddOnUnregisterSession(srv.watches.Forget)
+	hooks.AddOnUnregisterSession(overlays.Forget)
+	for _, add := range c.hooks {
+		add(hooks)
+	}
+	options := []server.ServerOption{server.WithHooks(hooks)}
+	if resources {
+		options = append(options, server.WithResourceCapabilities(srv.subscriptions != nil, false))
+	}
+	completions := NewCompletions(wrap(PathCompleter), allowedDirs)
+	options = append(options,
+		server.WithPromptCapabilities(false),
+		server.WithCompletions(),
+		server.WithLogging(),
+		server.WithResourceCompletionProvider(completions),
+		server.WithPromptCompletionProvider(completions),
+	)
+	srv.MCPServer = server.NewMCPServer(c.name, c.version, append(options, c.options...)...)
+	srv.AddNotificationHandler(mcp.MethodNotificationRootsListChanged, roots.ListChanged)
+
+	// Register resources; the files are listed by a hook, as the server only lists registered resources
+	if resources {
+		lister, reader := wrap(ResourceLister), wrap(ResourceReader)
+		hooks.AddAfterListResources(func(ctx context.Context, _ any, req *mcp.ListResourcesRequest, result *mcp.ListResourcesResult) {
+			list, err := ListResources(ctx, lister, req.Params.Cursor, allowedDirs)
+			if err != nil {
+				slog.ErrorContext(ctx, "Error listing resources", "error", err)
+				return
+			}
+			*result = *list
+		})
+		srv.AddResourceTemplate(FileResourceTemplate(), func(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			return ReadResource(ctx, reader, req.Params.URI, allowedDirs)
+		})
+	}
+	if subscriptions := srv.subscriptions; subscriptions != nil {
+		// Subscriptions to resources outside the allowed directories are acknowledged but never notified
+		subscriber := wrap(subscriptions.Subscriber())
+		hooks.AddAfterSubscribe(func(ctx context.Context, _ any, req *mcp.SubscribeRequest, _ *mcp.EmptyResult) {
+			if err := SubscribeResource(ctx, subscriber, req.Params.URI, allowedDirs); err != nil {
+				slog.WarnContext(ctx, "Error subscribing to resource", "uri", req.Params.URI, "error", err)
+			}
+		})
+		hooks.AddAfterUnsubscribe(func(ctx context.Context, _ any, req *mcp.UnsubscribeRequest, _ *mcp.EmptyResult) {
+			if session := server.ClientSessionFromContext(ctx); session != nil {
+				subscriptions.Unsubscribe(session.SessionID(), req.Params.URI)
+			}
+		})
+		hooks.AddOnUnregisterSession(subscriptions.Forget)
+	}
+
+	// Register the built-in prompts and the added ones, which may replace them
+	prompts := slices.Clone(Prompts)
+	for _, p := range c.prompts {
+		prompts = slices.DeleteFunc(prompts, func(other PromptHandler) bool {
+			return other.Prompt.Name == p.Prompt.Name
+		})
+		prompts = append(prompts, p)
+	}
+	for _, p := range prompts {
+		for _, arg := range p.PathArguments {
+			completions.AddPathArgument(p.Prompt.Name, arg)
+		}
+		p.Handler = wrap(p.Handler)
+		srv.AddPrompt(p.Prompt, func(ctx context.Context, req mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			return GetPrompt(ctx, p, req.Params.Arguments, allowedDirs)
+		})
+	}
+
+	// Register tools with handlers, under the names they are exposed as
+	for _, t := range Tools {
+		if len(c.tools) > 0 && !slices.Contains(c.tools, t.Tool.Name) {
+			continue
+		}
+		if !c.overlay && slices.Contains(overlayTools, t.Tool.Name) {
+			continue
+		}
+		if name, ok := c.toolNames[t.Tool.Name]; ok {
+			t.Tool.Name = name
+		} else {
+			t.Tool.Name = c.toolPrefix + t.Tool.Name
+		}
+		t = wrap(t)
+		handler := t.Handler // Capture in closure
+		srv.AddTool(t.Tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return handler(ctx, req, allowedDirs)
+		})
+	}
+	return srv, nil
+}
+
+// Close stops the watches of the server and closes its archives.
+func (s *Server) Close() error {
+	s.watches.Close()
+	for _, archive := range s.archives {
+		archive.Close()
+	}
+	if s.subscriptions != nil {
+		return s.subscriptions.Close()
+	}
+	return nil
+}
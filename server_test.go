@@ -0,0 +1,121 @@
+package top
+
+import (
+	"context"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewServer(t *testing.T) {
+	rwDir, roDir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(roDir, "doc.txt"), []byte("read me"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	var called []string
+	record := func(tool tester.ToolHandler) tester.ToolHandler {
+		handler := tool.Handler
+		tool.Handler = func(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+			called = append(called, tool.Tool.Name)
+			return handler(ctx, req, allowedDirs)
+		}
+		return tool
+	}
+	srv, err := NewServer(
+		WithRoots(Root{Path: rwDir}, Root{Path: roDir, ReadOnly: true}),
+		WithDeny("*.key"),
+		WithTools("read_file", "write_file", "list_allowed_directories"),
+		WithToolPrefix("fs_"),
+		WithToolName("list_allowed_directories", "roots"),
+		WithCallLimits(Limits{MaxFileBytes: 4}),
+		WithMiddleware(record),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer srv.Close()
+	// Embedders mount their own tools alongside
+	srv.AddTool(mcp.NewTool("ping"), func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("pong"), nil
+	})
+
+	ctx := context.Background()
+	c, err := client.NewInProcessClient(srv.MCPServer)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer c.Close()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Failed to start client: %v", err)
+	}
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	if _, err := c.Initialize(ctx, initRequest); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	call := func(name string, args map[string]interface{}) (string, bool) {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = name
+		req.Params.Arguments = args
+		result, err := c.CallTool(ctx, req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return resultText(result), result.IsError
+	}
+
+	t.Run("Tools are selected and renamed", func(t *testing.T) {
+		list, err := c.ListTools(ctx, mcp.ListToolsRequest{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var names []string
+		for _, tool := range list.Tools {
+			names = append(names, tool.Name)
+		}
+		slices.Sort(names)
+		expected := []string{"fs_read_file", "fs_write_file", "ping", "roots"}
+		if !slices.Equal(names, expected) {
+			t.Errorf("Expected tools %v, got %v", expected, names)
+		}
+		if text, _ := call("ping", nil); text != "pong" {
+			t.Errorf("Expected pong, got %q", text)
+		}
+	})
+
+	t.Run("Tools are restricted", func(t *testing.T) {
+		if text, isError := call("roots", nil); isError || !strings.Contains(text, rwDir) || !strings.Contains(text, roDir) {
+			t.Errorf("Expected both roots, got %q", text)
+		}
+		if text, _ := call("fs_read_file", map[string]interface{}{"path": filepath.Join(roDir, "doc.txt")}); !strings.HasPrefix(text, "read") || strings.Contains(text, "me") {
+			t.Errorf("Expected truncated content, got %q", text)
+		}
+		if _, isError := call("fs_write_file", map[string]interface{}{"path": filepath.Join(roDir, "new.txt"), "content": "x"}); !isError {
+			t.Errorf("Expected error writing to read-only root")
+		}
+		if _, isError := call("fs_write_file", map[string]interface{}{"path": filepath.Join(rwDir, "a.key"), "content": "x"}); !isError {
+			t.Errorf("Expected error writing denied file")
+		}
+		if _, isError := call("fs_write_file", map[string]interface{}{"path": filepath.Join(rwDir, "new.txt"), "content": "x"}); isError {
+			t.Errorf("Expected write to succeed")
+		}
+		if !slices.Contains(called, "fs_write_file") || !slices.Contains(called, "roots") {
+			t.Errorf("Expected the middleware to see the exposed names, got %v", called)
+		}
+	})
+
+	t.Run("Invalid options fail", func(t *testing.T) {
+		if _, err := NewServer(WithTools("format_disk")); err == nil {
+			t.Errorf("Expected error for unknown tool")
+		}
+		if _, err := NewServer(WithDeny("[")); err == nil {
+			t.Errorf("Expected error for invalid deny pattern")
+		}
+	})
+}
@@ -0,0 +1,249 @@
+package top
+
+import (
+	"context"
+	"errors"
+	"github.com/fsnotify/fsnotify"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// subscriptionDebounce is how long changes to a subscribed resource are collected before its subscribers are notified.
+const subscriptionDebounce = 100 * time.Millisecond
+
+// Subscriptions watches the files and directories that sessions subscribed to, and notifies the
+// sessions when they change. A file is watched through its directory, so that it is still followed
+// after an editor replaces it; a directory is notified of changes to its entries, not recursively.
+// Bursts of changes are collected for the debounce interval and reported by a single notification.
+type Subscriptions struct {
+	mu       sync.Mutex
+	watcher  *fsnotify.Watcher
+	notify   func(session, uri string)
+	debounce time.Duration
+	// subs maps the resolved path of each subscribed resource to its subscriptions.
+	subs map[string]*subscription
+	// dirs counts the subscriptions relying on each watched directory.
+	dirs map[string]int
+}
+
+// subscription holds the sessions subscribed to one path, and the URI each of them used.
+type subscription struct {
+	isDir    bool
+	sessions map[string]string
+	pending  *time.Timer
+}
+
+// NewSubscriptions starts watching for changes, calling notify for each subscriber of a changed resource.
+func NewSubscriptions(notify func(session, uri string)) (*Subscriptions, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	s := &Subscriptions{
+		watcher:  watcher,
+		notify:   notify,
+		debounce: subscriptionDebounce,
+		subs:     map[string]*subscription{},
+		dirs:     map[string]int{},
+	}
+	go s.run()
+	return s, nil
+}
+
+// Close stops watching. Pending notifications are dropped.
+func (s *Subscriptions) Close() error {
+	s.mu.Lock()
+	for _, sub := range s.subs {
+		if sub.pending != nil {
+			sub.pending.Stop()
+		}
+	}
+	s.subs = map[string]*subscription{}
+	s.mu.Unlock()
+	return s.watcher.Close()
+}
+
+// Subscriber returns the handler of resources/subscribe, which takes a "uri" argument.
+// It is invoked like a tool, so that it can be wrapped the same way as the other resource handlers.
+func (s *Subscriptions) Subscriber() tester.ToolHandler {
+	return tester.ToolHandler{Tool: mcp.Tool{Name: "resources/subscribe"}, Handler: s.subscribeHandler}
+}
+
+// SubscribeResource runs subscriber, typically a wrapped Subscriber, to subscribe to the resource at uri.
+func SubscribeResource(ctx context.Context, subscriber tester.ToolHandler, uri string, allowedDirs []string) error {
+	req := mcp.CallToolRequest{}
+	req.Params.Name = subscriber.Tool.Name
+	req.Params.Arguments = map[string]interface{}{"uri": uri}
+	_, err := callResourceHandler(ctx, subscriber, req, allowedDirs)
+	return err
+}
+
+func (s *Subscriptions) subscribeHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[resourceArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	session := sessionID(ctx)
+	if session == "" {
+		return mcp.NewToolResultError("subscriptions require a session"), nil
+	}
+	path, err := fileURIPath(args.URI)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	validPath, err := validatePath(ctx, path, allowedDirs)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !isLocal(ctx, validPath) {
+		return mcp.NewToolResultError("subscriptions are only available on the local filesystem"), nil
+	}
+	info, err := backendFromContext(ctx).Stat(validPath)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := s.subscribe(session, args.URI, validPath, info.IsDir()); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return mcp.NewToolResultText("Subscribed to " + args.URI), nil
+}
+
+// subscribe adds the subscription of session to path, which it knows as uri.
+func (s *Subscriptions) subscribe(session, uri, path string, isDir bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[path]
+	if !ok {
+		dir := watchedDir(path, isDir)
+		if s.dirs[dir] == 0 {
+			if err := s.watcher.Add(dir); err != nil {
+				return err
+			}
+		}
+		s.dirs[dir]++
+		sub = &subscription{isDir: isDir, sessions: map[string]string{}}
+		s.subs[path] = sub
+	}
+	sub.sessions[session] = uri
+	return nil
+}
+
+// Unsubscribe removes the subscription of a session to uri, if any.
+func (s *Subscriptions) Unsubscribe(session, uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for path, sub := range s.subs {
+		if sub.sessions[session] == uri {
+			delete(sub.sessions, session)
+			s.dropIfUnusedLocked(path, sub)
+		}
+	}
+}
+
+// Forget drops the subscriptions of a session that has ended.
+func (s *Subscriptions) Forget(_ context.Context, session server.ClientSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for path, sub := range s.subs {
+		if _, ok := sub.sessions[session.SessionID()]; ok {
+			delete(sub.sessions, session.SessionID())
+			s.dropIfUnusedLocked(path, sub)
+		}
+	}
+}
+
+// dropIfUnusedLocked stops watching path once nobody is subscribed to it.
+func (s *Subscriptions) dropIfUnusedLocked(path string, sub *subscription) {
+	if len(sub.sessions) > 0 {
+		return
+	}
+	if sub.pending != nil {
+		sub.pending.Stop()
+	}
+	delete(s.subs, path)
+	dir := watchedDir(path, sub.isDir)
+	s.dirs[dir]--
+	if s.dirs[dir] == 0 {
+		delete(s.dirs, dir)
+		// The watch is already gone if the directory was removed
+		_ = s.watcher.Remove(dir)
+	}
+}
+
+// watchedDir returns the directory watched for changes to path.
+func watchedDir(path string, isDir bool) string {
+	if isDir {
+		return path
+	}
+	return filepath.Dir(path)
+}
+
+// run dispatches the events of the watcher until it is closed.
+func (s *Subscriptions) run() {
+	for {
+		select {
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			s.changed(event.Name)
+			if dir := filepath.Dir(event.Name); dir != event.Name {
+				// A change to an entry is a change to a subscribed directory
+				if sub := s.lookup(dir); sub != nil && sub.isDir {
+					s.changed(dir)
+				}
+			}
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			if !errors.Is(err, fsnotify.ErrEventOverflow) {
+				slog.Error("Error watching subscribed resources", "error", err)
+				continue
+			}
+			// Events were lost, so any resource may have changed
+			s.mu.Lock()
+			paths := make([]string, 0, len(s.subs))
+			for path := range s.subs {
+				paths = append(paths, path)
+			}
+			s.mu.Unlock()
+			for _, path := range paths {
+				s.changed(path)
+			}
+		}
+	}
+}
+
+func (s *Subscriptions) lookup(path string) *subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subs[path]
+}
+
+// changed schedules the notification of the subscribers of path, unless one is already pending.
+func (s *Subscriptions) changed(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[path]
+	if !ok || sub.pending != nil {
+		return
+	}
+	sub.pending = time.AfterFunc(s.debounce, func() {
+		s.mu.Lock()
+		sub.pending = nil
+		sessions := make(map[string]string, len(sub.sessions))
+		for session, uri := range sub.sessions {
+			sessions[session] = uri
+		}
+		s.mu.Unlock()
+		for session, uri := range sessions {
+			s.notify(session, uri)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package top
+
+import (
+	"context"
+	"github.com/mark3labs/mcp-go/server"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSubscriptions(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	type notification struct{ session, uri string }
+	notified := make(chan notification, 100)
+	subscriptions, err := NewSubscriptions(func(session, uri string) {
+		notified <- notification{session, uri}
+	})
+	if err != nil {
+		t.Skipf("Watching is unavailable: %v", err)
+	}
+	defer subscriptions.Close()
+	subscriptions.debounce = 50 * time.Millisecond
+
+	session := &rootsSession{id: "one"}
+	ctx := server.NewMCPServer("test", "1.0").WithContext(context.Background(), session)
+	subscribe := func(t *testing.T, ctx context.Context, path string) error {
+		t.Helper()
+		return SubscribeResource(ctx, subscriptions.Subscriber(), fileURI(path), []string{tempDir})
+	}
+	expect := func(t *testing.T, expected ...notification) {
+		t.Helper()
+		for _, e := range expected {
+			select {
+			case n := <-notified:
+				if n != e {
+					t.Errorf("Expected %v, got %v", e, n)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Expected %v, got nothing", e)
+			}
+		}
+		select {
+		case n := <-notified:
+			t.Errorf("Unexpected notification %v", n)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	write := func(t *testing.T, path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	t.Run("File changes are debounced", func(t *testing.T) {
+		if err := subscribe(t, ctx, testFile); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 5; i++ {
+			write(t, testFile, "changed")
+		}
+		expect(t, notification{"one", fileURI(testFile)})
+	})
+
+	t.Run("Replaced file is still followed", func(t *testing.T) {
+		temp := filepath.Join(tempDir, "test.txt.tmp")
+		write(t, temp, "replaced")
+		if err := os.Rename(temp, testFile); err != nil {
+			t.Fatalf("Failed to rename: %v", err)
+		}
+		expect(t, notification{"one", fileURI(testFile)})
+		write(t, testFile, "again")
+		expect(t, notification{"one", fileURI(testFile)})
+	})
+
+	t.Run("Directory is notified of new entries", func(t *testing.T) {
+		subDir := filepath.Join(tempDir, "sub")
+		if err := os.Mkdir(subDir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		other := &rootsSession{id: "two"}
+		otherCtx := server.NewMCPServer("test", "1.0").WithContext(context.Background(), other)
+		if err := subscribe(t, otherCtx, subDir); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		write(t, filepath.Join(subDir, "new.txt"), "new")
+		expect(t, notification{"two", fileURI(subDir)})
+		subscriptions.Forget(otherCtx, other)
+		write(t, filepath.Join(subDir, "new.txt"), "newer")
+		expect(t)
+	})
+
+	t.Run("Unsubscribe stops notifications", func(t *testing.T) {
+		subscriptions.Unsubscribe("one", fileURI(testFile))
+		write(t, testFile, "unwatched")
+		expect(t)
+		if len(subscriptions.subs) != 0 || len(subscriptions.dirs) != 0 {
+			t.Errorf("Expected no watches left, got %v %v", subscriptions.subs, subscriptions.dirs)
+		}
+	})
+
+	t.Run("Subscriptions are restricted", func(t *testing.T) {
+		if err := subscribe(t, ctx, filepath.Join(t.TempDir(), "outside.txt")); err == nil {
+			t.Errorf("Expected error subscribing outside allowed directories")
+		}
+		if err := subscribe(t, context.Background(), testFile); err == nil {
+			t.Errorf("Expected error subscribing without a session")
+		}
+		if err := subscribe(t, ctx, filepath.Join(tempDir, "missing.txt")); err == nil {
+			t.Errorf("Expected error subscribing to a missing file")
+		}
+	})
+}
@@ -11,14 +11,47 @@ type ToolHandler struct {
 	Handler func(context.Context, mcp.CallToolRequest, []string) (*mcp.CallToolResult, error)
 }
 
+// Middleware returns a copy of a tool whose handler adds a concern, such as logging or a permission
+// check, around the original handler. It may also change the tool itself, such as its description.
+type Middleware func(ToolHandler) ToolHandler
+
+// Chain composes middlewares into one. The first middleware is the outermost: it sees each call
+// first and its result last. Without middlewares, tools are returned unchanged.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(t ToolHandler) ToolHandler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			t = middlewares[i](t)
+		}
+		return t
+	}
+}
+
+// Apply returns copies of tools wrapped by the chain of middlewares.
+func Apply(tools []ToolHandler, middlewares ...Middleware) []ToolHandler {
+	wrap := Chain(middlewares...)
+	wrapped := make([]ToolHandler, 0, len(tools))
+	for _, t := range tools {
+		wrapped = append(wrapped, wrap(t))
+	}
+	return wrapped
+}
+
 type MCPClient interface {
 	CallTool(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error)
 	Close() error
 }
 
+// NotificationClient is implemented by clients that deliver the notifications sent by the server.
+type NotificationClient interface {
+	OnNotification(handler func(notification mcp.JSONRPCNotification))
+}
+
 type MCPClientFactory func(ctx context.Context, args []string) (*mcp.InitializeResult, MCPClient)
 
-func BypassFactory(tools []ToolHandler) MCPClientFactory {
+// BypassFactory creates clients that call the handlers of tools directly, wrapped by the chain of
+// middlewares, without a server in between.
+func BypassFactory(tools []ToolHandler, middlewares ...Middleware) MCPClientFactory {
+	tools = Apply(tools, middlewares...)
 	return func(ctx context.Context, allowedDirs []string) (*mcp.InitializeResult, MCPClient) {
 		return &mcp.InitializeResult{}, &bypassClient{
 			tools:       tools,
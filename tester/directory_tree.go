@@ -152,7 +152,44 @@ func TestDirectoryTree(t T, f MCPClientFactory) {
 				if err := json.Unmarshal([]byte(textContent.Text), &treeData); err != nil {
 					t.Errorf("Failed to parse JSON response: %v\nJSON: %s", err, textContent.Text)
 				}
+				assertStructuredContent(t, result, "entries")
 			}
 		})
 	}
+
+	t.Run("A maxDepth of 0 means the default", func(t T) {
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "directory_tree"
+		req.Params.Arguments = map[string]interface{}{
+			"path":     tempDir,
+			"maxDepth": 0,
+		}
+		result, err := c.CallTool(t.Context(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		assertToolResult(t, result, false, func(content string) bool {
+			return strings.Contains(content, `"name": "file4.txt"`)
+		})
+	})
+
+	t.Run("Cancelled request", func(t T) {
+		largeDir := filepath.Join(tempDir, "large")
+		createLargeTree(t, largeDir, 60)
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "directory_tree"
+		req.Params.Arguments = map[string]interface{}{
+			"path": largeDir,
+		}
+		assertCancelledQuickly(t, c, req)
+	})
+
+	t.Run("Progress is reported", func(t T) {
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "directory_tree"
+		req.Params.Arguments = map[string]interface{}{
+			"path": tempDir,
+		}
+		assertProgressReported(t, c, req)
+	})
 }
@@ -1,9 +1,11 @@
 package tester
 
 import (
+	"fmt"
 	"github.com/mark3labs/mcp-go/mcp"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func TestEditFile(t T, f MCPClientFactory) {
@@ -145,4 +147,29 @@ func TestEditFile(t T, f MCPClientFactory) {
 	if !result.IsError {
 		t.Errorf("Expected error for missing oldText but got success: %s", result.Content)
 	}
+
+	// Test 6: Cancelled request must not modify the file, given enough edits to be cancelled midway
+	largeFilePath := filepath.Join(tempDir, "large.txt")
+	var content strings.Builder
+	var largeEdits []map[string]interface{}
+	for i := 0; i < 20000; i++ {
+		line := fmt.Sprintf("Line %05d", i)
+		content.WriteString(line + "\n")
+		largeEdits = append(largeEdits, map[string]interface{}{"oldText": line, "newText": "Cancelled " + line})
+	}
+	if err := os.WriteFile(largeFilePath, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	req.Params.Arguments = map[string]interface{}{
+		"path":  largeFilePath,
+		"edits": largeEdits,
+	}
+	assertCancelledQuickly(t, c, req)
+	after, err := os.ReadFile(largeFilePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(after) != content.String() {
+		t.Errorf("Cancelled edit modified the file: %q", string(after))
+	}
 }
@@ -163,6 +163,9 @@ func TestGetFileInfo(t T, f MCPClientFactory) {
 
 			// Check result using helper function
 			assertToolResult(t, result, tc.expectedError, tc.checkContent)
+			if !tc.expectedError {
+				assertStructuredContent(t, result, "")
+			}
 		})
 	}
 }
@@ -0,0 +1,65 @@
+package tester
+
+import (
+	"encoding/json"
+	"github.com/mark3labs/mcp-go/mcp"
+	"os"
+	"path/filepath"
+)
+
+func TestGetQuota(t T, f MCPClientFactory) {
+	tempDir := t.TempDir()
+	_, c := f(t.Context(), []string{tempDir})
+	defer c.Close()
+
+	callGetQuota := func(t T) []map[string]interface{} {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "get_quota"
+		result, err := c.CallTool(t.Context(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		assertToolResult(t, result, false, nil)
+		var quotas []map[string]interface{}
+		if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &quotas); err != nil {
+			t.Fatalf("Failed to parse JSON response: %v", err)
+		}
+		if len(quotas) != 1 || quotas[0]["root"] != tempDir {
+			t.Fatalf("Expected a single quota for %s, got: %v", tempDir, quotas)
+		}
+		return quotas
+	}
+
+	t.Run("Report fields", func(t T) {
+		quota := callGetQuota(t)[0]
+		for _, field := range []string{"bytesUsed", "bytesLimit", "filesUsed", "filesLimit"} {
+			if _, ok := quota[field].(float64); !ok {
+				t.Errorf("Expected numeric %s, got: %v", field, quota)
+			}
+		}
+	})
+
+	t.Run("Usage does not decrease after a write", func(t T) {
+		before := callGetQuota(t)[0]
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "write_file"
+		req.Params.Arguments = map[string]interface{}{
+			"path":    filepath.Join(tempDir, "quota.txt"),
+			"content": "quota test",
+		}
+		result, err := c.CallTool(t.Context(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		assertToolResult(t, result, false, nil)
+		if _, err := os.Stat(filepath.Join(tempDir, "quota.txt")); err != nil {
+			t.Fatalf("File was not written: %v", err)
+		}
+		after := callGetQuota(t)[0]
+		if after["bytesUsed"].(float64) < before["bytesUsed"].(float64) ||
+			after["filesUsed"].(float64) < before["filesUsed"].(float64) {
+			t.Errorf("Usage decreased after a write: before %v, after %v", before, after)
+		}
+	})
+}
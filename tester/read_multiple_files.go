@@ -103,4 +103,17 @@ func TestReadMultipleFiles(t T, f MCPClientFactory) {
 			assertToolResult(t, result, tc.expectedError, tc.checkContent)
 		})
 	}
+
+	t.Run("Cancelled request", func(t T) {
+		var paths []interface{}
+		for _, path := range createLargeTree(t, filepath.Join(tempDir, "large"), 60) {
+			paths = append(paths, path)
+		}
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "read_multiple_files"
+		req.Params.Arguments = map[string]interface{}{
+			"paths": paths,
+		}
+		assertCancelledQuickly(t, c, req)
+	})
 }
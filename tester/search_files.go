@@ -184,15 +184,16 @@ func TestSearchFiles(t T, f MCPClientFactory) {
 			// Create request with path and pattern
 			req := mcp.CallToolRequest{}
 			req.Params.Name = "search_files"
-			req.Params.Arguments = map[string]interface{}{
+			args := map[string]interface{}{
 				"path":    tc.path,
 				"pattern": tc.pattern,
 			}
 
 			// Add exclude patterns if provided
 			if tc.excludePatterns != nil {
-				req.Params.Arguments["excludePatterns"] = tc.excludePatterns
+				args["excludePatterns"] = tc.excludePatterns
 			}
+			req.Params.Arguments = args
 
 			// Call handler
 			result, err := c.CallTool(t.Context(), req)
@@ -204,4 +205,26 @@ func TestSearchFiles(t T, f MCPClientFactory) {
 			assertToolResult(t, result, tc.expectedError, tc.checkResult)
 		})
 	}
+
+	t.Run("Cancelled request", func(t T) {
+		largeDir := filepath.Join(tempDir, "large")
+		createLargeTree(t, largeDir, 60)
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "search_files"
+		req.Params.Arguments = map[string]interface{}{
+			"path":    largeDir,
+			"pattern": "test",
+		}
+		assertCancelledQuickly(t, c, req)
+	})
+
+	t.Run("Progress is reported", func(t T) {
+		req := mcp.CallToolRequest{}
+		req.Params.Name = "search_files"
+		req.Params.Arguments = map[string]interface{}{
+			"path":    tempDir,
+			"pattern": "test",
+		}
+		assertProgressReported(t, c, req)
+	})
 }
@@ -1,7 +1,17 @@
 package tester
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Helper functions for test assertions
@@ -31,8 +41,223 @@ func assertToolResult(t T, result *mcp.CallToolResult, expectedError bool, conte
 	}
 }
 
+// assertStructuredContent checks that the structured content of a result holds the same JSON as its
+// text content, either as a whole or, if field is set, in that field.
+func assertStructuredContent(t T, result *mcp.CallToolResult, field string) {
+	t.Helper()
+	if result.StructuredContent == nil {
+		t.Errorf("Expected structured content but got none")
+		return
+	}
+	data, err := json.Marshal(result.StructuredContent)
+	if err != nil {
+		t.Fatalf("Failed to marshal structured content: %v", err)
+	}
+	var structured interface{}
+	if err := json.Unmarshal(data, &structured); err != nil {
+		t.Fatalf("Failed to parse structured content: %v", err)
+	}
+	if field != "" {
+		object, ok := structured.(map[string]interface{})
+		if !ok {
+			t.Fatalf("Expected structured content to be an object, got: %s", data)
+		}
+		structured = object[field]
+	}
+	var text interface{}
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &text); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if !reflect.DeepEqual(structured, text) {
+		t.Errorf("Structured content %s does not match text content %v", data, text)
+	}
+}
+
 func expectExactText(expected string) func(string) bool {
 	return func(actual string) bool {
 		return actual == expected
 	}
 }
+
+// cancelDelay is how long a call to a server runs before it is cancelled, when it does not report progress.
+const cancelDelay = 5 * time.Millisecond
+
+// assertCancelledQuickly starts a call that has plenty of work to do, cancels it once it is underway,
+// and checks that the server answers promptly with an error.
+func assertCancelledQuickly(t T, c MCPClient, req mcp.CallToolRequest) {
+	t.Helper()
+
+	var outcome <-chan callOutcome
+	if connected, ok := c.(interface{ GetTransport() transport.Interface }); ok {
+		outcome = startNotifiedCall(t.Context(), c, connected.GetTransport(), req)
+	} else {
+		outcome = startCheckedCall(t.Context(), c, req)
+	}
+	select {
+	case o := <-outcome:
+		if o.err != nil {
+			t.Fatalf("Expected the server to answer the cancelled call, got: %v", o.err)
+		}
+		if !o.result.IsError {
+			t.Errorf("Expected cancelled request to fail but got a result of %d items", len(o.result.Content))
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Cancelled request did not return within %v", time.Second)
+	}
+}
+
+// callOutcome is what a call returned.
+type callOutcome struct {
+	result *mcp.CallToolResult
+	err    error
+}
+
+// startNotifiedCall calls a server and notifies it that the call is cancelled once the call is underway,
+// since abandoning the request would only make the client stop waiting. The call is underway once the
+// server reports progress, or after a short delay for tools that do not. The notification is repeated
+// until the server answers, in case it overtakes the request.
+func startNotifiedCall(ctx context.Context, c MCPClient, tr transport.Interface, req mcp.CallToolRequest) <-chan callOutcome {
+	id := "cancel-" + req.Params.Name
+	started := make(chan struct{})
+	if nc, ok := c.(NotificationClient); ok {
+		var once sync.Once
+		nc.OnNotification(func(notification mcp.JSONRPCNotification) {
+			if notification.Method == string(mcp.MethodNotificationProgress) &&
+				notification.Params.AdditionalFields["progressToken"] == id {
+				once.Do(func() { close(started) })
+			}
+		})
+		req.Params.Meta = &mcp.Meta{ProgressToken: id}
+	}
+
+	outcome := make(chan callOutcome, 1)
+	answered := make(chan struct{})
+	go func() {
+		defer close(answered)
+		response, err := tr.SendRequest(ctx, transport.JSONRPCRequest{
+			JSONRPC: mcp.JSONRPC_VERSION,
+			ID:      mcp.NewRequestId(id),
+			Method:  string(mcp.MethodToolsCall),
+			Params:  req.Params,
+		})
+		if err == nil && response.Error != nil {
+			err = response.Error.AsError()
+		}
+		if err != nil {
+			outcome <- callOutcome{err: err}
+			return
+		}
+		result, err := mcp.ParseCallToolResult(&response.Result)
+		outcome <- callOutcome{result, err}
+	}()
+	go func() {
+		select {
+		case <-started:
+		case <-time.After(cancelDelay):
+		case <-answered:
+			return
+		}
+		notification := mcp.JSONRPCNotification{JSONRPC: mcp.JSONRPC_VERSION}
+		notification.Method = string(mcp.MethodNotificationCancelled)
+		notification.Params.AdditionalFields = map[string]any{"requestId": id}
+		ticker := time.NewTicker(cancelDelay)
+		defer ticker.Stop()
+		for {
+			_ = tr.SendNotification(ctx, notification)
+			select {
+			case <-ticker.C:
+			case <-answered:
+				return
+			}
+		}
+	}()
+	return outcome
+}
+
+// startCheckedCall calls a client running handlers in process, with a context that is cancelled once
+// the handler has checked it for cancellation a number of times, which shows that it is underway.
+func startCheckedCall(ctx context.Context, c MCPClient, req mcp.CallToolRequest) <-chan callOutcome {
+	outcome := make(chan callOutcome, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	checked := &checkedContext{Context: ctx, cancel: cancel, after: 100}
+	go func() {
+		defer cancel()
+		result, err := c.CallTool(checked, req)
+		outcome <- callOutcome{result, err}
+	}()
+	return outcome
+}
+
+// checkedContext cancels itself once its Err method has been called after times.
+type checkedContext struct {
+	context.Context
+	cancel context.CancelFunc
+	checks atomic.Int32
+	after  int32
+}
+
+func (c *checkedContext) Err() error {
+	if c.checks.Add(1) == c.after {
+		c.cancel()
+	}
+	return c.Context.Err()
+}
+
+// createLargeTree creates a tree below dir of width directories holding width directories each,
+// with a file in each of these, for a walk of it to take a while since every directory has to be
+// read. It returns the paths of the files.
+func createLargeTree(t T, dir string, width int) []string {
+	t.Helper()
+	var paths []string
+	for i := 0; i < width; i++ {
+		for j := 0; j < width; j++ {
+			sub := filepath.Join(dir, fmt.Sprintf("dir%03d", i), fmt.Sprintf("dir%03d", j))
+			if err := os.MkdirAll(sub, 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			path := filepath.Join(sub, "test.txt")
+			if err := os.WriteFile(path, []byte("test content\n"), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// assertProgressReported calls a tool with a progress token and checks that the server
+// reports progress for it. Clients that do not deliver notifications skip the check.
+func assertProgressReported(t T, c MCPClient, req mcp.CallToolRequest) {
+	t.Helper()
+	nc, ok := c.(NotificationClient)
+	if !ok {
+		t.Skip("client does not deliver notifications")
+	}
+	token := "progress-" + req.Params.Name
+	progress := make(chan map[string]any, 100)
+	nc.OnNotification(func(notification mcp.JSONRPCNotification) {
+		if notification.Method == string(mcp.MethodNotificationProgress) &&
+			notification.Params.AdditionalFields["progressToken"] == token {
+			select {
+			case progress <- notification.Params.AdditionalFields:
+			default:
+			}
+		}
+	})
+
+	req.Params.Meta = &mcp.Meta{ProgressToken: token}
+	result, err := c.CallTool(t.Context(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assertToolResult(t, result, false, nil)
+	// Notifications may arrive after the result
+	select {
+	case fields := <-progress:
+		if p, ok := fields["progress"].(float64); !ok || p <= 0 {
+			t.Errorf("Expected positive progress, got: %v", fields)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Expected a progress notification for token %s", token)
+	}
+}
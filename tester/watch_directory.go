@@ -0,0 +1,168 @@
+package tester
+
+import (
+	"encoding/json"
+	"github.com/mark3labs/mcp-go/mcp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func TestWatchDirectory(t T, f MCPClientFactory) {
+	tempDir := t.TempDir()
+	_, c := f(t.Context(), []string{tempDir})
+	defer c.Close()
+
+	type changeEvent struct {
+		Type    string `json:"type"`
+		Path    string `json:"path"`
+		OldPath string `json:"oldPath"`
+	}
+	call := func(t T, name string, args map[string]interface{}) *mcp.CallToolResult {
+		t.Helper()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = name
+		req.Params.Arguments = args
+		result, err := c.CallTool(t.Context(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return result
+	}
+	watch := func(t T, args map[string]interface{}) (string, string) {
+		t.Helper()
+		result := call(t, "watch_directory", args)
+		assertToolResult(t, result, false, nil)
+		var info struct {
+			Path   string `json:"path"`
+			Cursor string `json:"cursor"`
+		}
+		if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &info); err != nil {
+			t.Fatalf("Failed to parse JSON response: %v", err)
+		}
+		return info.Path, info.Cursor
+	}
+	// poll collects events until done is satisfied or a few seconds have passed
+	poll := func(t T, cursor string, done func([]changeEvent) bool) ([]changeEvent, bool, string) {
+		t.Helper()
+		var events []changeEvent
+		overflow := false
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			result := call(t, "poll_changes", map[string]interface{}{"cursor": cursor})
+			assertToolResult(t, result, false, nil)
+			var changes struct {
+				Events   []changeEvent `json:"events"`
+				Overflow bool          `json:"overflow"`
+				Cursor   string        `json:"cursor"`
+			}
+			if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &changes); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+			events = append(events, changes.Events...)
+			overflow = overflow || changes.Overflow
+			cursor = changes.Cursor
+			if done(events) || time.Now().After(deadline) {
+				return events, overflow, cursor
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	has := func(events []changeEvent, expected changeEvent) bool {
+		for _, event := range events {
+			if event == expected {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.Run("Changes are reported", func(t T) {
+		dir := filepath.Join(tempDir, "changes")
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		dir, cursor := watch(t, map[string]interface{}{"path": dir})
+		file := filepath.Join(dir, "file.txt")
+		subDir := filepath.Join(dir, "sub")
+		nested := filepath.Join(subDir, "nested.txt")
+		renamed := filepath.Join(subDir, "renamed.txt")
+		if err := os.WriteFile(file, []byte("created"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := os.Mkdir(subDir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		expected := []changeEvent{
+			{Type: "created", Path: file},
+			{Type: "created", Path: subDir},
+			{Type: "created", Path: nested},
+			{Type: "modified", Path: nested},
+			{Type: "renamed", Path: renamed, OldPath: nested},
+			{Type: "deleted", Path: file},
+		}
+		events, _, cursor := poll(t, cursor, func(events []changeEvent) bool {
+			return has(events, expected[1])
+		})
+		// The new directory is watched too
+		if err := os.WriteFile(nested, []byte("nested"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := os.Rename(nested, renamed); err != nil {
+			t.Fatalf("Failed to rename file: %v", err)
+		}
+		if err := os.Remove(file); err != nil {
+			t.Fatalf("Failed to remove file: %v", err)
+		}
+		more, overflow, _ := poll(t, cursor, func(events []changeEvent) bool {
+			return has(events, expected[5])
+		})
+		events = append(events, more...)
+		if overflow {
+			t.Errorf("Unexpected overflow")
+		}
+		for _, e := range expected {
+			if !has(events, e) {
+				t.Errorf("Expected event %+v, got %+v", e, events)
+			}
+		}
+	})
+
+	t.Run("Excluded paths are not reported", func(t T) {
+		dir := filepath.Join(tempDir, "exclude")
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		dir, cursor := watch(t, map[string]interface{}{"path": dir, "excludePatterns": []interface{}{"*.log"}})
+		logFile := filepath.Join(dir, "debug.log")
+		textFile := filepath.Join(dir, "notes.txt")
+		for _, path := range []string{logFile, textFile} {
+			if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+		}
+		events, _, _ := poll(t, cursor, func(events []changeEvent) bool {
+			return has(events, changeEvent{Type: "created", Path: textFile})
+		})
+		for _, event := range events {
+			if event.Path == logFile {
+				t.Errorf("Unexpected event for excluded file: %+v", event)
+			}
+		}
+	})
+
+	t.Run("Invalid arguments fail", func(t T) {
+		file := filepath.Join(tempDir, "plain.txt")
+		if err := os.WriteFile(file, []byte("content"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		assertToolResult(t, call(t, "watch_directory", map[string]interface{}{"path": file}), true, nil)
+		assertToolResult(t, call(t, "watch_directory", map[string]interface{}{"path": "/"}), true, nil)
+		result := call(t, "poll_changes", map[string]interface{}{"cursor": "not a cursor"})
+		assertToolResult(t, result, true, nil)
+		if !result.IsError || !strings.Contains(result.Content[0].(mcp.TextContent).Text, "cursor") {
+			t.Errorf("Expected cursor error, got: %v", result.Content)
+		}
+	})
+}
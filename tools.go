@@ -6,15 +6,21 @@ import (
 
 // Define tools
 var Tools = []tester.ToolHandler{
-	{DefineReadFileTool(), ReadFileHandler},
-	{DefineReadMultipleFilesTool(), ReadMultipleFilesHandler},
-	{DefineWriteFileTool(), WriteFileHandler},
-	{DefineEditFileTool(), EditFileHandler},
-	{DefineCreateDirectoryTool(), CreateDirectoryHandler},
-	{DefineListDirectoryTool(), ListDirectoryHandler},
-	{DefineDirectoryTreeTool(), DirectoryTreeHandler},
-	{DefineMoveFileTool(), MoveFileHandler},
-	{DefineSearchFilesTool(), SearchFilesHandler},
-	{DefineGetFileInfoTool(), GetFileInfoHandler},
-	{DefineListAllowedDirectoriesTool(), ListAllowedDirectoriesHandler},
+	{Tool: DefineReadFileTool(), Handler: ReadFileHandler},
+	{Tool: DefineReadMultipleFilesTool(), Handler: ReadMultipleFilesHandler},
+	{Tool: DefineWriteFileTool(), Handler: WriteFileHandler},
+	{Tool: DefineEditFileTool(), Handler: EditFileHandler},
+	{Tool: DefineCreateDirectoryTool(), Handler: CreateDirectoryHandler},
+	{Tool: DefineListDirectoryTool(), Handler: ListDirectoryHandler},
+	{Tool: DefineDirectoryTreeTool(), Handler: DirectoryTreeHandler},
+	{Tool: DefineMoveFileTool(), Handler: MoveFileHandler},
+	{Tool: DefineSearchFilesTool(), Handler: SearchFilesHandler},
+	{Tool: DefineGetFileInfoTool(), Handler: GetFileInfoHandler},
+	{Tool: DefineListAllowedDirectoriesTool(), Handler: ListAllowedDirectoriesHandler},
+	{Tool: DefineGetQuotaTool(), Handler: GetQuotaHandler},
+	{Tool: DefineWatchDirectoryTool(), Handler: WatchDirectoryHandler},
+	{Tool: DefinePollChangesTool(), Handler: PollChangesHandler},
+	{Tool: DefineOverlayDiffTool(), Handler: OverlayDiffHandler},
+	{Tool: DefineOverlayCommitTool(), Handler: OverlayCommitHandler},
+	{Tool: DefineOverlayDiscardTool(), Handler: OverlayDiscardHandler},
 }
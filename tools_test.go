@@ -1,7 +1,10 @@
 package top
 
 import (
+	"context"
+	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/optistar/mcp-server-filesystem/tester"
+	"slices"
 	"testing"
 )
 
@@ -21,6 +24,10 @@ func TestGetFileInfo(t *testing.T) {
 	tester.TestGetFileInfo(tester.Wrap(t), tester.BypassFactory(Tools))
 }
 
+func TestGetQuota(t *testing.T) {
+	tester.TestGetQuota(tester.Wrap(t), tester.BypassFactory(Tools))
+}
+
 func TestListAllowedDirectories(t *testing.T) {
 	tester.TestListAllowedDirectories(tester.Wrap(t), tester.BypassFactory(Tools))
 }
@@ -45,6 +52,68 @@ func TestSearchFiles(t *testing.T) {
 	tester.TestSearchFiles(tester.Wrap(t), tester.BypassFactory(Tools))
 }
 
+func TestWatchDirectory(t *testing.T) {
+	watches := NewWatches()
+	defer watches.Close()
+	tester.TestWatchDirectory(tester.Wrap(t), tester.BypassFactory(Tools, watches.Wrap))
+}
+
 func TestWriteFile(t *testing.T) {
 	tester.TestWriteFile(tester.Wrap(t), tester.BypassFactory(Tools))
 }
+
+func TestToolAnnotations(t *testing.T) {
+	for _, tool := range Tools {
+		annotations := tool.Tool.Annotations
+		if annotations.ReadOnlyHint == nil || annotations.DestructiveHint == nil ||
+			annotations.IdempotentHint == nil || annotations.OpenWorldHint == nil {
+			t.Errorf("Expected all hints to be set for %s, got %+v", tool.Tool.Name, annotations)
+		}
+		if *annotations.ReadOnlyHint && *annotations.DestructiveHint {
+			t.Errorf("Expected read-only tool %s not to be destructive", tool.Tool.Name)
+		}
+	}
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	var calls []string
+	// trace records the calls it sees, and guard rejects those of write_file
+	trace := func(name string) tester.Middleware {
+		return func(tool tester.ToolHandler) tester.ToolHandler {
+			handler := tool.Handler
+			tool.Handler = func(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+				calls = append(calls, name+" "+req.Params.Name)
+				return handler(ctx, req, allowedDirs)
+			}
+			return tool
+		}
+	}
+	guard := func(tool tester.ToolHandler) tester.ToolHandler {
+		if tool.Tool.Name != "write_file" {
+			return tool
+		}
+		tool.Handler = func(context.Context, mcp.CallToolRequest, []string) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultError("write_file is disabled"), nil
+		}
+		return tool
+	}
+	_, client := tester.BypassFactory(Tools, trace("outer"), guard, trace("inner"))(context.Background(), []string{t.TempDir()})
+	for _, name := range []string{"list_allowed_directories", "write_file"} {
+		req := mcp.CallToolRequest{}
+		req.Params.Name = name
+		result, err := client.CallTool(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.IsError != (name == "write_file") {
+			t.Errorf("Unexpected result for %s: %+v", name, result)
+		}
+	}
+	expected := []string{"outer list_allowed_directories", "inner list_allowed_directories", "outer write_file"}
+	if !slices.Equal(calls, expected) {
+		t.Errorf("Expected calls %v, got %v", expected, calls)
+	}
+	if wrapped := tester.Chain()(Tools[0]); wrapped.Tool.Name != Tools[0].Tool.Name {
+		t.Errorf("Expected an empty chain to return the tool unchanged")
+	}
+}
@@ -0,0 +1,127 @@
+package top
+
+import (
+	"context"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+// tracerName is the instrumentation scope of the spans of the server.
+const tracerName = "github.com/optistar/mcp-server-filesystem"
+
+// Tracing traces tool calls, continuing the traces of clients that send a W3C trace context in the
+// _meta of their requests. Handlers add child spans for path validation, walks and writes.
+type Tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// NewTracing creates tracing that starts the spans of calls with tp.
+func NewTracing(tp trace.TracerProvider) *Tracing {
+	return &Tracing{tracer: tp.Tracer(tracerName), propagator: propagation.TraceContext{}}
+}
+
+// NewOTLPTracerProvider creates a tracer provider exporting spans in batches to an OTLP/HTTP collector.
+// endpoint is the base URL of the collector, such as http://localhost:4318, to which /v1/traces is
+// appended. Spans still buffered are exported when the provider is shut down.
+func NewOTLPTracerProvider(ctx context.Context, endpoint, serviceVersion string) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithEndpointURL(strings.TrimSuffix(endpoint, "/")+"/v1/traces"))
+	if err != nil {
+		return nil, err
+	}
+	res := resource.NewSchemaless(
+		semconv.ServiceName("mcp-server-filesystem"),
+		semconv.ServiceVersion(serviceVersion),
+	)
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res)), nil
+}
+
+// Wrap returns a copy of t whose handler runs in a span, named after the MCP method and tool.
+// Failed calls set the status of the span, with the category of the error.
+func (tr *Tracing) Wrap(t tester.ToolHandler) tester.ToolHandler {
+	name := t.Tool.Name
+	handler := t.Handler
+	// Resources, prompts and completions are named after their method
+	method, spanName := "tools/call", "tools/call "+name
+	if strings.Contains(name, "/") {
+		method, spanName = name, name
+	}
+	t.Handler = func(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+		if meta := req.Params.Meta; meta != nil {
+			carrier := propagation.MapCarrier{}
+			for key, value := range meta.AdditionalFields {
+				if s, ok := value.(string); ok {
+					carrier[key] = s
+				}
+			}
+			ctx = tr.propagator.Extract(ctx, carrier)
+		}
+		attrs := []attribute.KeyValue{attribute.String("mcp.method.name", method)}
+		if method == "tools/call" {
+			attrs = append(attrs, attribute.String("gen_ai.tool.name", name))
+		}
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			attrs = append(attrs, attribute.String("mcp.session.id", session.SessionID()))
+		}
+		ctx, span := tr.tracer.Start(ctx, spanName, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+		defer span.End()
+
+		rec := &callRecord{}
+		result, err := handler(withCallRecord(ctx, rec), req, allowedDirs)
+		rec.mu.Lock()
+		span.SetAttributes(
+			attribute.Int64("fs.bytes_read", rec.bytesRead),
+			attribute.Int64("fs.bytes_written", rec.bytesWritten),
+			attribute.Int64("fs.walk.entries", rec.walkEntries),
+		)
+		rec.mu.Unlock()
+		if category := errorCategory(result, err); category != "" {
+			span.SetAttributes(attribute.String("error.type", category))
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+			} else {
+				span.SetStatus(codes.Error, resultText(result))
+			}
+		}
+		return result, err
+	}
+	return t
+}
+
+// startSpan starts a child span of the traced call of ctx, about path unless it is "". Untraced calls
+// get a span that records nothing.
+func startSpan(ctx context.Context, name, path string) (context.Context, trace.Span) {
+	var options []trace.SpanStartOption
+	if path != "" {
+		options = append(options, trace.WithAttributes(attribute.String("fs.path", path)))
+	}
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, name, options...)
+}
+
+// endSpan ends a span, recording err if it is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traced runs f, a filesystem operation on path, in a child span of the call of ctx.
+func traced(ctx context.Context, name, path string, f func() error) error {
+	_, span := startSpan(ctx, name, path)
+	err := f()
+	endSpan(span, err)
+	return err
+}
@@ -0,0 +1,131 @@
+package top
+
+import (
+	"context"
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	tempDir := t.TempDir()
+	recorder := tracetest.NewSpanRecorder()
+	tracing := NewTracing(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	handlers := map[string]func(context.Context, mcp.CallToolRequest, []string) (*mcp.CallToolResult, error){}
+	for _, tool := range Tools {
+		handlers[tool.Tool.Name] = tracing.Wrap(tool).Handler
+	}
+	call := func(name string, args map[string]interface{}, meta map[string]any) []sdktrace.ReadOnlySpan {
+		t.Helper()
+		recorder.Reset()
+		req := mcp.CallToolRequest{}
+		req.Params.Name = name
+		req.Params.Arguments = args
+		if meta != nil {
+			req.Params.Meta = mcp.NewMetaFromMap(meta)
+		}
+		if _, err := handlers[name](context.Background(), req, []string{tempDir}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return recorder.Ended()
+	}
+	byName := func(spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+		t.Helper()
+		for _, span := range spans {
+			if span.Name() == name {
+				return span
+			}
+		}
+		t.Fatalf("Missing span %s", name)
+		return nil
+	}
+	attr := func(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+		for _, kv := range span.Attributes() {
+			if string(kv.Key) == key {
+				return kv.Value
+			}
+		}
+		return attribute.Value{}
+	}
+
+	t.Run("Calls continue the trace of the request", func(t *testing.T) {
+		path := filepath.Join(tempDir, "test.txt")
+		spans := call("write_file", map[string]interface{}{"path": path, "content": "hello"},
+			map[string]any{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"})
+		root := byName(spans, "tools/call write_file")
+		if root.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+			root.Parent().SpanID().String() != "00f067aa0ba902b7" || !root.Parent().IsRemote() {
+			t.Errorf("Expected the span to continue the remote trace, got parent %v", root.Parent())
+		}
+		if attr(root, "gen_ai.tool.name").AsString() != "write_file" || attr(root, "fs.bytes_written").AsInt64() != 5 {
+			t.Errorf("Unexpected attributes: %v", root.Attributes())
+		}
+		for _, name := range []string{"fs.validate_path", "fs.write"} {
+			child := byName(spans, name)
+			if child.Parent().SpanID() != root.SpanContext().SpanID() || attr(child, "fs.path").AsString() != path {
+				t.Errorf("Expected %s to be a child span about %s, got %v", name, path, child.Attributes())
+			}
+		}
+	})
+
+	t.Run("Calls without trace context start a trace", func(t *testing.T) {
+		if err := os.Mkdir(filepath.Join(tempDir, "sub"), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		spans := call("search_files", map[string]interface{}{"path": tempDir, "pattern": "test"}, nil)
+		root := byName(spans, "tools/call search_files")
+		if root.Parent().IsValid() {
+			t.Errorf("Expected a root span, got parent %v", root.Parent())
+		}
+		walk := byName(spans, "fs.walk")
+		if walk.Parent().SpanID() != root.SpanContext().SpanID() || attr(walk, "fs.walk.entries").AsInt64() != 3 {
+			t.Errorf("Unexpected walk span: %v", walk.Attributes())
+		}
+	})
+
+	t.Run("Failed calls set the status", func(t *testing.T) {
+		spans := call("read_file", map[string]interface{}{"path": "/etc/passwd"}, nil)
+		root := byName(spans, "tools/call read_file")
+		if root.Status().Code != codes.Error || attr(root, "error.type").AsString() != ErrorAccessDenied {
+			t.Errorf("Unexpected status %v and attributes %v", root.Status(), root.Attributes())
+		}
+		if validate := byName(spans, "fs.validate_path"); validate.Status().Code != codes.Error {
+			t.Errorf("Expected failed validation span, got %v", validate.Status())
+		}
+	})
+
+	t.Run("Spans are exported to the collector", func(t *testing.T) {
+		var exports atomic.Int32
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost && r.URL.Path == "/v1/traces" {
+				exports.Add(1)
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer collector.Close()
+		tp, err := NewOTLPTracerProvider(context.Background(), collector.URL+"/", "test")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		handler := NewTracing(tp).Wrap(Tools[0]).Handler
+		req := mcp.CallToolRequest{}
+		req.Params.Arguments = map[string]interface{}{"path": tempDir}
+		if _, err := handler(context.Background(), req, []string{tempDir}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := tp.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Failed to export spans: %v", err)
+		}
+		if exports.Load() == 0 {
+			t.Errorf("Expected spans to be exported to the collector")
+		}
+	})
+}
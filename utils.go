@@ -1,7 +1,9 @@
 package top
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,17 +13,21 @@ func isSymlink(info os.FileInfo) bool {
 	return info.Mode()&os.ModeSymlink == os.ModeSymlink
 }
 
-func isInAllowedDirectories(cleanPath string, allowedDirectories []string) (bool, string) {
+func isInAllowedDirectories(b Backend, cleanPath string, allowedDirectories []string) (bool, string) {
 	for _, dir := range allowedDirectories {
 		if strings.HasPrefix(cleanPath, dir) {
-			info, err := os.Lstat(cleanPath)
+			info, err := b.Lstat(cleanPath)
 			if err == nil {
 				// Path exists - validate it directly
 				if isSymlink(info) {
-					linkTarget, err := os.Readlink(cleanPath)
+					linkTarget, err := b.Readlink(cleanPath)
 					if err != nil {
 						return false, ""
 					}
+					// Relative targets, common in archives, are relative to the directory of the link
+					if !filepath.IsAbs(linkTarget) {
+						linkTarget = filepath.Join(filepath.Dir(cleanPath), linkTarget)
+					}
 					return true, linkTarget
 				}
 				return true, ""
@@ -37,14 +43,17 @@ func isInAllowedDirectories(cleanPath string, allowedDirectories []string) (bool
 				}
 
 				// Check if this parent exists
-				parentInfo, err := os.Lstat(parentPath)
+				parentInfo, err := b.Lstat(parentPath)
 				if err == nil {
 					// Path exists - validate it directly
 					if isSymlink(parentInfo) {
-						parentTarget, err := os.Readlink(parentPath)
+						parentTarget, err := b.Readlink(parentPath)
 						if err != nil {
 							return false, ""
 						}
+						if !filepath.IsAbs(parentTarget) {
+							parentTarget = filepath.Join(filepath.Dir(parentPath), parentTarget)
+						}
 						return true, filepath.Join(parentTarget, strings.TrimPrefix(cleanPath, parentPath))
 					}
 					return true, ""
@@ -58,7 +67,11 @@ func isInAllowedDirectories(cleanPath string, allowedDirectories []string) (bool
 	return false, ""
 }
 
-func validatePath(requestedPath string, allowedDirectories []string) (string, error) {
+// validatePath resolves requestedPath and checks that it, and any symlinks it goes through,
+// stay inside the allowed directories. The resulting path is recorded on the call.
+func validatePath(ctx context.Context, requestedPath string, allowedDirectories []string) (_ string, err error) {
+	ctx, span := startSpan(ctx, "fs.validate_path", requestedPath)
+	defer func() { endSpan(span, err) }()
 	absPath, err := filepath.Abs(ExpandHome(requestedPath))
 	if err != nil {
 		return "", fmt.Errorf("invalid path: %v", err)
@@ -71,22 +84,63 @@ func validatePath(requestedPath string, allowedDirectories []string) (string, er
 	tempPath := cleanPath
 	for {
 		visited[tempPath] = struct{}{}
-		ok, target := isInAllowedDirectories(tempPath, allowedDirectories)
+		ok, target := isInAllowedDirectories(backendFromContext(ctx), tempPath, allowedDirectories)
 		if !ok {
 			return "", fmt.Errorf("access denied - path outside allowed directories: %s", absPath)
 		}
+		if isDenied(ctx, tempPath) {
+			warn(ctx, "Access denied by a deny pattern", absPath, nil)
+			return "", fmt.Errorf("access denied - path matches a deny pattern: %s", absPath)
+		}
 		if target == "" {
 			// No symlink - we're done
+			notePath(ctx, cleanPath)
 			return cleanPath, nil
 		}
 		// Follow the symlink
 		if _, ok := visited[target]; ok {
+			warn(ctx, "Symlink loop detected", absPath, nil)
 			return "", fmt.Errorf("access denied - symlink loop detected: %s", absPath)
 		}
 		tempPath = target
 	}
 }
 
+// contextReader stops reading once its context is done, so large reads can be abandoned.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// readFileContext reads a whole file, giving up if the context is done.
+func readFileContext(ctx context.Context, path string) ([]byte, error) {
+	f, err := openFile(backendFromContext(ctx), path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(contextReader{ctx, f})
+}
+
+// rootOf returns the allowed directory containing path, preferring the most specific one.
+func rootOf(path string, allowedDirs []string) string {
+	root := ""
+	for _, dir := range allowedDirs {
+		prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+		if (path == dir || strings.HasPrefix(path, prefix)) && len(dir) > len(root) {
+			root = dir
+		}
+	}
+	return root
+}
+
 // Utility functions
 func ExpandHome(path string) string {
 	if strings.HasPrefix(path, "~/") || path == "~" {
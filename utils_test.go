@@ -1,6 +1,7 @@
 package top
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -27,7 +28,7 @@ func TestValidatePath(t *testing.T) {
 	// Helper function for path validation assertions
 	assertPathValidation := func(t *testing.T, path string, expectedError bool) {
 		t.Helper()
-		validPath, err := validatePath(path, allowedDirs)
+		validPath, err := validatePath(context.Background(), path, allowedDirs)
 
 		if expectedError {
 			if err == nil {
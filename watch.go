@@ -0,0 +1,415 @@
+package top
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxWatchEvents is the number of events buffered by each watch; older events are
+	// dropped, and the next poll that would have returned them reports an overflow.
+	maxWatchEvents = 1000
+	// maxWatchesPerSession is the number of watches a session may have; starting another stops the oldest.
+	maxWatchesPerSession = 8
+)
+
+// ChangeEvent is a change found by a watch. Renamed events name the previous path in OldPath;
+// entries moved into or out of the watched directory are reported as created or deleted.
+type ChangeEvent struct {
+	Type    string `json:"type"`
+	Path    string `json:"path"`
+	OldPath string `json:"oldPath,omitempty"`
+}
+
+// Watches tracks the recursive directory watches started by watch_directory, separately for each session.
+type Watches struct {
+	mu      sync.Mutex
+	nextID  int
+	watches map[int]*watch
+}
+
+// NewWatches creates an empty set of watches.
+func NewWatches() *Watches {
+	return &Watches{watches: map[int]*watch{}}
+}
+
+// Wrap returns a copy of t whose handler can start and poll the watches of the calling session.
+func (w *Watches) Wrap(t tester.ToolHandler) tester.ToolHandler {
+	handler := t.Handler
+	t.Handler = func(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+		scope := &watchScope{watches: w, session: sessionID(ctx)}
+		return handler(context.WithValue(ctx, watchScopeKey{}, scope), req, allowedDirs)
+	}
+	return t
+}
+
+// watchScope binds a set of watches to the session of a call.
+type watchScope struct {
+	watches *Watches
+	session string
+}
+
+type watchScopeKey struct{}
+
+func watchScopeFromContext(ctx context.Context) *watchScope {
+	scope, _ := ctx.Value(watchScopeKey{}).(*watchScope)
+	return scope
+}
+
+// Forget stops the watches of a session that has ended.
+func (w *Watches) Forget(_ context.Context, session server.ClientSession) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id, dw := range w.watches {
+		if dw.session == session.SessionID() {
+			dw.close()
+			delete(w.watches, id)
+		}
+	}
+}
+
+// Close stops all watches.
+func (w *Watches) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id, dw := range w.watches {
+		dw.close()
+		delete(w.watches, id)
+	}
+}
+
+// start watches dir and everything below it for session, stopping the oldest watch of the session if it has too many.
+func (w *Watches) start(ctx context.Context, session, dir string, exclude ExcludeMatcher) (*watch, error) {
+	dw, err := newWatch(ctx, dir, exclude)
+	if err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.nextID++
+	dw.id, dw.session = w.nextID, session
+	w.watches[dw.id] = dw
+	oldest, count := 0, 0
+	for id, other := range w.watches {
+		if other.session == session {
+			count++
+			if oldest == 0 || id < oldest {
+				oldest = id
+			}
+		}
+	}
+	if count > maxWatchesPerSession {
+		w.watches[oldest].close()
+		delete(w.watches, oldest)
+	}
+	return dw, nil
+}
+
+// lookup returns the watch of session with the given ID, if it is still running.
+func (w *Watches) lookup(session string, id int) *watch {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if dw, ok := w.watches[id]; ok && dw.session == session {
+		return dw
+	}
+	return nil
+}
+
+// watch follows the changes below one directory. Events are numbered from 1, and a cursor
+// is the ID of the watch with the number of the last event returned to the client.
+type watch struct {
+	id      int
+	session string
+	// ctx carries the backend, policy and limits of the call that started the watch, and nothing else of it.
+	ctx     context.Context
+	root    string
+	exclude ExcludeMatcher
+	watcher *fsnotify.Watcher
+
+	mu     sync.Mutex
+	dirs   map[string]bool
+	events []numberedEvent
+	next   int64
+	// gap is the number of the first event after the last loss; cursors before it missed events.
+	gap int64
+	// delivered is the number of the last event returned by a poll; later events may still be merged.
+	delivered int64
+	// pendingRename is the old path of a rename whose new path, if in the watch, comes with the next event.
+	pendingRename string
+}
+
+// watchContext returns a context for the work of a watch after the call starting it has ended.
+// It carries the backend, policy and limits of that call, but not its deadline, span or call record.
+func watchContext(ctx context.Context) context.Context {
+	wctx := withBackend(context.Background(), backendFromContext(ctx))
+	if scope := policyScopeFromContext(ctx); scope != nil {
+		wctx = context.WithValue(wctx, policyScopeKey{}, scope)
+	}
+	return WithLimits(wctx, limitsFromContext(ctx))
+}
+
+func newWatch(ctx context.Context, root string, exclude ExcludeMatcher) (*watch, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	dw := &watch{
+		ctx:     watchContext(ctx),
+		root:    root,
+		exclude: exclude,
+		watcher: watcher,
+		dirs:    map[string]bool{},
+		next:    1,
+	}
+	budget := newWalkBudget(ctx, root)
+	err = dw.addTree(root, budget, false)
+	budget.end()
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	if budget.exhausted != "" {
+		watcher.Close()
+		return nil, fmt.Errorf("directory too large to watch: %s", budget.exhausted)
+	}
+	go dw.run()
+	return dw, nil
+}
+
+func (dw *watch) close() {
+	_ = dw.watcher.Close()
+}
+
+// cursor returns the cursor of the last event of the watch.
+func (dw *watch) cursor() string {
+	return fmt.Sprintf("%d:%d", dw.id, dw.next-1)
+}
+
+// parseWatchCursor splits a cursor into the ID of its watch and the number of its last event.
+func parseWatchCursor(cursor string) (int, int64, error) {
+	id, seq, ok := strings.Cut(cursor, ":")
+	if ok {
+		watchID, err1 := strconv.Atoi(id)
+		last, err2 := strconv.ParseInt(seq, 10, 64)
+		if err1 == nil && err2 == nil {
+			return watchID, last, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid cursor: %s", cursor)
+}
+
+// poll returns the events after the cursor event last, whether events were lost since, and the new cursor.
+func (dw *watch) poll(last int64) ([]ChangeEvent, bool, string, error) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if last < 0 || last >= dw.next {
+		return nil, false, "", fmt.Errorf("invalid cursor: %s", fmt.Sprintf("%d:%d", dw.id, last))
+	}
+	// A rename whose new path has not arrived yet left the watched directory
+	dw.flushRename()
+	overflow := last < dw.gap
+	events := []ChangeEvent{}
+	for _, event := range dw.events {
+		if event.seq > last {
+			events = append(events, event.ChangeEvent)
+		}
+	}
+	dw.delivered = dw.next - 1
+	return events, overflow, dw.cursor(), nil
+}
+
+// run records the events of the watcher until it is closed.
+func (dw *watch) run() {
+	for {
+		select {
+		case event, ok := <-dw.watcher.Events:
+			if !ok {
+				return
+			}
+			dw.mu.Lock()
+			dw.handle(event)
+			dw.mu.Unlock()
+		case err, ok := <-dw.watcher.Errors:
+			if !ok {
+				return
+			}
+			if !errors.Is(err, fsnotify.ErrEventOverflow) {
+				slog.Error("Error watching directory", "path", dw.root, "error", err)
+			}
+			dw.mu.Lock()
+			dw.lose()
+			dw.mu.Unlock()
+		}
+	}
+}
+
+// handle translates an event of the watcher into change events.
+func (dw *watch) handle(event fsnotify.Event) {
+	path := event.Name
+	if dw.pendingRename != "" {
+		oldPath := dw.pendingRename
+		dw.pendingRename = ""
+		if event.Has(fsnotify.Create) {
+			dw.renamed(oldPath, path)
+			return
+		}
+		dw.emit(ChangeEvent{Type: "deleted", Path: oldPath})
+	}
+	switch {
+	case event.Has(fsnotify.Create):
+		// An entry already gone again is still reported, and its removal comes next
+		info, _ := os.Lstat(path)
+		if !dw.visible(path, info) {
+			return
+		}
+		dw.emit(ChangeEvent{Type: "created", Path: path})
+		if info != nil && info.IsDir() {
+			// Entries created before the directory was watched are reported as created too
+			dw.addNewTree(path, true)
+		}
+	case event.Has(fsnotify.Write):
+		if dw.visible(path, nil) {
+			dw.emit(ChangeEvent{Type: "modified", Path: path})
+		}
+	case event.Has(fsnotify.Remove):
+		if dw.visible(path, nil) {
+			dw.emit(ChangeEvent{Type: "deleted", Path: path})
+		}
+		dw.removeTree(path)
+	case event.Has(fsnotify.Rename):
+		if dw.visible(path, nil) {
+			dw.pendingRename = path
+		}
+		dw.removeTree(path)
+	}
+}
+
+// renamed records the move of oldPath to path within the watched directory.
+func (dw *watch) renamed(oldPath, path string) {
+	info, _ := os.Lstat(path)
+	if !dw.visible(path, info) {
+		dw.emit(ChangeEvent{Type: "deleted", Path: oldPath})
+		return
+	}
+	dw.emit(ChangeEvent{Type: "renamed", Path: path, OldPath: oldPath})
+	if info != nil && info.IsDir() {
+		dw.addNewTree(path, false)
+	}
+}
+
+// flushRename reports a pending rename as a deletion.
+func (dw *watch) flushRename() {
+	if dw.pendingRename != "" {
+		dw.emit(ChangeEvent{Type: "deleted", Path: dw.pendingRename})
+		dw.pendingRename = ""
+	}
+}
+
+// visible reports whether changes to path are reported, given its info if known.
+func (dw *watch) visible(path string, info os.FileInfo) bool {
+	if info == nil {
+		info = pathInfo{name: filepath.Base(path), dir: dw.dirs[path]}
+	}
+	return !isDeniedEntry(dw.ctx, path, info) && !dw.exclude.Match(dw.root, path, info)
+}
+
+// addNewTree watches a directory that appeared below the root, reporting its entries as created if asked.
+// Changes that cannot be followed are reported as an overflow.
+func (dw *watch) addNewTree(dir string, created bool) {
+	budget := newWalkBudget(dw.ctx, dir)
+	defer budget.end()
+	if err := dw.addTree(dir, budget, created); err != nil {
+		warn(dw.ctx, "Changes below a new directory cannot be followed", dir, err)
+		dw.lose()
+	}
+}
+
+// addTree watches dir and the visible directories below it, reporting their entries as created if asked.
+func (dw *watch) addTree(dir string, budget *walkBudget, created bool) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Entries that cannot be read cannot be watched either
+			warn(dw.ctx, "Skipped unreadable entry", path, err)
+			if entry != nil && entry.IsDir() && path != dir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !budget.next() {
+			if err := budget.err(); err != nil {
+				return err
+			}
+			return fs.SkipAll
+		}
+		if path != dir {
+			info, err := entry.Info()
+			if err != nil || !dw.visible(path, info) {
+				if entry.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if created {
+				dw.emit(ChangeEvent{Type: "created", Path: path})
+			}
+		}
+		if entry.IsDir() {
+			if err := dw.watcher.Add(path); err != nil {
+				return err
+			}
+			dw.dirs[path] = true
+		}
+		return nil
+	})
+}
+
+// removeTree stops watching path and the directories below it, which were removed or moved away.
+func (dw *watch) removeTree(path string) {
+	for dir := range dw.dirs {
+		if isWithin(dir, path) {
+			// The watch of a removed directory is already gone
+			_ = dw.watcher.Remove(dir)
+			delete(dw.dirs, dir)
+		}
+	}
+}
+
+// numberedEvent is a buffered event with its number.
+type numberedEvent struct {
+	ChangeEvent
+	seq int64
+}
+
+// emit buffers an event, merging repeated modifications that no poll has returned yet.
+func (dw *watch) emit(event ChangeEvent) {
+	if n := len(dw.events); n > 0 && event.Type == "modified" &&
+		dw.events[n-1].seq > dw.delivered && dw.events[n-1].ChangeEvent == event {
+		return
+	}
+	dw.events = append(dw.events, numberedEvent{ChangeEvent: event, seq: dw.next})
+	dw.next++
+	if len(dw.events) > maxWatchEvents {
+		dw.gap = dw.events[0].seq + 1
+		dw.events = dw.events[1:]
+	}
+}
+
+// lose records that events were lost, so that polls from before now report an overflow.
+func (dw *watch) lose() {
+	dw.flushRename()
+	// The lost events take one number, so that the next cursor is past the gap
+	dw.gap = dw.next
+	dw.next++
+}
@@ -0,0 +1,80 @@
+package top
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func DefineWatchDirectoryTool() mcp.Tool {
+	return mcp.NewTool("watch_directory",
+		mcp.WithDescription(
+			"Start watching a directory and everything below it for changes. "+
+				"Returns a cursor to pass to poll_changes, which reports the files and directories "+
+				"created, modified, deleted or renamed since. Use this to follow external changes "+
+				"without listing the directory again. A session can have 8 watches; starting another "+
+				"stops the oldest. Only works within allowed directories."),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(false),
+		mcp.WithOpenWorldHintAnnotation(false),
+		withArguments[WatchDirectoryArgs](),
+		mcp.WithOutputSchema[WatchInfo](),
+	)
+}
+
+// WatchDirectoryArgs are the arguments of watch_directory.
+type WatchDirectoryArgs struct {
+	Path            string   `arg:"path,required" desc:"Directory to watch"`
+	ExcludePatterns []string `arg:"excludePatterns,default=[]" desc:"Patterns of paths whose changes are not reported"`
+}
+
+type WatchInfo struct {
+	Path        string `json:"path"`
+	Directories int    `json:"directories"`
+	Cursor      string `json:"cursor"`
+}
+
+func WatchDirectoryHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	scope := watchScopeFromContext(ctx)
+	if scope == nil {
+		return mcp.NewToolResultError("watching is not available"), nil
+	}
+	args, err := bindArguments[WatchDirectoryArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	excludeMatcher := NewExcludeMatcher()
+	for _, ep := range args.ExcludePatterns {
+		if err := excludeMatcher.AddPattern(ep); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+	validPath, err := validatePath(ctx, args.Path, allowedDirs)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !isLocal(ctx, validPath) {
+		return mcp.NewToolResultError("watching is only available on the local filesystem"), nil
+	}
+	info, err := backendFromContext(ctx).Stat(validPath)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !info.IsDir() {
+		return mcp.NewToolResultError("Path must be a directory"), nil
+	}
+
+	dw, err := scope.watches.start(ctx, scope.session, validPath, excludeMatcher)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	dw.mu.Lock()
+	watchInfo := WatchInfo{Path: validPath, Directories: len(dw.dirs), Cursor: dw.cursor()}
+	dw.mu.Unlock()
+	jsonData, err := json.Marshal(watchInfo)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return mcp.NewToolResultStructured(watchInfo, string(jsonData)), nil
+}
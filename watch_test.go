@@ -0,0 +1,150 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/optistar/mcp-server-filesystem/tester"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWatches(t *testing.T) {
+	tempDir := t.TempDir()
+	watches := NewWatches()
+	defer watches.Close()
+	start := func(t *testing.T, session string) *watch {
+		t.Helper()
+		dw, err := watches.start(context.Background(), session, tempDir, NewExcludeMatcher())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return dw
+	}
+
+	t.Run("Dropped events are reported as overflow", func(t *testing.T) {
+		dw := start(t, "")
+		dw.mu.Lock()
+		for i := 0; i < maxWatchEvents+10; i++ {
+			dw.emit(ChangeEvent{Type: "created", Path: fmt.Sprintf("file%d", i)})
+		}
+		dw.mu.Unlock()
+		events, overflow, cursor, err := dw.poll(0)
+		if err != nil || !overflow || len(events) != maxWatchEvents || events[0].Path != "file10" {
+			t.Fatalf("Expected overflow with the last events, got %v, %d events, %v", overflow, len(events), err)
+		}
+		events, overflow, _, err = dw.poll(int64(maxWatchEvents + 5))
+		if err != nil || overflow || len(events) != 5 {
+			t.Errorf("Expected 5 events without overflow, got %v, %d events, %v", overflow, len(events), err)
+		}
+		if _, _, _, err := dw.poll(int64(maxWatchEvents + 11)); err == nil {
+			t.Errorf("Expected error for cursor past the last event")
+		}
+
+		dw.mu.Lock()
+		dw.lose()
+		dw.mu.Unlock()
+		_, last := parseCursor(t, cursor)
+		if _, overflow, cursor, _ = dw.poll(last); !overflow {
+			t.Errorf("Expected overflow after lost events")
+		}
+		_, last = parseCursor(t, cursor)
+		if _, overflow, _, _ = dw.poll(last); overflow {
+			t.Errorf("Expected overflow to be reported once")
+		}
+	})
+
+	t.Run("Modifications are merged until polled", func(t *testing.T) {
+		dw := start(t, "")
+		modified := ChangeEvent{Type: "modified", Path: "file"}
+		dw.mu.Lock()
+		dw.emit(modified)
+		dw.emit(modified)
+		dw.mu.Unlock()
+		events, _, cursor, _ := dw.poll(0)
+		if len(events) != 1 {
+			t.Errorf("Expected 1 event, got %v", events)
+		}
+		dw.mu.Lock()
+		dw.emit(modified)
+		dw.mu.Unlock()
+		_, last := parseCursor(t, cursor)
+		if events, _, _, _ := dw.poll(last); len(events) != 1 {
+			t.Errorf("Expected 1 new event, got %v", events)
+		}
+	})
+
+	t.Run("Oldest watch of a session is stopped", func(t *testing.T) {
+		first := start(t, "one")
+		other := start(t, "two")
+		for i := 0; i < maxWatchesPerSession; i++ {
+			start(t, "one")
+		}
+		if watches.lookup("one", first.id) != nil {
+			t.Errorf("Expected oldest watch to be stopped")
+		}
+		if watches.lookup("two", other.id) == nil || watches.lookup("one", other.id) != nil {
+			t.Errorf("Expected watch to belong to its session only")
+		}
+	})
+
+	t.Run("Denied directories are not watched", func(t *testing.T) {
+		if err := os.MkdirAll(filepath.Join(tempDir, "secrets", "keys"), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		policy, err := NewPolicy(nil, []string{"secrets/"})
+		if err != nil {
+			t.Fatalf("Failed to create policy: %v", err)
+		}
+		var dw *watch
+		tool := policy.Wrap(tester.ToolHandler{
+			Handler: func(ctx context.Context, _ mcp.CallToolRequest, _ []string) (*mcp.CallToolResult, error) {
+				dw, err = newWatch(ctx, tempDir, NewExcludeMatcher())
+				return nil, nil
+			},
+		})
+		_, _ = tool.Handler(context.Background(), mcp.CallToolRequest{}, []string{tempDir})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer dw.close()
+		if len(dw.dirs) != 1 || !dw.dirs[tempDir] {
+			t.Errorf("Expected only the root to be watched, got %v", dw.dirs)
+		}
+	})
+
+	t.Run("Watches keep the policy but not the call record", func(t *testing.T) {
+		policy, err := NewPolicy(nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to create policy: %v", err)
+		}
+		var dw *watch
+		tool := policy.Wrap(tester.ToolHandler{
+			Handler: func(ctx context.Context, _ mcp.CallToolRequest, _ []string) (*mcp.CallToolResult, error) {
+				dw, err = newWatch(withCallRecord(ctx, &callRecord{}), tempDir, NewExcludeMatcher())
+				return nil, nil
+			},
+		})
+		_, _ = tool.Handler(context.Background(), mcp.CallToolRequest{}, []string{tempDir})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer dw.close()
+		if policyScopeFromContext(dw.ctx) == nil {
+			t.Errorf("Expected the watch to keep the policy of its call")
+		}
+		if callRecordFromContext(dw.ctx) != nil {
+			t.Errorf("Expected the watch not to keep the record of its call")
+		}
+	})
+}
+
+func parseCursor(t *testing.T, cursor string) (int, int64) {
+	t.Helper()
+	id, last, err := parseWatchCursor(cursor)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return id, last
+}
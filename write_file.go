@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/mark3labs/mcp-go/mcp"
-	"os"
 )
 
 func DefineWriteFileTool() mcp.Tool {
@@ -13,26 +12,48 @@ func DefineWriteFileTool() mcp.Tool {
 			"Create a new file or completely overwrite an existing file with new content. "+
 				"Use with caution as it will overwrite existing files without warning. "+
 				"Handles text content with proper encoding. Only works within allowed directories."),
-		mcp.WithString("path", mcp.Required(), mcp.Description("Path to the file")),
-		mcp.WithString("content", mcp.Required(), mcp.Description("Content to write")),
+		mcp.WithReadOnlyHintAnnotation(false),
+		mcp.WithDestructiveHintAnnotation(true),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+		withArguments[WriteFileArgs](),
 	)
 }
 
-func WriteFileHandler(_ context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
-	path, ok := req.Params.Arguments["path"].(string)
-	if !ok {
-		return mcp.NewToolResultError("path must be a string"), nil
+// WriteFileArgs are the arguments of write_file.
+type WriteFileArgs struct {
+	Path    string `arg:"path,required" desc:"Path to the file"`
+	Content string `arg:"content,required" desc:"Content to write"`
+}
+
+func WriteFileHandler(ctx context.Context, req mcp.CallToolRequest, allowedDirs []string) (*mcp.CallToolResult, error) {
+	args, err := bindArguments[WriteFileArgs](req.GetArguments())
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	validPath, err := validatePath(ctx, args.Path, allowedDirs)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-	content, ok := req.Params.Arguments["content"].(string)
-	if !ok {
-		return mcp.NewToolResultError("content must be a string"), nil
+	if err := ctx.Err(); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := checkWritable(ctx, validPath); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-	validPath, err := validatePath(path, allowedDirs)
+	defer lockWrites(ctx)()
+	refund, err := chargeFileWrite(ctx, validPath, int64(len(args.Content)))
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	if err := os.WriteFile(validPath, []byte(content), 0644); err != nil {
+	done := noteChange(ctx, validPath)
+	if err := traced(ctx, "fs.write", validPath, func() error {
+		return writeFile(backendFromContext(ctx), validPath, []byte(args.Content), 0644)
+	}); err != nil {
+		refund()
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	return mcp.NewToolResultText(fmt.Sprintf("Successfully wrote to %s", path)), nil
+	noteWritten(ctx, len(args.Content))
+	done(validPath)
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully wrote to %s", args.Path)), nil
 }